@@ -0,0 +1,80 @@
+// Command pinblock-server serves the PIN block operations of the server
+// package over HTTP, with the keys of a key store file.
+//
+//	pinblock-server -addr :8080 -keys keys.json
+//
+// The server does not authenticate its callers, it must only be reachable
+// behind an authenticated boundary. /decode returns clear PINs and is only
+// served with -decode.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/server"
+	"github.com/moov-io/pinblock/verification"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	keysPath := flag.String("keys", "", "path of the key store file")
+	decode := flag.Bool("decode", false, "serve /decode, which returns clear PINs")
+	table := flag.String("decimalization-table", verification.DefaultDecimalizationTable, "decimalization table of the IBM 3624 verifications")
+	flag.Parse()
+
+	if *keysPath == "" {
+		log.Fatal("keys is required")
+	}
+
+	// the table is checked with a cipher that is not used
+	if _, err := verification.NewIBM3624(encryption.NewNoOp(), *table); err != nil {
+		log.Fatalf("decimalization table: %v", err)
+	}
+
+	opts := []server.Option{server.WithDecimalizationTable(*table)}
+	if *decode {
+		opts = append(opts, server.WithDecode())
+	}
+
+	keys, err := server.LoadKeyStore(*keysPath)
+	if err != nil {
+		log.Fatalf("loading keys: %v", err)
+	}
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           server.New(keys, opts...),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutting down: %v", err)
+		}
+	}()
+
+	log.Printf("listening on %s", *addr)
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("serving: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+// Command pinblock encodes, decodes, translates and detects PIN blocks.
+//
+//	pinblock encode -format ISO-0 -pan 5432101234567891 -pin 1234
+//	pinblock decode -format ISO-0 -pan 5432101234567891 -block 041215FEDCBA9876
+//	pinblock decode -format ISO-0 -pan 5432101234567891 -block BA2ADC4EBA48F711 -key 0123456789ABCDEFFEDCBA9876543210
+//	pinblock translate -from ISO-0 -from-key <hex> -to ISO-4 -to-key <hex> -pan 5432101234567891 -block <block>
+//	pinblock detect -pan 5432101234567891 -block 041215FEDCBA9876
+//	pinblock rotate -from-key <old hex> -to-key <new hex> -in pinblocks.csv -out rotated.csv
+//
+// Keys are given in hex, AES for ISO-4 and TDES for the other formats, or as
+// TR-31 key blocks together with the key block protection key (-kbpk). The
+// -trace flag writes the encode and decode steps to stderr with the PAN and the
+// PIN masked, -trace-clear writes them in clear for test keys. The output of
+// decode and detect contains the clear PIN.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/moov-io/pinblock/keyblock"
+)
+
+const usage = `Usage: pinblock <command> [flags]
+
+Commands:
+  encode     encode a PIN into a PIN block
+  decode     decode the PIN of a PIN block
+  translate  translate a PIN block from one format and key to another
+  detect     list the formats that parse a clear PIN block
+  rotate     re-encrypt a CSV or JSONL file of PIN blocks under a new key
+
+Run pinblock <command> -h for the flags of a command.
+`
+
+type command func(args []string, stdout, stderr io.Writer) error
+
+var commands = map[string]command{
+	"encode":    encode,
+	"decode":    decode,
+	"translate": translate,
+	"detect":    detect,
+	"rotate":    rotate,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "pinblock: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("command is required")
+	}
+
+	if args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		fmt.Fprint(stdout, usage)
+		return nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+
+	err := cmd(args[1:], stdout, stderr)
+	if err == flag.ErrHelp {
+		// the flags were printed by the flag set
+		return nil
+	}
+
+	return err
+}
+
+func encode(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("encode", stderr)
+	name := fs.String("format", "ISO-0", "pin block format, one of "+strings.Join(formats.List(), ", "))
+	pan := fs.String("pan", "", "primary account number")
+	pin := fs.String("pin", "", "clear PIN")
+	key := fs.String("key", "", "PIN encryption key, hex or TR-31 key block")
+	kbpk := fs.String("kbpk", "", "key block protection key (hex) of a TR-31 key")
+	trace := fs.Bool("trace", false, "write the encode steps to stderr")
+	traceClear := fs.Bool("trace-clear", false, "write the PAN and the PIN of the trace in clear")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *pin == "" {
+		return fmt.Errorf("pin is required")
+	}
+
+	format, err := newFormat(*name, *key, *kbpk)
+	if err != nil {
+		return err
+	}
+
+	if *trace {
+		setTracer(format, stderr, *traceClear)
+	}
+
+	pinBlock, err := format.Encode(*pin, *pan)
+	if err != nil {
+		return fmt.Errorf("encoding pin block: %w", err)
+	}
+
+	fmt.Fprintln(stdout, pinBlock)
+
+	return nil
+}
+
+func decode(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("decode", stderr)
+	name := fs.String("format", "ISO-0", "pin block format, one of "+strings.Join(formats.List(), ", "))
+	pan := fs.String("pan", "", "primary account number")
+	block := fs.String("block", "", "PIN block (hex)")
+	key := fs.String("key", "", "PIN encryption key, hex or TR-31 key block")
+	kbpk := fs.String("kbpk", "", "key block protection key (hex) of a TR-31 key")
+	trace := fs.Bool("trace", false, "write the decode steps to stderr")
+	traceClear := fs.Bool("trace-clear", false, "write the PAN and the PIN of the trace in clear")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *block == "" {
+		return fmt.Errorf("block is required")
+	}
+
+	format, err := newFormat(*name, *key, *kbpk)
+	if err != nil {
+		return err
+	}
+
+	if *trace {
+		setTracer(format, stderr, *traceClear)
+	}
+
+	pin, err := format.Decode(*block, *pan)
+	if err != nil {
+		return fmt.Errorf("decoding pin block: %w", err)
+	}
+
+	fmt.Fprintln(stdout, pin)
+
+	return nil
+}
+
+func translate(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("translate", stderr)
+	fromName := fs.String("from", "ISO-0", "format of the PIN block")
+	toName := fs.String("to", "ISO-0", "format of the translated PIN block")
+	pan := fs.String("pan", "", "primary account number")
+	block := fs.String("block", "", "PIN block (hex)")
+	fromKey := fs.String("from-key", "", "key of the PIN block, hex or TR-31 key block")
+	fromKBPK := fs.String("from-kbpk", "", "key block protection key (hex) of a TR-31 from-key")
+	toKey := fs.String("to-key", "", "key of the translated PIN block, hex or TR-31 key block")
+	toKBPK := fs.String("to-kbpk", "", "key block protection key (hex) of a TR-31 to-key")
+	trace := fs.Bool("trace", false, "write the decode and encode steps to stderr")
+	traceClear := fs.Bool("trace-clear", false, "write the PAN and the PIN of the trace in clear")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *block == "" {
+		return fmt.Errorf("block is required")
+	}
+
+	from, err := newFormat(*fromName, *fromKey, *fromKBPK)
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+
+	to, err := newFormat(*toName, *toKey, *toKBPK)
+	if err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+
+	if *trace {
+		setTracer(from, stderr, *traceClear)
+		setTracer(to, stderr, *traceClear)
+	}
+
+	pinBlock, err := formats.TranslatePIN(*block, *pan, from, to)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, pinBlock)
+
+	return nil
+}
+
+func detect(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("detect", stderr)
+	pan := fs.String("pan", "", "primary account number, needed for ISO-0, ISO-3 and ISO-4")
+	block := fs.String("block", "", "clear PIN block (hex)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *block == "" {
+		return fmt.Errorf("block is required")
+	}
+
+	candidates, err := formats.Detect(*block, *pan)
+	if err != nil {
+		return err
+	}
+
+	if len(candidates) == 0 {
+		return fmt.Errorf("no format parses the pin block")
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "FORMAT\tPIN\tBITS\tCONFIDENCE\n")
+	for _, c := range candidates {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f\t%.2f\n", c.Name, c.PIN, c.Bits, c.Confidence)
+	}
+
+	return tw.Flush()
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// setTracer writes the trace of format to stderr, masked unless inClear is set
+func setTracer(format formats.Format, stderr io.Writer, inClear bool) {
+	mask := formats.DefaultMask
+	if inClear {
+		mask = formats.NoMask
+	}
+
+	if !formats.SetTracer(format, formats.NewWriterTracer(stderr, mask)) {
+		format.SetDebugWriter(stderr)
+	}
+}
+
+// newFormat returns the format registered with name, encrypted with key when
+// it is given
+func newFormat(name, key, kbpk string) (formats.Format, error) {
+	var opts []formats.Option
+
+	if key != "" {
+		cipher, err := newCipher(key, kbpk, name == "ISO-4")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, formats.WithCipher(cipher))
+	}
+
+	format, err := formats.NewFormatter(name, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("format %s: %w", name, err)
+	}
+
+	return format, nil
+}
+
+// newCipher returns the cipher of a hex key, AES or TDES, or of a TR-31 key
+// block when kbpk is given
+func newCipher(key, kbpk string, aes bool) (formats.Cipher, error) {
+	if kbpk != "" {
+		rawKBPK, err := hex.DecodeString(kbpk)
+		if err != nil {
+			return nil, fmt.Errorf("decoding kbpk: %w", err)
+		}
+
+		kb, err := keyblock.Unwrap(rawKBPK, key)
+		if err != nil {
+			return nil, fmt.Errorf("unwrapping key: %w", err)
+		}
+
+		return kb.Cipher()
+	}
+
+	rawKey, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("decoding key: %w", err)
+	}
+
+	if aes {
+		return encryption.NewAesECB(rawKey)
+	}
+
+	return encryption.NewTdesECB(rawKey)
+}
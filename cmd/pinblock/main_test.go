@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	account = "5432101234567891"
+	zpk     = "0123456789ABCDEFFEDCBA9876543210"
+
+	// TR-31 key block of the PIN encryption key F039121BEC83D26B169BDCD5B22AAF8F
+	kbpk     = "89E88CF7931444F334BD7547FC3F380C"
+	keyBlock = "B0080P0TE00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07"
+)
+
+func runCommand(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	err := run(args, &stdout, &stderr)
+
+	return strings.TrimSpace(stdout.String()), stderr.String(), err
+}
+
+func TestEncodeDecode(t *testing.T) {
+	t.Run("clear ISO-0", func(t *testing.T) {
+		out, _, err := runCommand(t, "encode", "-format", "ISO-0", "-pan", account, "-pin", "1234")
+		require.NoError(t, err)
+		require.Equal(t, "041215FEDCBA9876", out)
+
+		out, _, err = runCommand(t, "decode", "-format", "ISO-0", "-pan", account, "-block", "041215FEDCBA9876")
+		require.NoError(t, err)
+		require.Equal(t, "1234", out)
+	})
+
+	t.Run("hex key", func(t *testing.T) {
+		out, _, err := runCommand(t, "encode", "-pan", account, "-pin", "1234", "-key", zpk)
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", out)
+
+		out, _, err = runCommand(t, "decode", "-pan", account, "-block", "BA2ADC4EBA48F711", "-key", zpk)
+		require.NoError(t, err)
+		require.Equal(t, "1234", out)
+	})
+
+	t.Run("TR-31 key", func(t *testing.T) {
+		encrypted, _, err := runCommand(t, "encode", "-pan", account, "-pin", "1234", "-key", keyBlock, "-kbpk", kbpk)
+		require.NoError(t, err)
+
+		// the same block as with the clear key
+		expected, _, err := runCommand(t, "encode", "-pan", account, "-pin", "1234", "-key", "F039121BEC83D26B169BDCD5B22AAF8F")
+		require.NoError(t, err)
+		require.Equal(t, expected, encrypted)
+
+		// the key block is for encryption only
+		_, _, err = runCommand(t, "decode", "-pan", account, "-block", encrypted, "-key", keyBlock, "-kbpk", kbpk)
+		require.ErrorContains(t, err, "key can not be used for decryption")
+	})
+
+	t.Run("ISO-4 with AES key", func(t *testing.T) {
+		encrypted, _, err := runCommand(t, "encode", "-format", "ISO-4", "-pan", "432198765432109870", "-pin", "1234", "-key", zpk)
+		require.NoError(t, err)
+		require.Len(t, encrypted, 32)
+
+		out, _, err := runCommand(t, "decode", "-format", "ISO-4", "-pan", "432198765432109870", "-block", encrypted, "-key", zpk)
+		require.NoError(t, err)
+		require.Equal(t, "1234", out)
+	})
+
+	t.Run("trace", func(t *testing.T) {
+		out, trace, err := runCommand(t, "decode", "-pan", account, "-block", "041215FEDCBA9876", "-trace")
+		require.NoError(t, err)
+		require.Equal(t, "1234", out)
+		require.Contains(t, trace, "PIN block decode operation finished")
+		require.Contains(t, trace, "Formatted PAN block  : ****************")
+		require.Contains(t, trace, "Decoded PIN  : ****")
+
+		_, trace, err = runCommand(t, "decode", "-pan", account, "-block", "041215FEDCBA9876", "-trace", "-trace-clear")
+		require.NoError(t, err)
+		require.Contains(t, trace, "Formatted PAN block  : 0000210123456789")
+		require.Contains(t, trace, "Decoded PIN  : 1234")
+	})
+
+	t.Run("invalid flags", func(t *testing.T) {
+		_, _, err := runCommand(t, "encode", "-pan", account)
+		require.EqualError(t, err, "pin is required")
+
+		_, _, err = runCommand(t, "decode", "-pan", account)
+		require.EqualError(t, err, "block is required")
+
+		_, _, err = runCommand(t, "encode", "-format", "ISO-9", "-pan", account, "-pin", "1234")
+		require.EqualError(t, err, "format ISO-9: unsupported pinblock type")
+
+		_, _, err = runCommand(t, "encode", "-pan", account, "-pin", "1234", "-key", "0123")
+		require.EqualError(t, err, "key length must be 16 or 24 bytes")
+
+		_, _, err = runCommand(t, "encode", "-pan", account, "-pin", "1234", "-key", "XYZ")
+		require.ErrorContains(t, err, "decoding key")
+
+		_, _, err = runCommand(t, "decode", "-pan", "54321", "-block", "041215FEDCBA9876")
+		require.ErrorContains(t, err, "decoding pin block")
+	})
+}
+
+func TestTranslate(t *testing.T) {
+	out, _, err := runCommand(t, "translate", "-from", "ISO-0", "-from-key", zpk, "-to", "ISO-0",
+		"-pan", account, "-block", "BA2ADC4EBA48F711")
+	require.NoError(t, err)
+	require.Equal(t, "041215FEDCBA9876", out)
+
+	iso4Block, _, err := runCommand(t, "translate", "-from-key", zpk, "-to", "ISO-4", "-to-key", zpk,
+		"-pan", account, "-block", "BA2ADC4EBA48F711")
+	require.NoError(t, err)
+	require.Len(t, iso4Block, 32)
+
+	out, _, err = runCommand(t, "decode", "-format", "ISO-4", "-pan", account, "-block", iso4Block, "-key", zpk)
+	require.NoError(t, err)
+	require.Equal(t, "1234", out)
+
+	_, _, err = runCommand(t, "translate", "-to", "ISO-9", "-pan", account, "-block", "041215FEDCBA9876")
+	require.EqualError(t, err, "to: format ISO-9: unsupported pinblock type")
+}
+
+func TestDetect(t *testing.T) {
+	out, _, err := runCommand(t, "detect", "-pan", account, "-block", "041215FEDCBA9876")
+	require.NoError(t, err)
+
+	lines := strings.Split(out, "\n")
+	require.Equal(t, "FORMAT  PIN     BITS  CONFIDENCE", lines[0])
+	require.Equal(t, "ISO-0   1234    50.7  1.00", lines[1])
+
+	_, _, err = runCommand(t, "detect", "-block", "ABCDEFABCDEFABCD")
+	require.EqualError(t, err, "no format parses the pin block")
+}
+
+func TestRun(t *testing.T) {
+	_, stderr, err := runCommand(t)
+	require.EqualError(t, err, "command is required")
+	require.Contains(t, stderr, "Usage: pinblock <command> [flags]")
+
+	_, _, err = runCommand(t, "sign")
+	require.EqualError(t, err, "unknown command sign")
+
+	out, _, err := runCommand(t, "help")
+	require.NoError(t, err)
+	require.Contains(t, out, "translate")
+
+	_, stderr, err = runCommand(t, "encode", "-h")
+	require.NoError(t, err)
+	require.Contains(t, stderr, "-format")
+}
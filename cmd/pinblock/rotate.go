@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+)
+
+// statusOK is the status of the rows that are rotated
+const statusOK = "ok"
+
+// rotationWindow is the number of rows of a rotated file held in memory: the
+// rows are written in the order of the file and the PIN blocks that are
+// rotated before the previous ones wait for them
+const rotationWindow = 1024
+
+// rotationFile is a file of PIN blocks read for a key rotation, one row at a
+// time. header is written before the rows, next returns the next row of the
+// file or io.EOF at its end.
+type rotationFile struct {
+	header []byte
+	next   func() (rotationRow, error)
+}
+
+// rotationRow is a row of a rotationFile. The record is identified by its
+// line number and err is the error of a row that could not be read, it is
+// not rotated. rotated returns the text of the row with the PIN block and
+// the status of its result.
+type rotationRow struct {
+	record  formats.Record
+	err     error
+	rotated func(result formats.Result) ([]byte, error)
+}
+
+// rotate re-encrypts a file of PIN blocks under a new key and format. The
+// rotated file is written to -out, or stdout, and the key check values, the
+// failed records and the counts are reported to stderr.
+func rotate(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("rotate", stderr)
+	fromName := fs.String("from", "ISO-0", "format of the PIN blocks")
+	toName := fs.String("to", "ISO-0", "format of the rotated PIN blocks")
+	fromKey := fs.String("from-key", "", "key of the PIN blocks, hex or TR-31 key block")
+	fromKBPK := fs.String("from-kbpk", "", "key block protection key (hex) of a TR-31 from-key")
+	fromKCV := fs.String("from-kcv", "", "expected check value of the from-key")
+	toKey := fs.String("to-key", "", "key of the rotated PIN blocks, hex or TR-31 key block")
+	toKBPK := fs.String("to-kbpk", "", "key block protection key (hex) of a TR-31 to-key")
+	toKCV := fs.String("to-kcv", "", "expected check value of the to-key")
+	in := fs.String("in", "-", "file of PIN blocks, - for stdin")
+	out := fs.String("out", "-", "file of the rotated PIN blocks, - for stdout")
+	fileType := fs.String("type", "", "csv or jsonl, by default the extension of -in or csv")
+	workers := fs.Int("workers", 0, "number of PIN blocks rotated in parallel, the number of CPUs by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *fromKey == "" || *toKey == "" {
+		return fmt.Errorf("from-key and to-key are required")
+	}
+
+	from, fromCheck, err := newRotationFormat(*fromName, *fromKey, *fromKBPK, *fromKCV)
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+
+	to, toCheck, err := newRotationFormat(*toName, *toKey, *toKBPK, *toKCV)
+	if err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+
+	if *fileType == "" {
+		*fileType = strings.TrimPrefix(filepath.Ext(*in), ".")
+	}
+
+	var read func(r io.Reader) (*rotationFile, error)
+	switch strings.ToLower(*fileType) {
+	case "jsonl":
+		read = readJSONL
+	case "csv", "", "-":
+		read = readCSV
+	default:
+		return fmt.Errorf("unsupported file type %s", *fileType)
+	}
+
+	reader, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := read(reader)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", *in, err)
+	}
+
+	fmt.Fprintf(stderr, "from: %s, key check value %s\n", *fromName, fromCheck)
+	fmt.Fprintf(stderr, "to: %s, key check value %s\n", *toName, toCheck)
+
+	var rows, failed int
+	batch := formats.NewTranslateBatch(from, to, formats.WithWorkers(*workers))
+	if err := writeOutput(*out, stdout, func(w io.Writer) error {
+		return rotateFile(batch, file, w, func(result formats.Result) {
+			rows++
+			if result.Err != nil {
+				failed++
+				fmt.Fprintf(stderr, "line %s: %v\n", result.ID, result.Err)
+			}
+		})
+	}); err != nil {
+		return fmt.Errorf("rotating %s: %w", *in, err)
+	}
+
+	fmt.Fprintf(stderr, "rotated %d pin blocks, %d failed\n", rows-failed, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d pin blocks failed", failed, rows)
+	}
+
+	return nil
+}
+
+// rotateFile translates the records of the rows of file with batch as they
+// are read and writes the rows to w in the order of the file, with the result
+// of their record. The rows that could not be read are not translated,
+// report is called with the result of every row once it is written.
+func rotateFile(batch *formats.Batch, file *rotationFile, w io.Writer, report func(result formats.Result)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a row and the index of its record in the stream, -1 for the rows
+	// that are not translated
+	type pendingRow struct {
+		row   rotationRow
+		index int
+	}
+
+	rows := make(chan pendingRow, rotationWindow)
+	records := make(chan formats.Record)
+
+	var readErr error
+	go func() {
+		defer close(rows)
+		defer close(records)
+
+		for index := 0; ; {
+			row, err := file.next()
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+
+			pending := pendingRow{row: row, index: -1}
+			if row.err == nil {
+				pending.index = index
+				index++
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case rows <- pending:
+			}
+
+			if row.err == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case records <- row.record:
+				}
+			}
+		}
+	}()
+
+	if len(file.header) > 0 {
+		if _, err := fmt.Fprintf(w, "%s\n", file.header); err != nil {
+			return err
+		}
+	}
+
+	// the results that are received before the results of the previous
+	// rows, at most the rows of the window and the records in progress
+	results := batch.Stream(ctx, records)
+	received := make(map[int]formats.Result)
+
+	for pending := range rows {
+		result := formats.Result{ID: pending.row.record.ID, Err: pending.row.err}
+
+		if pending.index >= 0 {
+			var ok bool
+			for {
+				if result, ok = received[pending.index]; ok {
+					delete(received, pending.index)
+					break
+				}
+
+				r, open := <-results
+				if !open {
+					return fmt.Errorf("line %s: result is missing", pending.row.record.ID)
+				}
+				received[r.Index] = r
+			}
+		}
+
+		line, err := pending.row.rotated(result)
+		if err != nil {
+			return fmt.Errorf("line %s: %w", result.ID, err)
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+			return err
+		}
+
+		report(result)
+	}
+
+	return readErr
+}
+
+// status returns the status of a result written in the rotated file
+func status(result formats.Result) string {
+	if result.Err != nil {
+		return result.Err.Error()
+	}
+	return statusOK
+}
+
+// newRotationFormat returns the encrypted format of a rotation and the check
+// value of its key, which must start with kcv when it is given. The key of
+// ISO-4 is an AES key, its check value is computed with CMAC as ANSI
+// X9.24-1-2017 defines, the check value of the TDES keys of the other
+// formats encrypts zeros.
+func newRotationFormat(name, key, kbpk, kcv string) (formats.Format, string, error) {
+	aes := name == "ISO-4"
+
+	cipher, err := newCipher(key, kbpk, aes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	method := encryption.KCVZeros
+	if aes {
+		method = encryption.KCVCMAC
+	}
+
+	check := "unknown"
+	if c, ok := cipher.(interface {
+		KCV(method encryption.KCVMethod) string
+	}); ok {
+		check = c.KCV(method)
+	}
+
+	if kcv != "" {
+		if check == "unknown" {
+			return nil, "", fmt.Errorf("key check value of the key is unknown")
+		}
+		if err := encryption.CheckKCV(check, kcv); err != nil {
+			return nil, "", err
+		}
+	}
+
+	format, err := formats.NewFormatter(name, formats.WithCipher(cipher))
+	if err != nil {
+		return nil, "", fmt.Errorf("format %s: %w", name, err)
+	}
+
+	return format, check, nil
+}
+
+func openInput(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	return os.Open(name)
+}
+
+// writeOutput calls write with the file name, or stdout for -
+func writeOutput(name string, stdout io.Writer, write func(w io.Writer) error) error {
+	if name == "-" {
+		return write(stdout)
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// readCSV reads a CSV file with a header, the PIN blocks and the PANs are in
+// the pin_block and pan columns. The other columns are written unchanged with
+// a status column, which is added when the file does not have one. The rows
+// that fail keep their PIN block, the rows that are not valid CSV or do not
+// have the columns of the header fail and are written unchanged.
+func readCSV(r io.Reader) (*rotationFile, error) {
+	// raw has the text of the rows that are not read yet
+	var raw bytes.Buffer
+	reader := csv.NewReader(io.TeeReader(r, &raw))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	offset := reader.InputOffset()
+	raw.Next(int(offset))
+
+	pinBlockColumn, panColumn, statusColumn := -1, -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "pin_block":
+			pinBlockColumn = i
+		case "pan":
+			panColumn = i
+		case "status":
+			statusColumn = i
+		}
+	}
+	if pinBlockColumn < 0 || panColumn < 0 {
+		return nil, fmt.Errorf("pin_block and pan columns are required")
+	}
+	columns := len(header)
+	if statusColumn < 0 {
+		statusColumn = len(header)
+		header = append(header, "status")
+	}
+
+	headerLine, err := csvLine(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rotationFile{
+		header: headerLine,
+		next: func() (rotationRow, error) {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return rotationRow{}, io.EOF
+			}
+
+			// the text of the row is kept for the rows that are written
+			// unchanged
+			text := bytes.TrimRight(bytes.Clone(raw.Next(int(reader.InputOffset()-offset))), "\r\n")
+			offset = reader.InputOffset()
+			unchanged := func(formats.Result) ([]byte, error) {
+				return text, nil
+			}
+
+			var parseErr *csv.ParseError
+			switch {
+			case errors.As(err, &parseErr):
+				return rotationRow{
+					record:  formats.Record{ID: strconv.Itoa(parseErr.StartLine)},
+					err:     parseErr.Err,
+					rotated: unchanged,
+				}, nil
+			case err != nil:
+				return rotationRow{}, err
+			}
+
+			line, _ := reader.FieldPos(0)
+			if len(row) != columns {
+				return rotationRow{
+					record:  formats.Record{ID: strconv.Itoa(line)},
+					err:     fmt.Errorf("row has %d columns, the header has %d", len(row), columns),
+					rotated: unchanged,
+				}, nil
+			}
+
+			if statusColumn == len(row) {
+				row = append(row, "")
+			}
+
+			return rotationRow{
+				record: formats.Record{
+					ID:       strconv.Itoa(line),
+					PINBlock: row[pinBlockColumn],
+					Account:  row[panColumn],
+				},
+				rotated: func(result formats.Result) ([]byte, error) {
+					if result.Err == nil {
+						row[pinBlockColumn] = result.PINBlock
+					}
+					row[statusColumn] = status(result)
+
+					return csvLine(row)
+				},
+			}, nil
+		},
+	}, nil
+}
+
+// csvLine returns the CSV text of fields, without line break
+func csvLine(fields []string) ([]byte, error) {
+	var line bytes.Buffer
+
+	writer := csv.NewWriter(&line)
+	if err := writer.Write(fields); err != nil {
+		return nil, err
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(line.Bytes(), []byte("\n")), nil
+}
+
+// readJSONL reads a file of JSON objects, one per line, with the PIN block and
+// the PAN in the pin_block and pan fields. The other fields are written
+// unchanged with a status field, the objects that fail keep their PIN block.
+// The lines that are not valid fail like the PIN blocks, the lines that are
+// not JSON objects are written unchanged.
+func readJSONL(r io.Reader) (*rotationFile, error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	return &rotationFile{
+		next: func() (rotationRow, error) {
+			for scanner.Scan() {
+				line++
+				if strings.TrimSpace(scanner.Text()) == "" {
+					continue
+				}
+
+				text := bytes.Clone(scanner.Bytes())
+				record := formats.Record{ID: strconv.Itoa(line)}
+
+				var object map[string]json.RawMessage
+				err := json.Unmarshal(text, &object)
+				if err == nil {
+					err = readJSONField(object, "pin_block", &record.PINBlock)
+				}
+				if err == nil {
+					err = readJSONField(object, "pan", &record.Account)
+				}
+
+				return rotationRow{
+					record: record,
+					err:    err,
+					rotated: func(result formats.Result) ([]byte, error) {
+						return rotatedJSONLine(text, object, result)
+					},
+				}, nil
+			}
+			if err := scanner.Err(); err != nil {
+				return rotationRow{}, err
+			}
+
+			return rotationRow{}, io.EOF
+		},
+	}, nil
+}
+
+// rotatedJSONLine returns the line of an object with the PIN block and the
+// status of its result, or the line unchanged when it is not an object
+func rotatedJSONLine(line []byte, object map[string]json.RawMessage, result formats.Result) ([]byte, error) {
+	if object == nil {
+		return line, nil
+	}
+
+	if result.Err == nil {
+		pinBlock, err := json.Marshal(result.PINBlock)
+		if err != nil {
+			return nil, err
+		}
+		object["pin_block"] = pinBlock
+	}
+
+	rotationStatus, err := json.Marshal(status(result))
+	if err != nil {
+		return nil, err
+	}
+	object["status"] = rotationStatus
+
+	return json.Marshal(object)
+}
+
+func readJSONField(object map[string]json.RawMessage, name string, value *string) error {
+	raw, ok := object[name]
+	if !ok {
+		return fmt.Errorf("%s is required", name)
+	}
+
+	if err := json.Unmarshal(raw, value); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
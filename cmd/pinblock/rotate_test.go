@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+const newZPK = "F039121BEC83D26B169BDCD5B22AAF8F"
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("CSV", func(t *testing.T) {
+		in := filepath.Join(dir, "pinblocks.csv")
+		out := filepath.Join(dir, "rotated.csv")
+
+		err := os.WriteFile(in, []byte("id,pan,pin_block\n"+
+			"card-1,"+account+",BA2ADC4EBA48F711\n"+
+			"card-2,"+account+",BA2ADC4EBA48F7\n"), 0o600)
+		require.NoError(t, err)
+
+		_, report, err := runCommand(t, "rotate", "-from-key", zpk, "-from-kcv", "08D7B4", "-to-key", newZPK,
+			"-in", in, "-out", out)
+		require.EqualError(t, err, "1 of 2 pin blocks failed")
+		require.Contains(t, report, "line 3: decoding pin block: pin block must be 16 characters")
+		require.Contains(t, report, "from: ISO-0, key check value 08D7B4")
+		require.Contains(t, report, "rotated 1 pin blocks, 1 failed")
+
+		rotated, err := os.ReadFile(out)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(rotated)), "\n")
+		require.Len(t, lines, 3)
+		require.Equal(t, "id,pan,pin_block,status", lines[0])
+
+		fields := strings.Split(lines[1], ",")
+		require.Equal(t, []string{"card-1", account}, fields[:2])
+		require.Equal(t, "ok", fields[3])
+
+		pin, _, err := runCommand(t, "decode", "-pan", account, "-block", fields[2], "-key", newZPK)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		// the failed record is written unchanged with its error
+		require.Equal(t, "card-2,"+account+",BA2ADC4EBA48F7,decoding pin block: pin block must be 16 characters", lines[2])
+
+		// the status column of a rotated file is replaced
+		again := filepath.Join(dir, "rotated-again.csv")
+		_, _, err = runCommand(t, "rotate", "-from-key", newZPK, "-to-key", zpk, "-in", out, "-out", again)
+		require.EqualError(t, err, "1 of 2 pin blocks failed")
+
+		rotated, err = os.ReadFile(again)
+		require.NoError(t, err)
+		require.Equal(t, "id,pan,pin_block,status\n"+
+			"card-1,"+account+",BA2ADC4EBA48F711,ok\n"+
+			"card-2,"+account+",BA2ADC4EBA48F7,decoding pin block: pin block must be 16 characters\n", string(rotated))
+	})
+
+	t.Run("malformed CSV rows", func(t *testing.T) {
+		in := filepath.Join(dir, "malformed.csv")
+		err := os.WriteFile(in, []byte("id,pan,pin_block\n"+
+			"card-1,"+account+",BA2ADC4EBA48F711\n"+
+			"card-2,"+account+"\n"+
+			"card-3,\"4321\"0,BA2ADC4EBA48F711\n"+
+			"card-4,"+account+",BA2ADC4EBA48F711\n"), 0o600)
+		require.NoError(t, err)
+
+		out, report, err := runCommand(t, "rotate", "-from-key", zpk, "-to-key", zpk, "-in", in)
+		require.EqualError(t, err, "2 of 4 pin blocks failed")
+		require.Contains(t, report, "line 3: row has 2 columns, the header has 3")
+		require.Contains(t, report, "line 4: extraneous or missing \" in quoted-field")
+
+		// the rows that can not be read are written unchanged
+		require.Equal(t, "id,pan,pin_block,status\n"+
+			"card-1,"+account+",BA2ADC4EBA48F711,ok\n"+
+			"card-2,"+account+"\n"+
+			"card-3,\"4321\"0,BA2ADC4EBA48F711\n"+
+			"card-4,"+account+",BA2ADC4EBA48F711,ok", out)
+	})
+
+	t.Run("JSONL to ISO-4", func(t *testing.T) {
+		in := filepath.Join(dir, "pinblocks.jsonl")
+		err := os.WriteFile(in, []byte(`{"pan":"`+account+`","pin_block":"BA2ADC4EBA48F711","card":1}`+"\n"+
+			"\n"+
+			`{"pin_block":"BA2ADC4EBA48F711"}`+"\n"+
+			"[1234]\n"), 0o600)
+		require.NoError(t, err)
+
+		// the check value of an AES key is computed with CMAC
+		out, report, err := runCommand(t, "rotate", "-from-key", zpk, "-to", "ISO-4", "-to-key", newZPK, "-to-kcv", "2A54457C8E", "-in", in)
+		require.EqualError(t, err, "2 of 3 pin blocks failed")
+		require.Contains(t, report, "to: ISO-4, key check value 2A54457C8E")
+		require.Contains(t, report, "line 3: pan is required")
+		require.Contains(t, report, "line 4: json: cannot unmarshal array")
+
+		// the invalid lines are written with their PIN blocks, or unchanged
+		lines := strings.Split(out, "\n")
+		require.Len(t, lines, 3)
+		require.Regexp(t, `^\{"card":1,"pan":"`+account+`","pin_block":"[0-9A-F]{32}","status":"ok"\}$`, lines[0])
+		require.Equal(t, `{"pin_block":"BA2ADC4EBA48F711","status":"pan is required"}`, lines[1])
+		require.Equal(t, "[1234]", lines[2])
+
+		block := lines[0][strings.Index(lines[0], `"pin_block":"`)+13:][:32]
+		pin, _, err := runCommand(t, "decode", "-format", "ISO-4", "-pan", account, "-block", block, "-key", newZPK)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("invalid records", func(t *testing.T) {
+		var decoded []string
+		from, err := formats.NewFormatter("ISO-0", formats.WithTracer(formats.TracerFunc(func(event formats.TraceEvent) {
+			if event.Step == formats.StepDecode {
+				decoded = append(decoded, event.Format)
+			}
+		})))
+		require.NoError(t, err)
+
+		file, err := readCSV(strings.NewReader("pan,pin_block\n" +
+			account + "\n" +
+			account + ",041215FEDCBA9876\n"))
+		require.NoError(t, err)
+
+		// the invalid records are not translated
+		var results []formats.Result
+		var out strings.Builder
+		err = rotateFile(formats.NewTranslateBatch(from, formats.NewISO1(), formats.WithWorkers(1)), file, &out, func(result formats.Result) {
+			results = append(results, result)
+		})
+		require.NoError(t, err)
+		require.Len(t, decoded, 1)
+
+		require.Len(t, results, 2)
+		require.Equal(t, formats.Result{ID: "2", Err: errors.New("row has 1 columns, the header has 2")}, results[0])
+		require.NoError(t, results[1].Err)
+		require.Equal(t, "3", results[1].ID)
+	})
+
+	t.Run("order of the rows", func(t *testing.T) {
+		in := strings.Builder{}
+		in.WriteString("pan,pin_block\n")
+		for i := 0; i < 3*rotationWindow; i++ {
+			in.WriteString(account + ",BA2ADC4EBA48F711\n")
+		}
+
+		file, err := readCSV(strings.NewReader(in.String()))
+		require.NoError(t, err)
+
+		from, _, err := newRotationFormat("ISO-0", zpk, "", "")
+		require.NoError(t, err)
+
+		to, _, err := newRotationFormat("ISO-0", newZPK, "", "")
+		require.NoError(t, err)
+
+		// the results of the workers are out of order, the rows are not
+		var ids []string
+		var out strings.Builder
+		err = rotateFile(formats.NewTranslateBatch(from, to, formats.WithWorkers(8)), file, &out, func(result formats.Result) {
+			require.NoError(t, result.Err)
+			ids = append(ids, result.ID)
+		})
+		require.NoError(t, err)
+
+		require.Len(t, ids, 3*rotationWindow)
+		for i, id := range ids {
+			require.Equal(t, strconv.Itoa(i+2), id)
+		}
+		require.Equal(t, 3*rotationWindow+1, strings.Count(out.String(), "\n"))
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		file, err := readJSONL(io.MultiReader(strings.NewReader(`{"pan":"`+account+`","pin_block":"BA2ADC4EBA48F711"}`+"\n"), iotest.ErrReader(errors.New("disk error"))))
+		require.NoError(t, err)
+
+		var rows int
+		err = rotateFile(formats.NewTranslateBatch(formats.NewISO0(), formats.NewISO0()), file, io.Discard, func(formats.Result) {
+			rows++
+		})
+		require.EqualError(t, err, "disk error")
+		require.Equal(t, 1, rows)
+	})
+
+	t.Run("invalid flags", func(t *testing.T) {
+		_, _, err := runCommand(t, "rotate", "-from-key", zpk)
+		require.EqualError(t, err, "from-key and to-key are required")
+
+		_, _, err = runCommand(t, "rotate", "-from-key", zpk, "-from-kcv", "1234", "-to-key", newZPK)
+		require.EqualError(t, err, "from: key check value 08D7 does not match expected 1234")
+
+		_, _, err = runCommand(t, "rotate", "-from-key", zpk, "-from-kcv", "08", "-to-key", newZPK)
+		require.EqualError(t, err, "from: key check value must be between 4 and 6 hex characters")
+
+		_, _, err = runCommand(t, "rotate", "-from-key", zpk, "-to-key", newZPK, "-in", "pinblocks.xml")
+		require.EqualError(t, err, "unsupported file type xml")
+
+		in := filepath.Join(dir, "columns.csv")
+		require.NoError(t, os.WriteFile(in, []byte("pan,block\n"), 0o600))
+
+		_, _, err = runCommand(t, "rotate", "-from-key", zpk, "-to-key", newZPK, "-in", in)
+		require.EqualError(t, err, "reading "+in+": pin_block and pan columns are required")
+	})
+}
@@ -0,0 +1,167 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+)
+
+// AES DUKPT (ANSI X9.24-3-2017)
+//
+//	The key serial number (KSN) is 12 bytes long: an 8 byte initial key ID,
+//	which is the BDK ID followed by the derivation ID of the device, and a
+//	4 byte transaction counter.
+//	The initial key of the device is derived from the BDK and the initial key ID.
+//	Intermediate derivation keys are derived for every bit set in the counter,
+//	from the most significant one, and the working key of the transaction is
+//	derived from the last one.
+
+const (
+	aesKSNLength          = 12
+	aesInitialKeyIDLength = 8
+)
+
+// key usage indicators of the derivation data
+const (
+	keyUsagePINEncryption uint16 = 0x1000
+	keyUsageKeyDerivation uint16 = 0x8000
+	keyUsageInitialKey    uint16 = 0x8001
+)
+
+// NewAesDukpt returns an AES cipher with the PIN encryption key of the
+// transaction identified by ksn. keyLength is the length of the PIN encryption
+// key in bytes (16, 24 or 32) and must not exceed the length of the BDK.
+// The cipher is used with ISO-4 PIN blocks:
+//
+//	cipher, err := encryption.NewAesDukpt(bdk, ksn, 16)
+//	iso4 := formats.NewISO4(cipher)
+//	pin, err := iso4.Decode(pinBlock, account)
+func NewAesDukpt(bdk, ksn []byte, keyLength int) (*AesECB, error) {
+	if len(ksn) != aesKSNLength {
+		return nil, fmt.Errorf("ksn length must be 12 bytes")
+	}
+
+	initialKey, err := DeriveAesInitialKey(bdk, ksn[:aesInitialKeyIDLength])
+	if err != nil {
+		return nil, err
+	}
+
+	pinKey, err := DeriveAesPINKey(initialKey, ksn, keyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAesECB(pinKey)
+}
+
+// DeriveAesInitialKey returns the initial key of the device identified by the
+// 8 byte initial key ID. The initial key has the same length as the BDK.
+func DeriveAesInitialKey(bdk, initialKeyID []byte) ([]byte, error) {
+	if err := checkAesKeyLength(len(bdk)); err != nil {
+		return nil, fmt.Errorf("bdk %w", err)
+	}
+
+	if len(initialKeyID) != aesInitialKeyIDLength {
+		return nil, fmt.Errorf("initial key ID length must be 8 bytes")
+	}
+
+	data := aesDerivationData(keyUsageInitialKey, len(bdk))
+	copy(data[8:], initialKeyID)
+
+	return aesDeriveKey(bdk, data, len(bdk))
+}
+
+// DeriveAesPINKey returns the PIN encryption key of keyLength bytes for the
+// transaction identified by ksn from the initial key of the device.
+func DeriveAesPINKey(initialKey, ksn []byte, keyLength int) ([]byte, error) {
+	if err := checkAesKeyLength(len(initialKey)); err != nil {
+		return nil, fmt.Errorf("initial key %w", err)
+	}
+
+	if err := checkAesKeyLength(keyLength); err != nil {
+		return nil, fmt.Errorf("pin key %w", err)
+	}
+
+	if keyLength > len(initialKey) {
+		return nil, fmt.Errorf("pin key length must not exceed initial key length")
+	}
+
+	if len(ksn) != aesKSNLength {
+		return nil, fmt.Errorf("ksn length must be 12 bytes")
+	}
+
+	// the derivation ID is the rightmost 4 bytes of the initial key ID
+	derivationID := ksn[4:aesInitialKeyIDLength]
+	counter := binary.BigEndian.Uint32(ksn[aesInitialKeyIDLength:])
+
+	key := initialKey
+	var workingCounter uint32
+	for mask := uint32(1 << 31); mask > 0; mask >>= 1 {
+		if counter&mask == 0 {
+			continue
+		}
+
+		workingCounter |= mask
+
+		data := aesDerivationData(keyUsageKeyDerivation, len(initialKey))
+		copy(data[8:], derivationID)
+		binary.BigEndian.PutUint32(data[12:], workingCounter)
+
+		var err error
+		key, err = aesDeriveKey(key, data, len(initialKey))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := aesDerivationData(keyUsagePINEncryption, keyLength)
+	copy(data[8:], derivationID)
+	binary.BigEndian.PutUint32(data[12:], counter)
+
+	return aesDeriveKey(key, data, keyLength)
+}
+
+// aesDerivationData returns the derivation data for a key of keyLength bytes
+// with the rightmost 8 bytes left empty
+func aesDerivationData(keyUsage uint16, keyLength int) []byte {
+	data := make([]byte, aes.BlockSize)
+	data[0] = 0x01 // version
+	data[1] = 0x01 // key block counter, set while deriving
+	binary.BigEndian.PutUint16(data[2:], keyUsage)
+
+	// algorithm indicator: 2 for AES-128, 3 for AES-192 and 4 for AES-256
+	binary.BigEndian.PutUint16(data[4:], uint16(keyLength/8))
+	binary.BigEndian.PutUint16(data[6:], uint16(keyLength*8))
+
+	return data
+}
+
+// aesDeriveKey encrypts the derivation data with a block counter until
+// keyLength bytes are produced
+func aesDeriveKey(derivationKey, data []byte, keyLength int) ([]byte, error) {
+	block, err := aes.NewCipher(derivationKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	key := make([]byte, 0, 2*aes.BlockSize)
+	for i := 1; len(key) < keyLength; i++ {
+		data[1] = byte(i)
+
+		derived := make([]byte, aes.BlockSize)
+		block.Encrypt(derived, data)
+
+		key = append(key, derived...)
+	}
+
+	return key[:keyLength], nil
+}
+
+func checkAesKeyLength(length int) error {
+	switch length {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("length must be 16, 24 or 32 bytes")
+	}
+}
@@ -0,0 +1,167 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAesDukpt(t *testing.T) {
+	// test vectors of ANSI X9.24-3-2017 Annex B
+	bdk, err := hex.DecodeString("FEDCBA9876543210F1F1F1F1F1F1F1F1")
+	require.NoError(t, err)
+
+	ksn, err := hex.DecodeString("123456789012345600000001")
+	require.NoError(t, err)
+
+	t.Run("DeriveAesInitialKey", func(t *testing.T) {
+		initialKey, err := DeriveAesInitialKey(bdk, ksn[:8])
+		require.NoError(t, err)
+		require.Equal(t, "1273671EA26AC29AFA4D1084127652A1", fmt.Sprintf("%X", initialKey))
+	})
+
+	t.Run("DeriveAesPINKey", func(t *testing.T) {
+		initialKey, err := DeriveAesInitialKey(bdk, ksn[:8])
+		require.NoError(t, err)
+
+		pinKey, err := DeriveAesPINKey(initialKey, ksn, 16)
+		require.NoError(t, err)
+		require.Equal(t, "AF8CB133A78F8DC2D1359F18527593FB", fmt.Sprintf("%X", pinKey))
+	})
+
+	t.Run("AES-192 and AES-256", func(t *testing.T) {
+		// the derivation data of X9.24-3 encrypted with openssl, the same
+		// computation gives the AES-128 keys above
+		tests := []struct {
+			bdk        string
+			ksn        string
+			keyLength  int
+			initialKey string
+			pinKey     string
+		}{
+			{
+				bdk:        "FEDCBA9876543210F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1",
+				ksn:        "123456789012345600000001",
+				keyLength:  16,
+				initialKey: "83C9FDE8CBF6006CE4D74F73DA8953F07823279B7FEBA5BD",
+				pinKey:     "852942B19D9CEE1DFB0D315A00631A00",
+			},
+			{
+				bdk:        "FEDCBA9876543210F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1",
+				ksn:        "123456789012345600000001",
+				keyLength:  24,
+				initialKey: "83C9FDE8CBF6006CE4D74F73DA8953F07823279B7FEBA5BD",
+				pinKey:     "2C8A93B766EF9527F3A4C4511BD39FA033A71312C2A2D5F5",
+			},
+			{
+				bdk:        "FEDCBA9876543210F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1",
+				ksn:        "1234567890123456000000FF",
+				keyLength:  24,
+				initialKey: "83C9FDE8CBF6006CE4D74F73DA8953F07823279B7FEBA5BD",
+				pinKey:     "2BFCB98294D35CE7C0528DBF7DF5423BCBF5F3F34FC23579",
+			},
+			{
+				bdk:        "FEDCBA9876543210F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1",
+				ksn:        "123456789012345600000001",
+				keyLength:  16,
+				initialKey: "EBE404301102BC7B314DD0C33ED2736E1FFBFE595EE1B53A7A834182AE9919BA",
+				pinKey:     "7FD343E9074B95DA238169DF365EE48C",
+			},
+			{
+				bdk:        "FEDCBA9876543210F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1",
+				ksn:        "123456789012345600000001",
+				keyLength:  24,
+				initialKey: "EBE404301102BC7B314DD0C33ED2736E1FFBFE595EE1B53A7A834182AE9919BA",
+				pinKey:     "DF03C836C9E29B5D3E8C79392C27BEBA99FEE6912423681A",
+			},
+			{
+				bdk:        "FEDCBA9876543210F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1",
+				ksn:        "123456789012345600000001",
+				keyLength:  32,
+				initialKey: "EBE404301102BC7B314DD0C33ED2736E1FFBFE595EE1B53A7A834182AE9919BA",
+				pinKey:     "DF2328FFEAE59BB3A2F5F0C8D2CEC8367132D8C2D8D12F07C43520F87016FCF1",
+			},
+			{
+				bdk:        "FEDCBA9876543210F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1F1",
+				ksn:        "1234567890123456000000FF",
+				keyLength:  32,
+				initialKey: "EBE404301102BC7B314DD0C33ED2736E1FFBFE595EE1B53A7A834182AE9919BA",
+				pinKey:     "27CF892ACA49660BA862FB1DAA71740A7541AF17BE235EE026D7136490A7B6DE",
+			},
+		}
+
+		for _, tt := range tests {
+			name := fmt.Sprintf("BDK %d, PIN key %d, KSN %s", len(tt.bdk)/2, tt.keyLength, tt.ksn)
+			t.Run(name, func(t *testing.T) {
+				bdk, err := hex.DecodeString(tt.bdk)
+				require.NoError(t, err)
+
+				ksn, err := hex.DecodeString(tt.ksn)
+				require.NoError(t, err)
+
+				initialKey, err := DeriveAesInitialKey(bdk, ksn[:8])
+				require.NoError(t, err)
+				require.Equal(t, tt.initialKey, fmt.Sprintf("%X", initialKey))
+
+				pinKey, err := DeriveAesPINKey(initialKey, ksn, tt.keyLength)
+				require.NoError(t, err)
+				require.Equal(t, tt.pinKey, fmt.Sprintf("%X", pinKey))
+
+				cipher, err := NewAesDukpt(bdk, ksn, tt.keyLength)
+				require.NoError(t, err)
+
+				rawPINKey, err := hex.DecodeString(tt.pinKey)
+				require.NoError(t, err)
+
+				expected, err := NewAesECB(rawPINKey)
+				require.NoError(t, err)
+
+				plainText := []byte("1234567890123456")
+				cipherText, err := cipher.Encrypt(plainText)
+				require.NoError(t, err)
+
+				expectedText, err := expected.Encrypt(plainText)
+				require.NoError(t, err)
+				require.Equal(t, expectedText, cipherText)
+			})
+		}
+	})
+
+	t.Run("keys differ per transaction", func(t *testing.T) {
+		initialKey, err := DeriveAesInitialKey(bdk, ksn[:8])
+		require.NoError(t, err)
+
+		next, err := hex.DecodeString("123456789012345600000002")
+		require.NoError(t, err)
+
+		first, err := DeriveAesPINKey(initialKey, ksn, 16)
+		require.NoError(t, err)
+
+		second, err := DeriveAesPINKey(initialKey, next, 16)
+		require.NoError(t, err)
+
+		require.NotEqual(t, first, second)
+	})
+
+	t.Run("wrong lengths", func(t *testing.T) {
+		_, err := DeriveAesInitialKey(bdk[:8], ksn[:8])
+		require.EqualError(t, err, "bdk length must be 16, 24 or 32 bytes")
+
+		_, err = DeriveAesInitialKey(bdk, ksn[:4])
+		require.EqualError(t, err, "initial key ID length must be 8 bytes")
+
+		_, err = DeriveAesPINKey(bdk, ksn[:10], 16)
+		require.EqualError(t, err, "ksn length must be 12 bytes")
+
+		_, err = DeriveAesPINKey(bdk, ksn, 20)
+		require.EqualError(t, err, "pin key length must be 16, 24 or 32 bytes")
+
+		_, err = DeriveAesPINKey(bdk, ksn, 32)
+		require.EqualError(t, err, "pin key length must not exceed initial key length")
+
+		_, err = NewAesDukpt(bdk, ksn[:10], 16)
+		require.EqualError(t, err, "ksn length must be 12 bytes")
+	})
+}
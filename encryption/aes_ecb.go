@@ -10,37 +10,71 @@ type AesECB struct {
 	cipherBlock cipher.Block
 }
 
-func NewAesECB(key []byte) (*AesECB, error) {
+// NewAesECB returns an AES cipher for a 16, 24 or 32 bytes key. WithKCV and
+// WithCMACKCV can be passed to refuse a key with an unexpected check value.
+func NewAesECB(key []byte, opts ...Option) (*AesECB, error) {
 	cipher, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("creating cipher: %w", err)
 	}
 
+	if err := newOptions(opts).verifyKCV(cipher); err != nil {
+		return nil, err
+	}
+
 	return &AesECB{
 		cipherBlock: cipher,
 	}, nil
 }
 
 func (a *AesECB) Encrypt(plainText []byte) ([]byte, error) {
+	cipherText := make([]byte, len(plainText))
+
+	if err := a.EncryptTo(cipherText, plainText); err != nil {
+		return nil, err
+	}
+
+	return cipherText, nil
+}
+
+// EncryptTo encrypts plainText into dst, which must be at least as long.
+// Unlike Encrypt, it does not allocate.
+func (a *AesECB) EncryptTo(dst, plainText []byte) error {
 	if len(plainText) != 16 {
-		return nil, fmt.Errorf("plain text length must be 16 bytes")
+		return fmt.Errorf("plain text length must be 16 bytes")
 	}
 
-	cipherText := make([]byte, len(plainText))
+	if len(dst) < len(plainText) {
+		return fmt.Errorf("destination length must be at least 16 bytes")
+	}
 
-	a.cipherBlock.Encrypt(cipherText, plainText)
+	a.cipherBlock.Encrypt(dst, plainText)
 
-	return cipherText, nil
+	return nil
 }
 
 func (a *AesECB) Decrypt(cipherText []byte) ([]byte, error) {
+	plainText := make([]byte, len(cipherText))
+
+	if err := a.DecryptTo(plainText, cipherText); err != nil {
+		return nil, err
+	}
+
+	return plainText, nil
+}
+
+// DecryptTo decrypts cipherText into dst, which must be at least as long.
+// Unlike Decrypt, it does not allocate.
+func (a *AesECB) DecryptTo(dst, cipherText []byte) error {
 	if len(cipherText) != 16 {
-		return nil, fmt.Errorf("cipher text length must be 16 bytes")
+		return fmt.Errorf("cipher text length must be 16 bytes")
 	}
 
-	plainText := make([]byte, len(cipherText))
+	if len(dst) < len(cipherText) {
+		return fmt.Errorf("destination length must be at least 16 bytes")
+	}
 
-	a.cipherBlock.Decrypt(plainText, cipherText)
+	a.cipherBlock.Decrypt(dst, cipherText)
 
-	return plainText, nil
+	return nil
 }
@@ -28,6 +28,19 @@ func TestAesECB(t *testing.T) {
 		require.Equal(t, "1234567890123456", string(plainText))
 	})
 
+	t.Run("EncryptTo/DecryptTo", func(t *testing.T) {
+		cipher, err := NewAesECB(key)
+		require.NoError(t, err)
+
+		var cipherText, plainText [16]byte
+		require.NoError(t, cipher.EncryptTo(cipherText[:], []byte("1234567890123456")))
+		require.NoError(t, cipher.DecryptTo(plainText[:], cipherText[:]))
+		require.Equal(t, "1234567890123456", string(plainText[:]))
+
+		require.EqualError(t, cipher.EncryptTo(cipherText[:8], []byte("1234567890123456")), "destination length must be at least 16 bytes")
+		require.EqualError(t, cipher.DecryptTo(plainText[:], cipherText[:8]), "cipher text length must be 16 bytes")
+	})
+
 	t.Run("Encrypt/Decrypt with wrong value", func(t *testing.T) {
 		cipher, err := NewAesECB(key)
 		require.NoError(t, err)
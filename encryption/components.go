@@ -0,0 +1,115 @@
+package encryption
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+)
+
+// KeyComponent is a clear component of a key, as held by a key custodian,
+// with its check value. The check value is optional.
+type KeyComponent struct {
+	Key []byte
+	KCV string
+}
+
+// CombineTdesComponents XORs two or three clear TDES key components into a key
+// and returns the key with its check value. Every component must have odd
+// parity and match its check value. The parity of the combined key is
+// adjusted to odd.
+func CombineTdesComponents(method KCVMethod, components ...KeyComponent) ([]byte, string, error) {
+	for i, component := range components {
+		if !hasOddParity(component.Key) {
+			return nil, "", fmt.Errorf("component %d does not have odd parity", i+1)
+		}
+	}
+
+	key, err := combineComponents(components, func(key []byte) (string, error) {
+		return TdesKCV(key, method)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	setOddParity(key)
+
+	kcv, err := TdesKCV(key, method)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, kcv, nil
+}
+
+// CombineAesComponents XORs two or three clear AES key components into a key
+// and returns the key with its check value. Every component must match its
+// check value.
+func CombineAesComponents(method KCVMethod, components ...KeyComponent) ([]byte, string, error) {
+	key, err := combineComponents(components, func(key []byte) (string, error) {
+		return AesKCV(key, method)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	kcv, err := AesKCV(key, method)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, kcv, nil
+}
+
+func combineComponents(components []KeyComponent, kcv func(key []byte) (string, error)) ([]byte, error) {
+	if len(components) < 2 || len(components) > 3 {
+		return nil, fmt.Errorf("key must have 2 or 3 components")
+	}
+
+	key := make([]byte, len(components[0].Key))
+	for i, component := range components {
+		if len(component.Key) != len(key) {
+			return nil, fmt.Errorf("component %d length must be %d bytes", i+1, len(key))
+		}
+
+		for j := range components[:i] {
+			if bytes.Equal(components[j].Key, component.Key) {
+				return nil, fmt.Errorf("component %d is the same as component %d", i+1, j+1)
+			}
+		}
+
+		actual, err := kcv(component.Key)
+		if err != nil {
+			return nil, fmt.Errorf("component %d: %w", i+1, err)
+		}
+
+		if component.KCV != "" {
+			if err := CheckKCV(actual, component.KCV); err != nil {
+				return nil, fmt.Errorf("component %d: %w", i+1, err)
+			}
+		}
+
+		for j := range key {
+			key[j] ^= component.Key[j]
+		}
+	}
+
+	return key, nil
+}
+
+func hasOddParity(key []byte) bool {
+	for _, b := range key {
+		if bits.OnesCount8(b)%2 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// setOddParity flips the least significant bit of every byte with even parity
+func setOddParity(key []byte) {
+	for i, b := range key {
+		if bits.OnesCount8(b)%2 == 0 {
+			key[i] = b ^ 0x01
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCombineTdesComponents(t *testing.T) {
+	first, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	require.NoError(t, err)
+
+	second, err := hex.DecodeString("1F1F1F1F0E0E0E0E1F1F1F1F0E0E0E0E")
+	require.NoError(t, err)
+
+	third, err := hex.DecodeString("D5D5D5D5D5D5D5D5DADADADADADADADA")
+	require.NoError(t, err)
+
+	t.Run("two components", func(t *testing.T) {
+		key, kcv, err := CombineTdesComponents(KCVZeros,
+			KeyComponent{Key: first, KCV: "08D7B4"},
+			KeyComponent{Key: second, KCV: "94AEA8"},
+		)
+		require.NoError(t, err)
+
+		// the parity of the XOR of two components is adjusted
+		require.Equal(t, "1F3D5B7986A4C2E0E0C2A486795B3D1F", fmt.Sprintf("%X", key))
+		require.Equal(t, "42F834", kcv)
+	})
+
+	t.Run("three components", func(t *testing.T) {
+		key, kcv, err := CombineTdesComponents(KCVZeros,
+			KeyComponent{Key: first, KCV: "08D7B4"},
+			KeyComponent{Key: second, KCV: "94AEA8"},
+			KeyComponent{Key: third, KCV: "652549"},
+		)
+		require.NoError(t, err)
+		require.Equal(t, "CBE98FAD527016343B197F5DA280E6C4", fmt.Sprintf("%X", key))
+		require.Equal(t, "703509", kcv)
+	})
+
+	t.Run("check values are optional", func(t *testing.T) {
+		_, kcv, err := CombineTdesComponents(KCVZeros, KeyComponent{Key: first}, KeyComponent{Key: second})
+		require.NoError(t, err)
+		require.Equal(t, "42F834", kcv)
+	})
+
+	t.Run("wrong check value", func(t *testing.T) {
+		_, _, err := CombineTdesComponents(KCVZeros,
+			KeyComponent{Key: first, KCV: "08D7B4"},
+			KeyComponent{Key: second, KCV: "94AEA9"},
+		)
+		require.EqualError(t, err, "component 2: key check value 94AEA8 does not match expected 94AEA9")
+	})
+
+	t.Run("wrong parity", func(t *testing.T) {
+		even := append([]byte(nil), second...)
+		even[3] ^= 0x01
+
+		_, _, err := CombineTdesComponents(KCVZeros, KeyComponent{Key: first}, KeyComponent{Key: even})
+		require.EqualError(t, err, "component 2 does not have odd parity")
+	})
+
+	t.Run("wrong number of components", func(t *testing.T) {
+		_, _, err := CombineTdesComponents(KCVZeros, KeyComponent{Key: first})
+		require.EqualError(t, err, "key must have 2 or 3 components")
+
+		_, _, err = CombineTdesComponents(KCVZeros,
+			KeyComponent{Key: first}, KeyComponent{Key: second}, KeyComponent{Key: third}, KeyComponent{Key: first},
+		)
+		require.EqualError(t, err, "key must have 2 or 3 components")
+	})
+
+	t.Run("wrong component", func(t *testing.T) {
+		_, _, err := CombineTdesComponents(KCVZeros, KeyComponent{Key: first}, KeyComponent{Key: first})
+		require.EqualError(t, err, "component 2 is the same as component 1")
+
+		_, _, err = CombineTdesComponents(KCVZeros, KeyComponent{Key: first}, KeyComponent{Key: third[:8]})
+		require.EqualError(t, err, "component 2 length must be 16 bytes")
+
+		_, _, err = CombineTdesComponents(KCVZeros, KeyComponent{Key: first[:8]}, KeyComponent{Key: third[:8]})
+		require.EqualError(t, err, "component 1: key length must be 16 or 24 bytes")
+	})
+}
+
+func TestCombineAesComponents(t *testing.T) {
+	first, err := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+	require.NoError(t, err)
+
+	second, err := hex.DecodeString("FFEEDDCCBBAA99887766554433221100")
+	require.NoError(t, err)
+
+	key, kcv, err := CombineAesComponents(KCVZeros,
+		KeyComponent{Key: first, KCV: "FDE4FB"},
+		KeyComponent{Key: second, KCV: "EBC958"},
+	)
+	require.NoError(t, err)
+
+	// AES keys have no parity
+	require.Equal(t, "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", fmt.Sprintf("%X", key))
+	require.Equal(t, "A1F625", kcv)
+
+	_, _, err = CombineAesComponents(KCVZeros,
+		KeyComponent{Key: first, KCV: "FDE4FB"},
+		KeyComponent{Key: second, KCV: "FDE4FB"},
+	)
+	require.EqualError(t, err, "component 2: key check value EBC958 does not match expected FDE4FB")
+
+	_, _, err = CombineAesComponents(KCVZeros, KeyComponent{Key: first[:10]}, KeyComponent{Key: second[:10]})
+	require.ErrorContains(t, err, "component 1: creating cipher")
+}
@@ -0,0 +1,206 @@
+package encryption
+
+import (
+	"crypto/des"
+	"fmt"
+)
+
+// TDES DUKPT (ANSI X9.24-1:2009)
+//
+//	The key serial number (KSN) is 10 bytes long. Its rightmost 21 bits are the
+//	transaction counter, the remaining bits identify the BDK and the device.
+//	The initial PIN encryption key (IPEK) is derived from the BDK and the KSN with
+//	its counter set to zero. The key of a transaction is derived from the IPEK by
+//	running the non-reversible key generation process for every bit set in the
+//	counter, from the most significant one.
+
+const (
+	ksnLength       = 10
+	ksnCounterBits  = 21
+	ksnCounterMask  = 1<<ksnCounterBits - 1
+	dukptKeyLength  = 16
+	dukptHalfLength = 8
+)
+
+var (
+	// keyMask is XOR-ed into a key to derive the right half of the IPEK and
+	// the left half of a future key
+	keyMask = []byte{
+		0xC0, 0xC0, 0xC0, 0xC0, 0x00, 0x00, 0x00, 0x00,
+		0xC0, 0xC0, 0xC0, 0xC0, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	// pinVariant is XOR-ed into a transaction key to get the PIN encryption key
+	pinVariant = []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF,
+	}
+)
+
+// NewDukpt returns a TDES cipher with the PIN encryption key of the
+// transaction identified by ksn. It is used on the host side, where the base
+// derivation key (BDK) is known, to decrypt PIN blocks sent by a PIN pad:
+//
+//	cipher, err := encryption.NewDukpt(bdk, ksn)
+//	iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+//	pin, err := iso0.Decode(pinBlock, account)
+func NewDukpt(bdk, ksn []byte) (*TdesECB, error) {
+	ipek, err := DeriveIPEK(bdk, ksn)
+	if err != nil {
+		return nil, err
+	}
+
+	pinKey, err := DerivePINKey(ipek, ksn)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTdesECB(pinKey)
+}
+
+// DeriveIPEK returns the initial PIN encryption key of the device identified by
+// ksn. The transaction counter of ksn is ignored.
+func DeriveIPEK(bdk, ksn []byte) ([]byte, error) {
+	if len(bdk) != dukptKeyLength {
+		return nil, fmt.Errorf("bdk length must be 16 bytes")
+	}
+
+	if len(ksn) != ksnLength {
+		return nil, fmt.Errorf("ksn length must be 10 bytes")
+	}
+
+	// leftmost 8 bytes of the KSN with the transaction counter cleared
+	initialKSN := make([]byte, dukptHalfLength)
+	copy(initialKSN, ksn)
+	initialKSN[7] &= 0xE0
+
+	left, err := tdesEncrypt(bdk, initialKSN)
+	if err != nil {
+		return nil, err
+	}
+
+	maskedBDK, err := xor(bdk, keyMask)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := tdesEncrypt(maskedBDK, initialKSN)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(left, right...), nil
+}
+
+// DerivePINKey returns the PIN encryption key of the transaction identified by
+// ksn from the initial PIN encryption key of the device.
+func DerivePINKey(ipek, ksn []byte) ([]byte, error) {
+	key, err := deriveTransactionKey(ipek, ksn)
+	if err != nil {
+		return nil, err
+	}
+
+	return xor(key, pinVariant)
+}
+
+func deriveTransactionKey(ipek, ksn []byte) ([]byte, error) {
+	if len(ipek) != dukptKeyLength {
+		return nil, fmt.Errorf("ipek length must be 16 bytes")
+	}
+
+	if len(ksn) != ksnLength {
+		return nil, fmt.Errorf("ksn length must be 10 bytes")
+	}
+
+	// rightmost 8 bytes of the KSN, the counter is in its rightmost 21 bits
+	var register uint64
+	for _, b := range ksn[2:] {
+		register = register<<8 | uint64(b)
+	}
+
+	counter := register & ksnCounterMask
+	register &^= ksnCounterMask
+
+	key := append([]byte(nil), ipek...)
+	for shift := uint64(1 << (ksnCounterBits - 1)); shift > 0; shift >>= 1 {
+		if counter&shift == 0 {
+			continue
+		}
+
+		register |= shift
+
+		var err error
+		key, err = generateKey(key, register)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// generateKey is the non-reversible key generation process
+func generateKey(key []byte, register uint64) ([]byte, error) {
+	data := make([]byte, dukptHalfLength)
+	for i := range data {
+		data[i] = byte(register >> (8 * (dukptHalfLength - 1 - i)))
+	}
+
+	right, err := encryptHalf(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	maskedKey, err := xor(key, keyMask)
+	if err != nil {
+		return nil, err
+	}
+
+	left, err := encryptHalf(maskedKey, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(left, right...), nil
+}
+
+// encryptHalf XORs data with the right half of key, encrypts the result with
+// single DES under the left half of key and XORs it with the right half again
+func encryptHalf(key, data []byte) ([]byte, error) {
+	block, err := des.NewCipher(key[:dukptHalfLength])
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	message, err := xor(data, key[dukptHalfLength:])
+	if err != nil {
+		return nil, err
+	}
+
+	block.Encrypt(message, message)
+
+	return xor(message, key[dukptHalfLength:])
+}
+
+func tdesEncrypt(key, plainText []byte) ([]byte, error) {
+	cipher, err := NewTdesECB(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.Encrypt(plainText)
+}
+
+func xor(a, b []byte) ([]byte, error) {
+	if len(a) != len(b) {
+		return nil, fmt.Errorf("length mismatch: %d vs %d", len(a), len(b))
+	}
+
+	// XOR the bytes
+	xorBytes := make([]byte, len(a))
+	for i := 0; i < len(a); i++ {
+		xorBytes[i] = a[i] ^ b[i]
+	}
+
+	return xorBytes, nil
+}
@@ -0,0 +1,77 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDukpt(t *testing.T) {
+	// test vectors of ANSI X9.24-1:2009 Annex A
+	bdk, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	require.NoError(t, err)
+
+	ksn, err := hex.DecodeString("FFFF9876543210E00001")
+	require.NoError(t, err)
+
+	t.Run("DeriveIPEK", func(t *testing.T) {
+		ipek, err := DeriveIPEK(bdk, ksn)
+		require.NoError(t, err)
+		require.Equal(t, "6AC292FAA1315B4D858AB3A3D7D5933A", fmt.Sprintf("%X", ipek))
+	})
+
+	t.Run("DerivePINKey", func(t *testing.T) {
+		ipek, err := DeriveIPEK(bdk, ksn)
+		require.NoError(t, err)
+
+		pinKey, err := DerivePINKey(ipek, ksn)
+		require.NoError(t, err)
+		require.Equal(t, "042666B49184CF5C68DE9628D0397B36", fmt.Sprintf("%X", pinKey))
+	})
+
+	t.Run("NewDukpt", func(t *testing.T) {
+		// ISO-0 block of PIN 1234 and PAN 4012345678909
+		plainText, err := hex.DecodeString("041274EDCBA9876F")
+		require.NoError(t, err)
+
+		for ksnHex, expected := range map[string]string{
+			"FFFF9876543210E00001": "1B9C1845EB993A7A",
+			"FFFF9876543210E00002": "10A01C8D02C69107",
+			"FFFF9876543210E00003": "18DC07B94797B466",
+			"FFFF9876543210E00004": "0BC79509D5645DF7",
+		} {
+			ksn, err := hex.DecodeString(ksnHex)
+			require.NoError(t, err)
+
+			cipher, err := NewDukpt(bdk, ksn)
+			require.NoError(t, err)
+
+			cipherText, err := cipher.Encrypt(plainText)
+			require.NoError(t, err)
+			require.Equal(t, expected, fmt.Sprintf("%X", cipherText), ksnHex)
+
+			decrypted, err := cipher.Decrypt(cipherText)
+			require.NoError(t, err)
+			require.Equal(t, plainText, decrypted)
+		}
+	})
+
+	t.Run("wrong lengths", func(t *testing.T) {
+		_, err := DeriveIPEK(bdk[:8], ksn)
+		require.EqualError(t, err, "bdk length must be 16 bytes")
+
+		_, err = DeriveIPEK(bdk, ksn[:8])
+		require.EqualError(t, err, "ksn length must be 10 bytes")
+
+		_, err = DerivePINKey(bdk[:8], ksn)
+		require.EqualError(t, err, "ipek length must be 16 bytes")
+
+		_, err = DerivePINKey(bdk, ksn[:8])
+		require.EqualError(t, err, "ksn length must be 10 bytes")
+
+		_, err = NewDukpt(bdk, ksn[:8])
+		require.EqualError(t, err, "ksn length must be 10 bytes")
+	})
+}
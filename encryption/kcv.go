@@ -0,0 +1,125 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"strings"
+
+	"github.com/moov-io/pinblock/internal/cmac"
+)
+
+// KCVMethod is the algorithm used to compute a key check value (KCV)
+type KCVMethod int
+
+const (
+	// KCVZeros encrypts a block of zeros with the key. The check value is
+	// the leftmost 3 bytes of the result.
+	KCVZeros KCVMethod = iota
+
+	// KCVCMAC computes the CMAC of a block of zeros with the key, as defined
+	// by ANSI X9.24-1-2017 for AES keys. The check value is the leftmost
+	// 5 bytes of the result.
+	KCVCMAC
+)
+
+// TdesKCV returns the check value of a double- or triple-length TDES key as
+// uppercase hex
+func TdesKCV(key []byte, method KCVMethod) (string, error) {
+	cipher, err := NewTdesECB(key)
+	if err != nil {
+		return "", err
+	}
+
+	return cipher.KCV(method), nil
+}
+
+// AesKCV returns the check value of an AES key as uppercase hex
+func AesKCV(key []byte, method KCVMethod) (string, error) {
+	cipher, err := NewAesECB(key)
+	if err != nil {
+		return "", err
+	}
+
+	return cipher.KCV(method), nil
+}
+
+// Option configures a cipher when it is created
+type Option func(*options)
+
+type options struct {
+	kcv       string
+	kcvMethod KCVMethod
+}
+
+// WithKCV makes the constructor of a cipher refuse a key whose check value,
+// computed by encrypting zeros, does not start with kcv
+func WithKCV(kcv string) Option {
+	return func(o *options) {
+		o.kcv = kcv
+		o.kcvMethod = KCVZeros
+	}
+}
+
+// WithCMACKCV makes the constructor of a cipher refuse a key whose CMAC based
+// check value does not start with kcv
+func WithCMACKCV(kcv string) Option {
+	return func(o *options) {
+		o.kcv = kcv
+		o.kcvMethod = KCVCMAC
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// verifyKCV compares the expected check value of the options, if any, with
+// the check value of the key of block
+func (o *options) verifyKCV(block cipher.Block) error {
+	if o.kcv == "" {
+		return nil
+	}
+
+	return CheckKCV(BlockKCV(block, o.kcvMethod), o.kcv)
+}
+
+// CheckKCV returns an error when the check value actual of a key does not
+// start with expected. expected is at least 4 hex characters, in any case.
+func CheckKCV(actual, expected string) error {
+	if len(expected) < 4 || len(expected) > len(actual) {
+		return fmt.Errorf("key check value must be between 4 and %d hex characters", len(actual))
+	}
+
+	if !strings.EqualFold(actual[:len(expected)], expected) {
+		return fmt.Errorf("key check value %s does not match expected %s", actual[:len(expected)], strings.ToUpper(expected))
+	}
+
+	return nil
+}
+
+// BlockKCV returns the check value of the key of block as uppercase hex, for
+// the ciphers whose key is not held by this package, such as the key of an HSM
+func BlockKCV(block cipher.Block, method KCVMethod) string {
+	zeros := make([]byte, block.BlockSize())
+
+	if method == KCVCMAC {
+		return fmt.Sprintf("%X", cmac.Sum(block, zeros)[:5])
+	}
+
+	block.Encrypt(zeros, zeros)
+	return fmt.Sprintf("%X", zeros[:3])
+}
+
+// KCV returns the check value of the key of the cipher as uppercase hex
+func (a *AesECB) KCV(method KCVMethod) string {
+	return BlockKCV(a.cipherBlock, method)
+}
+
+// KCV returns the check value of the key of the cipher as uppercase hex
+func (t *TdesECB) KCV(method KCVMethod) string {
+	return BlockKCV(t.cipherBlock, method)
+}
@@ -0,0 +1,82 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKCV(t *testing.T) {
+	key, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	require.NoError(t, err)
+
+	t.Run("TDES", func(t *testing.T) {
+		kcv, err := TdesKCV(key, KCVZeros)
+		require.NoError(t, err)
+		require.Equal(t, "08D7B4", kcv)
+
+		kcv, err = TdesKCV(key, KCVCMAC)
+		require.NoError(t, err)
+		require.Equal(t, "0A82458664", kcv)
+
+		_, err = TdesKCV(key[:8], KCVZeros)
+		require.EqualError(t, err, "key length must be 16 or 24 bytes")
+	})
+
+	t.Run("AES", func(t *testing.T) {
+		kcv, err := AesKCV(key, KCVZeros)
+		require.NoError(t, err)
+		require.Equal(t, "D5C825", kcv)
+
+		kcv, err = AesKCV(key, KCVCMAC)
+		require.NoError(t, err)
+		require.Equal(t, "2090A67375", kcv)
+
+		_, err = AesKCV(key[:8], KCVZeros)
+		require.ErrorContains(t, err, "creating cipher")
+	})
+
+	t.Run("cipher KCV", func(t *testing.T) {
+		cipher, err := NewAesECB([]byte("1234567890123456"))
+		require.NoError(t, err)
+		require.Equal(t, "D8B598", cipher.KCV(KCVZeros))
+		require.Equal(t, "B417C4E1BC", cipher.KCV(KCVCMAC))
+	})
+
+	t.Run("CheckKCV", func(t *testing.T) {
+		require.NoError(t, CheckKCV("08D7B4", "08d7"))
+		require.EqualError(t, CheckKCV("08D7B4", "08D7B5"), "key check value 08D7B4 does not match expected 08D7B5")
+		require.EqualError(t, CheckKCV("0A82458664", "0A8245866400"), "key check value must be between 4 and 10 hex characters")
+	})
+
+	t.Run("constructor options", func(t *testing.T) {
+		_, err := NewTdesECB(key, WithKCV("08D7B4"))
+		require.NoError(t, err)
+
+		// check values are case insensitive and can be shorter
+		_, err = NewTdesECB(key, WithKCV("08d7"))
+		require.NoError(t, err)
+
+		_, err = NewTdesECB(key, WithKCV("08D7B5"))
+		require.EqualError(t, err, "key check value 08D7B4 does not match expected 08D7B5")
+
+		_, err = NewTdesECB(key, WithCMACKCV("0A82458664"))
+		require.NoError(t, err)
+
+		_, err = NewAesECB(key, WithKCV("D5C825"))
+		require.NoError(t, err)
+
+		_, err = NewAesECB(key, WithCMACKCV("2090A67375"))
+		require.NoError(t, err)
+
+		_, err = NewAesECB(key, WithCMACKCV("D5C825"))
+		require.EqualError(t, err, "key check value 2090A6 does not match expected D5C825")
+
+		_, err = NewAesECB(key, WithKCV("D5C8250000"))
+		require.EqualError(t, err, "key check value must be between 4 and 6 hex characters")
+
+		_, err = NewAesECB(key, WithKCV("D5"))
+		require.EqualError(t, err, "key check value must be between 4 and 6 hex characters")
+	})
+}
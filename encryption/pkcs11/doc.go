@@ -0,0 +1,34 @@
+// Package pkcs11 implements a PIN block cipher with a key held by an HSM, or
+// any token with a PKCS#11 module such as SoftHSM. The key never leaves the
+// HSM: the PIN blocks are encrypted and decrypted by the token.
+//
+//	cipher, err := pkcs11.New(pkcs11.Config{
+//		Module:     "/usr/lib/softhsm/libsofthsm2.so",
+//		TokenLabel: "pin",
+//		PIN:        os.Getenv("PKCS11_PIN"),
+//		KeyLabel:   "zpk",
+//		KCV:        "08D7B4",
+//	})
+//	defer cipher.Close()
+//	iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+//
+// An AES key is used with ISO-4, its check value is usually the CMAC one:
+//
+//	cipher, err := pkcs11.New(pkcs11.Config{
+//		...
+//		KeyLabel:  "aes-zpk",
+//		KCV:       "2090A67375",
+//		KCVMethod: encryption.KCVCMAC,
+//	})
+//	iso4 := formats.NewISO4(cipher)
+//
+// KCV returns the check values of the key like the ciphers of the
+// encryption package, they are computed by the token when the cipher is
+// created.
+//
+// The ciphers of a module share it: the module is initialized by the first
+// one and finalized when the last one is closed, unless it was initialized by
+// other code of the process.
+//
+// The package calls the module with cgo, it is empty when cgo is disabled.
+package pkcs11
@@ -0,0 +1,440 @@
+//go:build cgo
+
+package pkcs11
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/moov-io/pinblock/encryption"
+)
+
+// Config is the token and the key of a Cipher
+type Config struct {
+	// Module is the path of the PKCS#11 library of the HSM
+	Module string
+
+	// TokenLabel is the label of the token that holds the key
+	TokenLabel string
+
+	// PIN is the PIN of the user of the token
+	PIN string
+
+	// KeyLabel is the label of the AES or TDES secret key
+	KeyLabel string
+
+	// KCV, when set, is the expected check value of the key, computed with
+	// KCVMethod. A key with another check value is refused.
+	KCV string
+
+	// KCVMethod is the method of KCV, encryption.KCVZeros by default
+	KCVMethod encryption.KCVMethod
+
+	// Sessions is the number of sessions opened with the token, which is the
+	// number of blocks encrypted in parallel. 1 by default.
+	Sessions int
+}
+
+// module is the part of a PKCS#11 module used to encrypt, implemented by
+// *pkcs11.Ctx
+type module interface {
+	EncryptInit(sh p11.SessionHandle, m []*p11.Mechanism, o p11.ObjectHandle) error
+	Encrypt(sh p11.SessionHandle, message []byte) ([]byte, error)
+	DecryptInit(sh p11.SessionHandle, m []*p11.Mechanism, o p11.ObjectHandle) error
+	Decrypt(sh p11.SessionHandle, cipher []byte) ([]byte, error)
+}
+
+// loader is the part of a PKCS#11 module that loads and unloads it,
+// implemented by *pkcs11.Ctx
+type loader interface {
+	Initialize(opts ...p11.InitializeOption) error
+	Finalize() error
+	Destroy()
+}
+
+// loadModule loads the module of path, it returns nil when the module cannot
+// be loaded
+var loadModule = func(path string) loader {
+	if ctx := p11.New(path); ctx != nil {
+		return ctx
+	}
+	return nil
+}
+
+// library is a module loaded by New, shared by the ciphers of its path
+type library struct {
+	path   string
+	loader loader
+	refs   int
+
+	// initialized is false when the module was already initialized by other
+	// code of the process, which finalizes it
+	initialized bool
+}
+
+// libraries are the loaded modules by path, a module is finalized and
+// unloaded when the last cipher that uses it is closed
+var libraries = struct {
+	sync.Mutex
+	loaded map[string]*library
+}{loaded: make(map[string]*library)}
+
+// openLibrary returns the module of path, loaded and initialized on first use
+func openLibrary(path string) (*library, error) {
+	libraries.Lock()
+	defer libraries.Unlock()
+
+	if lib, ok := libraries.loaded[path]; ok {
+		lib.refs++
+		return lib, nil
+	}
+
+	loader := loadModule(path)
+	if loader == nil {
+		return nil, fmt.Errorf("loading module %s", path)
+	}
+
+	lib := &library{path: path, loader: loader, refs: 1, initialized: true}
+	if err := loader.Initialize(); err != nil {
+		if !errors.Is(err, p11.Error(p11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+			loader.Destroy()
+			return nil, fmt.Errorf("initializing module: %w", err)
+		}
+		lib.initialized = false
+	}
+	libraries.loaded[path] = lib
+
+	return lib, nil
+}
+
+// close releases the module, the last release finalizes and unloads it
+func (l *library) close() error {
+	libraries.Lock()
+	defer libraries.Unlock()
+
+	if l.refs--; l.refs > 0 {
+		return nil
+	}
+	delete(libraries.loaded, l.path)
+
+	var err error
+	if l.initialized {
+		err = l.loader.Finalize()
+	}
+	l.loader.Destroy()
+
+	return err
+}
+
+// Cipher encrypts and decrypts PIN blocks with an AES or TDES key of a token,
+// in ECB mode like the ciphers of the encryption package. It is safe for
+// concurrent use, each operation uses one of the sessions of the cipher.
+type Cipher struct {
+	module    module
+	key       p11.ObjectHandle
+	mechanism uint
+	blockSize int
+
+	// sessions are the idle sessions
+	sessions chan p11.SessionHandle
+	close    func() error
+
+	// checkValues are the check values of the key by method, computed by
+	// the token when the cipher is created
+	checkValues map[encryption.KCVMethod]string
+}
+
+// New loads the module, logs in to the token and returns the cipher of the
+// key. The ciphers of a module share it, Close releases the sessions and the
+// last Close of a module unloads it.
+func New(config Config) (*Cipher, error) {
+	if config.Sessions < 1 {
+		config.Sessions = 1
+	}
+
+	lib, err := openLibrary(config.Module)
+	if err != nil {
+		return nil, err
+	}
+	ctx := lib.loader.(*p11.Ctx)
+
+	var sessions []p11.SessionHandle
+	closeSessions := func() error {
+		var errs []error
+		for _, session := range sessions {
+			errs = append(errs, ctx.CloseSession(session))
+		}
+		errs = append(errs, lib.close())
+
+		return errors.Join(errs...)
+	}
+
+	slot, err := findToken(ctx, config.TokenLabel)
+	if err != nil {
+		closeSessions()
+		return nil, err
+	}
+
+	for n := 0; n < config.Sessions; n++ {
+		session, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+		if err != nil {
+			closeSessions()
+			return nil, fmt.Errorf("opening session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	// the login applies to all the sessions of the token
+	err = ctx.Login(sessions[0], p11.CKU_USER, config.PIN)
+	if err != nil && !errors.Is(err, p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN)) {
+		closeSessions()
+		return nil, fmt.Errorf("logging in: %w", err)
+	}
+
+	key, mechanism, blockSize, err := findKey(ctx, sessions[0], config.KeyLabel)
+	if err != nil {
+		closeSessions()
+		return nil, err
+	}
+
+	cipher := newCipher(ctx, key, mechanism, blockSize, sessions, closeSessions)
+
+	if err := cipher.computeKCV(); err != nil {
+		cipher.Close()
+		return nil, err
+	}
+
+	if config.KCV != "" {
+		if err := encryption.CheckKCV(cipher.KCV(config.KCVMethod), config.KCV); err != nil {
+			cipher.Close()
+			return nil, err
+		}
+	}
+
+	return cipher, nil
+}
+
+func newCipher(m module, key p11.ObjectHandle, mechanism uint, blockSize int, sessions []p11.SessionHandle, close func() error) *Cipher {
+	c := &Cipher{
+		module:    m,
+		key:       key,
+		mechanism: mechanism,
+		blockSize: blockSize,
+		sessions:  make(chan p11.SessionHandle, len(sessions)),
+		close:     close,
+	}
+	for _, session := range sessions {
+		c.sessions <- session
+	}
+
+	return c
+}
+
+// findToken returns the slot of the token labeled label
+func findToken(ctx *p11.Ctx, label string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("listing slots: %w", err)
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, fmt.Errorf("reading token of slot %d: %w", slot, err)
+		}
+
+		if info.Label == label {
+			return slot, nil
+		}
+	}
+
+	return 0, fmt.Errorf("token %s not found", label)
+}
+
+// findKey returns the secret key labeled label and the ECB mechanism and the
+// block size of its type
+func findKey(ctx *p11.Ctx, session p11.SessionHandle, label string) (p11.ObjectHandle, uint, int, error) {
+	err := ctx.FindObjectsInit(session, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, p11.CKO_SECRET_KEY),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+	})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("finding key: %w", err)
+	}
+
+	keys, _, err := ctx.FindObjects(session, 2)
+	if finalErr := ctx.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("finding key: %w", err)
+	}
+
+	switch len(keys) {
+	case 0:
+		return 0, 0, 0, fmt.Errorf("key %s not found", label)
+	case 1:
+	default:
+		return 0, 0, 0, fmt.Errorf("key label %s is not unique", label)
+	}
+
+	attributes, err := ctx.GetAttributeValue(session, keys[0], []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("reading key type: %w", err)
+	}
+
+	// the attribute values are in the byte order of the module
+	keyType := attributes[0].Value
+	switch {
+	case bytes.Equal(keyType, p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_AES).Value):
+		return keys[0], p11.CKM_AES_ECB, 16, nil
+	case bytes.Equal(keyType, p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_DES3).Value),
+		bytes.Equal(keyType, p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_DES2).Value):
+		return keys[0], p11.CKM_DES3_ECB, 8, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("key %s is not an AES or TDES key", label)
+	}
+}
+
+func (c *Cipher) Encrypt(plainText []byte) ([]byte, error) {
+	return c.EncryptContext(context.Background(), plainText)
+}
+
+func (c *Cipher) Decrypt(cipherText []byte) ([]byte, error) {
+	return c.DecryptContext(context.Background(), cipherText)
+}
+
+// EncryptContext encrypts a block, ctx bounds the wait for an idle session
+func (c *Cipher) EncryptContext(ctx context.Context, plainText []byte) ([]byte, error) {
+	if len(plainText) != c.blockSize {
+		return nil, fmt.Errorf("plain text length must be %d bytes", c.blockSize)
+	}
+
+	session, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(session)
+
+	mechanism := []*p11.Mechanism{p11.NewMechanism(c.mechanism, nil)}
+	if err := c.module.EncryptInit(session, mechanism, c.key); err != nil {
+		return nil, fmt.Errorf("encrypting: %w", err)
+	}
+
+	cipherText, err := c.module.Encrypt(session, plainText)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting: %w", err)
+	}
+
+	return cipherText, nil
+}
+
+// DecryptContext decrypts a block, ctx bounds the wait for an idle session
+func (c *Cipher) DecryptContext(ctx context.Context, cipherText []byte) ([]byte, error) {
+	if len(cipherText) != c.blockSize {
+		return nil, fmt.Errorf("cipher text length must be %d bytes", c.blockSize)
+	}
+
+	session, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(session)
+
+	mechanism := []*p11.Mechanism{p11.NewMechanism(c.mechanism, nil)}
+	if err := c.module.DecryptInit(session, mechanism, c.key); err != nil {
+		return nil, fmt.Errorf("decrypting: %w", err)
+	}
+
+	plainText, err := c.module.Decrypt(session, cipherText)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting: %w", err)
+	}
+
+	return plainText, nil
+}
+
+// KCV returns the check value of the key as uppercase hex. The check values
+// are computed by the token when the cipher is created.
+func (c *Cipher) KCV(method encryption.KCVMethod) string {
+	return c.checkValues[method]
+}
+
+// computeKCV computes the check values of the key with the token
+func (c *Cipher) computeKCV() error {
+	block := &tokenBlock{cipher: c}
+
+	checkValues := make(map[encryption.KCVMethod]string)
+	for _, method := range []encryption.KCVMethod{encryption.KCVZeros, encryption.KCVCMAC} {
+		checkValues[method] = encryption.BlockKCV(block, method)
+	}
+	if block.err != nil {
+		return fmt.Errorf("computing key check value: %w", block.err)
+	}
+	c.checkValues = checkValues
+
+	return nil
+}
+
+// tokenBlock is the cipher.Block of the key of a token, it keeps the first
+// error of the token
+type tokenBlock struct {
+	cipher *Cipher
+	err    error
+}
+
+func (b *tokenBlock) BlockSize() int {
+	return b.cipher.blockSize
+}
+
+func (b *tokenBlock) Encrypt(dst, src []byte) {
+	if b.err != nil {
+		return
+	}
+
+	cipherText, err := b.cipher.Encrypt(src)
+	if err != nil {
+		b.err = err
+		return
+	}
+	copy(dst, cipherText)
+}
+
+func (b *tokenBlock) Decrypt(dst, src []byte) {
+	if b.err != nil {
+		return
+	}
+
+	plainText, err := b.cipher.Decrypt(src)
+	if err != nil {
+		b.err = err
+		return
+	}
+	copy(dst, plainText)
+}
+
+// Close closes the sessions and releases the module, which is unloaded when
+// no other cipher uses it. The cipher must not be in use.
+func (c *Cipher) Close() error {
+	return c.close()
+}
+
+// acquire waits for an idle session
+func (c *Cipher) acquire(ctx context.Context) (p11.SessionHandle, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case session := <-c.sessions:
+		return session, nil
+	}
+}
+
+func (c *Cipher) release(session p11.SessionHandle) {
+	c.sessions <- session
+}
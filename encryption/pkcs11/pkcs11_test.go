@@ -0,0 +1,328 @@
+//go:build cgo
+
+package pkcs11
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+var _ formats.ContextCipher = (*Cipher)(nil)
+
+// fakeModule encrypts with a key in memory and fails when two operations
+// use the same session, like a token, or when its library is not initialized
+type fakeModule struct {
+	cipher  formats.Cipher
+	library *fakeLibrary
+
+	mu     sync.Mutex
+	active map[p11.SessionHandle]bool
+}
+
+func newFakeModule(t *testing.T, key string) *fakeModule {
+	t.Helper()
+
+	rawKey, err := hex.DecodeString(key)
+	require.NoError(t, err)
+
+	cipher, err := encryption.NewTdesECB(rawKey)
+	require.NoError(t, err)
+
+	return &fakeModule{cipher: cipher, active: make(map[p11.SessionHandle]bool)}
+}
+
+func (m *fakeModule) init(sh p11.SessionHandle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.library != nil && !m.library.initialized {
+		return p11.Error(p11.CKR_CRYPTOKI_NOT_INITIALIZED)
+	}
+
+	if m.active[sh] {
+		return p11.Error(p11.CKR_OPERATION_ACTIVE)
+	}
+	m.active[sh] = true
+
+	return nil
+}
+
+func (m *fakeModule) finish(sh p11.SessionHandle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.active[sh] {
+		return p11.Error(p11.CKR_OPERATION_NOT_INITIALIZED)
+	}
+	delete(m.active, sh)
+
+	return nil
+}
+
+func (m *fakeModule) EncryptInit(sh p11.SessionHandle, _ []*p11.Mechanism, _ p11.ObjectHandle) error {
+	return m.init(sh)
+}
+
+func (m *fakeModule) Encrypt(sh p11.SessionHandle, message []byte) ([]byte, error) {
+	if err := m.finish(sh); err != nil {
+		return nil, err
+	}
+
+	return m.cipher.Encrypt(message)
+}
+
+func (m *fakeModule) DecryptInit(sh p11.SessionHandle, _ []*p11.Mechanism, _ p11.ObjectHandle) error {
+	return m.init(sh)
+}
+
+func (m *fakeModule) Decrypt(sh p11.SessionHandle, cipher []byte) ([]byte, error) {
+	if err := m.finish(sh); err != nil {
+		return nil, err
+	}
+
+	return m.cipher.Decrypt(cipher)
+}
+
+// fakeLibrary counts the initializations of a module
+type fakeLibrary struct {
+	initializeErr error
+	initialized   bool
+
+	initializations, finalizations, destructions int
+}
+
+func (l *fakeLibrary) Initialize(...p11.InitializeOption) error {
+	l.initializations++
+	if l.initializeErr != nil {
+		return l.initializeErr
+	}
+	l.initialized = true
+	return nil
+}
+
+func (l *fakeLibrary) Finalize() error {
+	l.finalizations++
+	l.initialized = false
+	return nil
+}
+
+func (l *fakeLibrary) Destroy() {
+	l.destructions++
+}
+
+func TestCipher(t *testing.T) {
+	account := "5432101234567891"
+	module := newFakeModule(t, "0123456789ABCDEFFEDCBA9876543210")
+
+	var closed bool
+	cipher := newCipher(module, 1, p11.CKM_DES3_ECB, 8, []p11.SessionHandle{1, 2, 3}, func() error {
+		closed = true
+		return nil
+	})
+	require.NoError(t, cipher.computeKCV())
+
+	t.Run("PIN block", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+
+		pinBlock, err := iso0.Encode("1234", account)
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", pinBlock)
+
+		pin, err := iso0.Decode(pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("KCV", func(t *testing.T) {
+		// the check values of encryption.TdesKCV
+		require.Equal(t, "08D7B4", cipher.KCV(encryption.KCVZeros))
+		require.Equal(t, "0A82458664", cipher.KCV(encryption.KCVCMAC))
+
+		// the shape of the ciphers of the encryption package, used by the
+		// key blocks and the rotation of PIN blocks
+		var _ interface {
+			KCV(method encryption.KCVMethod) string
+		} = cipher
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+
+				pin := fmt.Sprintf("%04d", 1000+g)
+				for i := 0; i < 50; i++ {
+					pinBlock, err := iso0.Encode(pin, account)
+					if err == nil {
+						_, err = iso0.Decode(pinBlock, account)
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(g)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := cipher.Encrypt(make([]byte, 16))
+		require.EqualError(t, err, "plain text length must be 8 bytes")
+
+		_, err = cipher.Decrypt(make([]byte, 7))
+		require.EqualError(t, err, "cipher text length must be 8 bytes")
+
+		// the sessions are busy
+		busy := newCipher(module, 1, p11.CKM_DES3_ECB, 8, nil, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = busy.EncryptContext(ctx, make([]byte, 8))
+		require.ErrorIs(t, err, context.Canceled)
+
+		// the module failure is returned
+		require.NoError(t, module.init(4))
+		session := newCipher(module, 1, p11.CKM_DES3_ECB, 8, []p11.SessionHandle{4}, nil)
+
+		_, err = session.Encrypt(make([]byte, 8))
+		require.ErrorIs(t, err, p11.Error(p11.CKR_OPERATION_ACTIVE))
+		require.ErrorContains(t, err, "encrypting: ")
+	})
+
+	require.NoError(t, cipher.Close())
+	require.True(t, closed)
+
+	_, err := New(Config{Module: "/nonexistent/libpkcs11.so"})
+	require.EqualError(t, err, "loading module /nonexistent/libpkcs11.so")
+}
+
+func TestSharedModule(t *testing.T) {
+	load := loadModule
+	t.Cleanup(func() { loadModule = load })
+
+	lib := &fakeLibrary{}
+	loadModule = func(string) loader { return lib }
+
+	module := newFakeModule(t, "0123456789ABCDEFFEDCBA9876543210")
+	module.library = lib
+
+	open := func(session p11.SessionHandle) *Cipher {
+		l, err := openLibrary("libfake.so")
+		require.NoError(t, err)
+
+		return newCipher(module, 1, p11.CKM_DES3_ECB, 8, []p11.SessionHandle{session}, l.close)
+	}
+
+	first, second := open(1), open(2)
+	require.Equal(t, 1, lib.initializations)
+
+	// closing a cipher does not finalize the module of the other one
+	require.NoError(t, first.Close())
+	require.Zero(t, lib.finalizations)
+
+	require.NoError(t, second.computeKCV())
+	require.Equal(t, "08D7B4", second.KCV(encryption.KCVZeros))
+
+	require.NoError(t, second.Close())
+	require.Equal(t, 1, lib.finalizations)
+	require.Equal(t, 1, lib.destructions)
+
+	err := second.computeKCV()
+	require.ErrorIs(t, err, p11.Error(p11.CKR_CRYPTOKI_NOT_INITIALIZED))
+	require.ErrorContains(t, err, "computing key check value: ")
+
+	// the module is loaded again by the next cipher
+	third := open(3)
+	require.Equal(t, 2, lib.initializations)
+	require.NoError(t, third.Close())
+
+	t.Run("initialized by other code", func(t *testing.T) {
+		lib := &fakeLibrary{initializeErr: p11.Error(p11.CKR_CRYPTOKI_ALREADY_INITIALIZED)}
+		loadModule = func(string) loader { return lib }
+
+		cipher := open(1)
+		require.NoError(t, cipher.Close())
+
+		// the module is only finalized by the code that initialized it
+		require.Zero(t, lib.finalizations)
+		require.Equal(t, 1, lib.destructions)
+	})
+
+	t.Run("initialization error", func(t *testing.T) {
+		lib := &fakeLibrary{initializeErr: p11.Error(p11.CKR_GENERAL_ERROR)}
+		loadModule = func(string) loader { return lib }
+
+		_, err := openLibrary("libfake.so")
+		require.ErrorIs(t, err, p11.Error(p11.CKR_GENERAL_ERROR))
+		require.ErrorContains(t, err, "initializing module: ")
+		require.Equal(t, 1, lib.destructions)
+	})
+}
+
+// TestSoftHSM runs against a PKCS#11 module when PKCS11_MODULE is set, for
+// example with SoftHSM and a TDES key created by:
+//
+//	softhsm2-util --init-token --free --label pin --pin 1234 --so-pin 1234
+//	pkcs11-tool --module /usr/lib/softhsm/libsofthsm2.so --token-label pin --login --pin 1234 \
+//		--keygen --key-type DES3:24 --label zpk
+//
+//	PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so PKCS11_TOKEN=pin PKCS11_PIN=1234 PKCS11_KEY=zpk go test ./encryption/pkcs11
+func TestSoftHSM(t *testing.T) {
+	if os.Getenv("PKCS11_MODULE") == "" {
+		t.Skip("PKCS11_MODULE is not set")
+	}
+
+	cipher, err := New(Config{
+		Module:     os.Getenv("PKCS11_MODULE"),
+		TokenLabel: os.Getenv("PKCS11_TOKEN"),
+		PIN:        os.Getenv("PKCS11_PIN"),
+		KeyLabel:   os.Getenv("PKCS11_KEY"),
+		Sessions:   2,
+	})
+	require.NoError(t, err)
+	defer cipher.Close()
+
+	t.Logf("key check value %s", cipher.KCV(encryption.KCVZeros))
+
+	format := formats.NewEncrypted(formats.NewISO0(), cipher)
+	if cipher.blockSize == 16 {
+		format = formats.NewISO4(cipher)
+	}
+
+	pinBlock, err := format.Encode("1234", "5432101234567891")
+	require.NoError(t, err)
+
+	pin, err := format.Decode(pinBlock, "5432101234567891")
+	require.NoError(t, err)
+	require.Equal(t, "1234", pin)
+
+	_, err = New(Config{
+		Module:     os.Getenv("PKCS11_MODULE"),
+		TokenLabel: os.Getenv("PKCS11_TOKEN"),
+		PIN:        os.Getenv("PKCS11_PIN"),
+		KeyLabel:   "missing key",
+	})
+	require.EqualError(t, err, "key missing key not found")
+}
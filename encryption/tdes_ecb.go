@@ -0,0 +1,105 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"fmt"
+)
+
+// TdesECB encrypts and decrypts single 8 byte blocks with Triple-DES (TDEA).
+// It is used for the PIN block formats that are 8 bytes long, such as ISO-0,
+// ISO-1 and ISO-3, which are usually protected by a TDES zone PIN key.
+type TdesECB struct {
+	cipherBlock cipher.Block
+}
+
+// NewTdesECB returns a TDES cipher for a double-length (16 bytes) or
+// triple-length (24 bytes) key. A double-length key K1K2 is used as K1K2K1.
+// WithKCV and WithCMACKCV can be passed to refuse a key with an unexpected
+// check value.
+func NewTdesECB(key []byte, opts ...Option) (*TdesECB, error) {
+	tripleKey, err := tripleLengthKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher, err := des.NewTripleDESCipher(tripleKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	if err := newOptions(opts).verifyKCV(cipher); err != nil {
+		return nil, err
+	}
+
+	return &TdesECB{
+		cipherBlock: cipher,
+	}, nil
+}
+
+func (t *TdesECB) Encrypt(plainText []byte) ([]byte, error) {
+	cipherText := make([]byte, len(plainText))
+
+	if err := t.EncryptTo(cipherText, plainText); err != nil {
+		return nil, err
+	}
+
+	return cipherText, nil
+}
+
+// EncryptTo encrypts plainText into dst, which must be at least as long.
+// Unlike Encrypt, it does not allocate.
+func (t *TdesECB) EncryptTo(dst, plainText []byte) error {
+	if len(plainText) != des.BlockSize {
+		return fmt.Errorf("plain text length must be 8 bytes")
+	}
+
+	if len(dst) < len(plainText) {
+		return fmt.Errorf("destination length must be at least 8 bytes")
+	}
+
+	t.cipherBlock.Encrypt(dst, plainText)
+
+	return nil
+}
+
+func (t *TdesECB) Decrypt(cipherText []byte) ([]byte, error) {
+	plainText := make([]byte, len(cipherText))
+
+	if err := t.DecryptTo(plainText, cipherText); err != nil {
+		return nil, err
+	}
+
+	return plainText, nil
+}
+
+// DecryptTo decrypts cipherText into dst, which must be at least as long.
+// Unlike Decrypt, it does not allocate.
+func (t *TdesECB) DecryptTo(dst, cipherText []byte) error {
+	if len(cipherText) != des.BlockSize {
+		return fmt.Errorf("cipher text length must be 8 bytes")
+	}
+
+	if len(dst) < len(cipherText) {
+		return fmt.Errorf("destination length must be at least 8 bytes")
+	}
+
+	t.cipherBlock.Decrypt(dst, cipherText)
+
+	return nil
+}
+
+// tripleLengthKey expands a double-length key to K1K2K1 and returns a copy of
+// a triple-length key as is.
+func tripleLengthKey(key []byte) ([]byte, error) {
+	switch len(key) {
+	case 16:
+		tripleKey := make([]byte, 0, 24)
+		tripleKey = append(tripleKey, key...)
+		return append(tripleKey, key[:8]...), nil
+	case 24:
+		return append([]byte(nil), key...), nil
+	default:
+		return nil, fmt.Errorf("key length must be 16 or 24 bytes")
+	}
+}
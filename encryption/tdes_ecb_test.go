@@ -0,0 +1,87 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTdesECB(t *testing.T) {
+	doubleKey, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	require.NoError(t, err)
+
+	tripleKey, err := hex.DecodeString("0123456789ABCDEFFEDCBA98765432100123456789ABCDEF")
+	require.NoError(t, err)
+
+	t.Run("Encrypt known value", func(t *testing.T) {
+		cipher, err := NewTdesECB(doubleKey)
+		require.NoError(t, err)
+
+		// encrypting zeros gives the well known check value 08D7B4
+		cipherText, err := cipher.Encrypt(make([]byte, 8))
+		require.NoError(t, err)
+		require.Equal(t, "08D7B4FB629D0885", fmt.Sprintf("%X", cipherText))
+	})
+
+	t.Run("Encode/Decode", func(t *testing.T) {
+		for _, key := range [][]byte{doubleKey, tripleKey} {
+			cipher, err := NewTdesECB(key)
+			require.NoError(t, err)
+
+			// ISO-0 block of PIN 1234 and PAN 5432101234567891
+			plainText, err := hex.DecodeString("041215FEDCBA9876")
+			require.NoError(t, err)
+
+			cipherText, err := cipher.Encrypt(plainText)
+			require.NoError(t, err)
+			require.Equal(t, "BA2ADC4EBA48F711", fmt.Sprintf("%X", cipherText))
+
+			decrypted, err := cipher.Decrypt(cipherText)
+			require.NoError(t, err)
+			require.Equal(t, plainText, decrypted)
+		}
+	})
+
+	t.Run("EncryptTo/DecryptTo", func(t *testing.T) {
+		cipher, err := NewTdesECB(doubleKey)
+		require.NoError(t, err)
+
+		var block [8]byte
+		require.NoError(t, cipher.EncryptTo(block[:], make([]byte, 8)))
+		require.Equal(t, "08D7B4FB629D0885", fmt.Sprintf("%X", block))
+
+		var decrypted [8]byte
+		require.NoError(t, cipher.DecryptTo(decrypted[:], block[:]))
+		require.Equal(t, [8]byte{}, decrypted)
+
+		require.EqualError(t, cipher.EncryptTo(block[:4], make([]byte, 8)), "destination length must be at least 8 bytes")
+		require.EqualError(t, cipher.DecryptTo(block[:], make([]byte, 16)), "cipher text length must be 8 bytes")
+	})
+
+	t.Run("wrong key length", func(t *testing.T) {
+		_, err := NewTdesECB(make([]byte, 8))
+		require.EqualError(t, err, "key length must be 16 or 24 bytes")
+
+		_, err = NewTdesECB(make([]byte, 32))
+		require.EqualError(t, err, "key length must be 16 or 24 bytes")
+	})
+
+	t.Run("Encrypt/Decrypt with wrong value", func(t *testing.T) {
+		cipher, err := NewTdesECB(doubleKey)
+		require.NoError(t, err)
+
+		_, err = cipher.Encrypt([]byte("123456789"))
+		require.EqualError(t, err, "plain text length must be 8 bytes")
+
+		_, err = cipher.Encrypt([]byte("1234567"))
+		require.EqualError(t, err, "plain text length must be 8 bytes")
+
+		_, err = cipher.Decrypt([]byte("123456789"))
+		require.EqualError(t, err, "cipher text length must be 8 bytes")
+
+		_, err = cipher.Decrypt([]byte("1234567"))
+		require.EqualError(t, err, "cipher text length must be 8 bytes")
+	})
+}
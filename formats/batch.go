@@ -0,0 +1,208 @@
+package formats
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Record is an input of a batch: a PIN to encode, or a PIN block to decode
+// or translate, and the account number
+type Record struct {
+	// ID identifies the record in the results, such as a row number or a
+	// card reference. It is not used by the batch.
+	ID string
+
+	PIN      string
+	PINBlock string
+	Account  string
+}
+
+// Result is the outcome of a record of a batch
+type Result struct {
+	// Index is the position of the record in the batch, or in the stream
+	Index int
+
+	// ID is the ID of the record
+	ID string
+
+	// PINBlock is the PIN block of an encoded or translated record
+	PINBlock string
+
+	// PIN is the PIN of a decoded record
+	PIN string
+
+	// Err is the failure of the record, the other records are processed
+	Err error
+}
+
+// Batch encodes, decodes or translates records in parallel with a bounded
+// pool of workers. The workers share the formats, which are safe for
+// concurrent use. A failed record does not stop the batch, its error is
+// reported in its result.
+//
+//	from := formats.NewEncrypted(formats.NewISO0(), oldZPK)
+//	to := formats.NewEncrypted(formats.NewISO0(), newZPK)
+//	batch := formats.NewTranslateBatch(from, to, formats.WithWorkers(16))
+//
+//	for _, result := range batch.Run(ctx, records) {
+//		if result.Err != nil {
+//			log.Printf("record %s: %v", result.ID, result.Err)
+//		}
+//	}
+type Batch struct {
+	workers int
+	process func(ctx context.Context, record Record) Result
+}
+
+// BatchOption configures a Batch
+type BatchOption func(*Batch)
+
+// WithWorkers sets the number of records processed in parallel, GOMAXPROCS
+// by default
+func WithWorkers(workers int) BatchOption {
+	return func(b *Batch) {
+		b.workers = workers
+	}
+}
+
+// NewEncodeBatch returns a batch that encodes the PIN of the records with
+// format
+func NewEncodeBatch(format Format, opts ...BatchOption) *Batch {
+	return newBatch(func(ctx context.Context, record Record) Result {
+		pinBlock, err := EncodeContext(ctx, format, record.PIN, record.Account)
+		return Result{PINBlock: pinBlock, Err: err}
+	}, opts)
+}
+
+// NewDecodeBatch returns a batch that decodes the PIN block of the records
+// with format
+func NewDecodeBatch(format Format, opts ...BatchOption) *Batch {
+	return newBatch(func(ctx context.Context, record Record) Result {
+		pin, err := DecodeContext(ctx, format, record.PINBlock, record.Account)
+		return Result{PIN: pin, Err: err}
+	}, opts)
+}
+
+// NewTranslateBatch returns a batch that decodes the PIN block of the
+// records with the from format and encodes the PIN with the to format, like
+// TranslatePIN. The key rotation of PIN blocks is a translation between two
+// encrypted formats.
+func NewTranslateBatch(from, to Format, opts ...BatchOption) *Batch {
+	return newBatch(func(ctx context.Context, record Record) Result {
+		pinBlock, err := translate(ctx, from, to, record.PINBlock, record.Account)
+		return Result{PINBlock: pinBlock, Err: err}
+	}, opts)
+}
+
+func newBatch(process func(ctx context.Context, record Record) Result, opts []BatchOption) *Batch {
+	b := &Batch{
+		process: process,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if b.workers < 1 {
+		b.workers = runtime.GOMAXPROCS(0)
+	}
+
+	return b
+}
+
+// Run processes records and returns their results in the same order. The
+// records that are not processed when ctx is done fail with its error.
+func (b *Batch) Run(ctx context.Context, records []Record) []Result {
+	results := make([]Result, len(records))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(b.workers, len(records)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for index := range indexes {
+				results[index] = b.result(ctx, index, records[index])
+			}
+		}()
+	}
+
+	for index := range records {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// Stream processes the records received from records until it is closed and
+// sends their results, in the order they are processed. The results channel
+// is closed once every record is processed. When ctx is done, the records
+// that are not processed yet are dropped and the results channel is closed.
+//
+// The caller must read the results until the channel is closed or cancel ctx:
+// the goroutines of the stream block on sending a result that is not read.
+func (b *Batch) Stream(ctx context.Context, records <-chan Record) <-chan Result {
+	type indexedRecord struct {
+		index  int
+		record Record
+	}
+
+	indexed := make(chan indexedRecord)
+	results := make(chan Result)
+
+	go func() {
+		defer close(indexed)
+
+		for index := 0; ; index++ {
+			select {
+			case <-ctx.Done():
+				return
+			case record, ok := <-records:
+				if !ok {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case indexed <- indexedRecord{index: index, record: record}:
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < b.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for r := range indexed {
+				select {
+				case <-ctx.Done():
+					return
+				case results <- b.result(ctx, r.index, r.record):
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// result processes a record
+func (b *Batch) result(ctx context.Context, index int, record Record) Result {
+	result := b.process(ctx, record)
+	result.Index = index
+	result.ID = record.ID
+
+	return result
+}
@@ -0,0 +1,163 @@
+package formats_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	account := "5432101234567891"
+
+	oldKey, err := encryption.NewTdesECB([]byte("0123456789ABCDEF01234567"))
+	require.NoError(t, err)
+
+	newKey, err := encryption.NewTdesECB([]byte("76543210FEDCBA9876543210"))
+	require.NoError(t, err)
+
+	oldISO0 := formats.NewEncrypted(formats.NewISO0(), oldKey)
+	newISO0 := formats.NewEncrypted(formats.NewISO0(), newKey)
+
+	// every tenth PIN is too short
+	records := make([]formats.Record, 100)
+	for i := range records {
+		pin := fmt.Sprintf("%04d", i)
+		if i%10 == 0 {
+			pin = "123"
+		}
+		records[i] = formats.Record{ID: fmt.Sprintf("card-%d", i), PIN: pin, Account: account}
+	}
+
+	t.Run("encode, translate and decode", func(t *testing.T) {
+		encoded := formats.NewEncodeBatch(oldISO0, formats.WithWorkers(4)).Run(ctx, records)
+		require.Len(t, encoded, len(records))
+
+		blocks := make([]formats.Record, 0, len(records))
+		for i, result := range encoded {
+			require.Equal(t, i, result.Index)
+			require.Equal(t, records[i].ID, result.ID)
+
+			if i%10 == 0 {
+				require.ErrorIs(t, result.Err, formats.ErrInvalidPINLength)
+				require.Empty(t, result.PINBlock)
+				continue
+			}
+
+			require.NoError(t, result.Err)
+			blocks = append(blocks, formats.Record{ID: result.ID, PINBlock: result.PINBlock, Account: account})
+		}
+
+		translated := formats.NewTranslateBatch(oldISO0, newISO0).Run(ctx, blocks)
+		for i, result := range translated {
+			require.NoError(t, result.Err)
+			require.NotEqual(t, blocks[i].PINBlock, result.PINBlock)
+			blocks[i].PINBlock = result.PINBlock
+		}
+
+		decoded := formats.NewDecodeBatch(newISO0).Run(ctx, blocks)
+		for i, result := range decoded {
+			require.NoError(t, result.Err)
+			require.Equal(t, blocks[i].ID, result.ID)
+
+			var index int
+			_, err := fmt.Sscanf(result.ID, "card-%d", &index)
+			require.NoError(t, err)
+			require.Equal(t, records[index].PIN, result.PIN)
+		}
+	})
+
+	t.Run("translate errors", func(t *testing.T) {
+		results := formats.NewTranslateBatch(formats.NewISO0(), formats.NewISO1()).Run(ctx, []formats.Record{
+			{PINBlock: "041215FEDCBA9876", Account: account},
+			{PINBlock: "341215FEDCBA9876", Account: account},
+		})
+
+		require.NoError(t, results[0].Err)
+		require.ErrorIs(t, results[1].Err, formats.ErrFormatMismatch)
+		require.EqualError(t, results[1].Err, "decoding pin block: format is different")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		in := make(chan formats.Record)
+		go func() {
+			defer close(in)
+			for _, record := range records {
+				in <- record
+			}
+		}()
+
+		seen := make(map[int]bool)
+		for result := range formats.NewEncodeBatch(formats.NewISO0(), formats.WithWorkers(3)).Stream(ctx, in) {
+			require.Equal(t, records[result.Index].ID, result.ID)
+			require.Equal(t, result.Index%10 == 0, result.Err != nil)
+			seen[result.Index] = true
+		}
+		require.Len(t, seen, len(records))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		results := formats.NewEncodeBatch(formats.NewISO0()).Run(canceled, records)
+		require.Len(t, results, len(records))
+		for _, result := range results {
+			require.ErrorIs(t, result.Err, context.Canceled)
+		}
+
+		// the stream is closed without reading the records
+		in := make(chan formats.Record)
+		for range formats.NewEncodeBatch(formats.NewISO0()).Stream(canceled, in) {
+			t.Fatal("unexpected result")
+		}
+	})
+
+	t.Run("canceled while streaming", func(t *testing.T) {
+		streaming, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// the records never end, the stream stops when it is canceled
+		in := make(chan formats.Record)
+		go func() {
+			for i := 0; ; i++ {
+				select {
+				case <-streaming.Done():
+					return
+				case in <- records[i%len(records)]:
+				}
+			}
+		}()
+
+		results := formats.NewEncodeBatch(formats.NewISO0(), formats.WithWorkers(3)).Stream(streaming, in)
+		for i := 0; i < 5; i++ {
+			_, ok := <-results
+			require.True(t, ok)
+		}
+		cancel()
+
+		// the results processed before the cancellation may still be sent,
+		// then the channel is closed
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for range results {
+			}
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("results are not closed")
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		require.Empty(t, formats.NewDecodeBatch(formats.NewISO0()).Run(ctx, nil))
+	})
+}
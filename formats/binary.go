@@ -0,0 +1,109 @@
+package formats
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// BinaryFormat is a Format that also encodes PIN blocks as raw bytes, as they
+// are carried in ISO 8583 field 52: 8 bytes, or 16 bytes for ISO-4. All the
+// formats of this package implement BinaryFormat.
+type BinaryFormat interface {
+	Format
+
+	// EncodeBytes returns the PIN block of pin as raw bytes
+	EncodeBytes(pin, account string) ([]byte, error)
+
+	// DecodeBytes returns the PIN of a raw PIN block
+	DecodeBytes(pinBlock []byte, account string) (string, error)
+}
+
+var (
+	_ BinaryFormat = (*iso0Object)(nil)
+	_ BinaryFormat = (*iso1Object)(nil)
+	_ BinaryFormat = (*iso4Object)(nil)
+	_ BinaryFormat = (*eciObject)(nil)
+	_ BinaryFormat = (*oemObject)(nil)
+	_ BinaryFormat = (*visa3Object)(nil)
+	_ BinaryFormat = (*encryptedObject)(nil)
+)
+
+// EncodeBytes returns the PIN block of pin encoded with format as raw bytes.
+// Formats that do not implement BinaryFormat are encoded as hex and decoded.
+//
+//	field52, err := formats.EncodeBytes(iso0, "1234", "5432101234567891")
+func EncodeBytes(format Format, pin, account string) ([]byte, error) {
+	if f, ok := format.(BinaryFormat); ok {
+		return f.EncodeBytes(pin, account)
+	}
+
+	return encodeHexBytes(format, pin, account)
+}
+
+// DecodeBytes returns the PIN of the raw pinBlock decoded with format.
+// Formats that do not implement BinaryFormat decode the hex PIN block.
+//
+//	pin, err := formats.DecodeBytes(iso0, field52, "5432101234567891")
+func DecodeBytes(format Format, pinBlock []byte, account string) (string, error) {
+	if f, ok := format.(BinaryFormat); ok {
+		return f.DecodeBytes(pinBlock, account)
+	}
+
+	return format.Decode(fmt.Sprintf("%X", pinBlock), account)
+}
+
+// encodeBlockBytes returns the raw PIN block of a BlockFormat, without
+// formatting it as hex
+func encodeBlockBytes(format BlockFormat, pin, account string) ([]byte, error) {
+	digits := []byte(pin)
+	defer wipe(digits)
+
+	pinBlock, err := format.EncodeBlock(digits, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return pinBlock[:], nil
+}
+
+// decodeBlockBytes returns the PIN of a raw PIN block of a BlockFormat, the
+// decoded PIN buffer is wiped
+func decodeBlockBytes(format BlockFormat, pinBlock []byte, account string) (string, error) {
+	if len(pinBlock) != 8 {
+		return "", newError(describe(format), FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 8 bytes")
+	}
+
+	pin, err := format.DecodeBlock(nil, [8]byte(pinBlock), account)
+	defer wipe(pin)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pin), nil
+}
+
+// encodeHexBytes returns the raw PIN block of a format encoded as hex, for the
+// formats without a block path
+func encodeHexBytes(format Format, pin, account string) ([]byte, error) {
+	pinBlock, err := format.Encode(pin, account)
+	if err != nil {
+		return nil, err
+	}
+
+	rawPinBlock, err := hex.DecodeString(pinBlock)
+	if err != nil {
+		return nil, wrapError(describe(format), FieldNamePINBlock, ErrInvalidPINBlock, "decoding pinBlock", err)
+	}
+
+	return rawPinBlock, nil
+}
+
+// decodeHexBytes returns the PIN of a raw PIN block of an 8 byte format
+// decoded as hex, for the formats without a block path
+func decodeHexBytes(format Format, pinBlock []byte, account string) (string, error) {
+	if len(pinBlock) != 8 {
+		return "", newError(describe(format), FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 8 bytes")
+	}
+
+	return format.Decode(fmt.Sprintf("%X", pinBlock), account)
+}
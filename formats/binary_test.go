@@ -0,0 +1,166 @@
+package formats_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+// hexOnlyObject is a format that does not implement BinaryFormat
+type hexOnlyObject struct{}
+
+func (h *hexOnlyObject) SetDebugWriter(writer io.Writer) {}
+
+func (h *hexOnlyObject) Encode(pin, account string) (string, error) {
+	return pin + strings.Repeat("F", 16-len(pin)), nil
+}
+
+func (h *hexOnlyObject) Decode(pinBlock, account string) (string, error) {
+	return pinBlock[:4], nil
+}
+
+// keepingCipher is a cipher that does not encrypt and keeps the last
+// decrypted block, to check that it is wiped
+type keepingCipher struct {
+	decrypted []byte
+}
+
+func (k *keepingCipher) Encrypt(plainText []byte) ([]byte, error) {
+	return bytes.Clone(plainText), nil
+}
+
+func (k *keepingCipher) Decrypt(cipherText []byte) ([]byte, error) {
+	k.decrypted = bytes.Clone(cipherText)
+	return k.decrypted, nil
+}
+
+func TestBinaryFormat(t *testing.T) {
+	account := "5432101234567891"
+
+	t.Run("ISO-0", func(t *testing.T) {
+		iso0 := formats.NewISO0().(formats.BinaryFormat)
+
+		pinBlock, err := iso0.EncodeBytes("1234", account)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x04, 0x12, 0x15, 0xFE, 0xDC, 0xBA, 0x98, 0x76}, pinBlock)
+
+		pin, err := iso0.DecodeBytes(pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		_, err = iso0.DecodeBytes(pinBlock[:7], account)
+		require.EqualError(t, err, "pin block must be 8 bytes")
+	})
+
+	t.Run("all formats", func(t *testing.T) {
+		for _, name := range []string{
+			"ISO-0", "ISO-1", "ISO-2", "ISO-3", "ISO-4", "ANSI", "OEM-1",
+			"ECI1", "ECI2", "ECI3", "ECI4", "VISA1", "VISA2", "VISA3", "VISA4",
+		} {
+			format, err := formats.NewFormatter(name)
+			require.NoError(t, err)
+
+			pinBlock, err := formats.EncodeBytes(format, "1234", account)
+			require.NoError(t, err, name)
+
+			pin, err := formats.DecodeBytes(format, pinBlock, account)
+			require.NoError(t, err, name)
+			require.Equal(t, "1234", pin, name)
+		}
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		key, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+		require.NoError(t, err)
+
+		cipher, err := encryption.NewTdesECB(key)
+		require.NoError(t, err)
+
+		iso0, err := formats.NewFormatter("ISO-0", formats.WithCipher(cipher))
+		require.NoError(t, err)
+
+		pinBlock, err := formats.EncodeBytes(iso0, "1234", account)
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", fmt.Sprintf("%X", pinBlock))
+
+		pin, err := formats.DecodeBytes(iso0, pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		_, err = formats.DecodeBytes(iso0, append(pinBlock, 0), account)
+		require.EqualError(t, err, "pin block must be 8 bytes")
+
+		iso4 := formats.NewEncrypted(formats.NewISO4(encryption.NewNoOp()), cipher)
+
+		_, err = formats.EncodeBytes(iso4, "1234", account)
+		require.EqualError(t, err, "pin block must be 8 bytes")
+	})
+
+	t.Run("clear PIN blocks are wiped", func(t *testing.T) {
+		for _, format := range []formats.Format{formats.NewISO0(), formats.NewECI2()} {
+			cipher := &keepingCipher{}
+			encrypted := formats.NewEncrypted(format, cipher)
+
+			pinBlock, err := formats.EncodeBytes(encrypted, "1234", account)
+			require.NoError(t, err)
+
+			pin, err := formats.DecodeBytes(encrypted, pinBlock, account)
+			require.NoError(t, err)
+			require.Equal(t, "1234", pin)
+			require.Equal(t, make([]byte, 8), cipher.decrypted)
+		}
+
+		// the PIN block of the caller is not wiped by a cipher that returns it
+		encrypted := formats.NewEncrypted(formats.NewECI2(), encryption.NewNoOp())
+
+		pinBlock, err := formats.EncodeBytes(encrypted, "1234", account)
+		require.NoError(t, err)
+		require.NotEqual(t, make([]byte, 8), pinBlock)
+
+		_, err = formats.DecodeBytes(encrypted, pinBlock, account)
+		require.NoError(t, err)
+		require.NotEqual(t, make([]byte, 8), pinBlock)
+	})
+
+	t.Run("ISO-4", func(t *testing.T) {
+		cipher, err := encryption.NewAesECB([]byte("1234567890123456"))
+		require.NoError(t, err)
+
+		iso4 := formats.NewISO4(cipher)
+
+		pinBlock, err := formats.EncodeBytes(iso4, "1234", "432198765432109870")
+		require.NoError(t, err)
+		require.Len(t, pinBlock, 16)
+
+		pin, err := formats.DecodeBytes(iso4, pinBlock, "432198765432109870")
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		// the hex and binary forms are the same PIN block
+		pin, err = iso4.Decode(fmt.Sprintf("%x", pinBlock), "432198765432109870")
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		_, err = formats.DecodeBytes(iso4, pinBlock[:8], "432198765432109870")
+		require.EqualError(t, err, "pin block must be 16 bytes")
+	})
+
+	t.Run("format without binary encoding", func(t *testing.T) {
+		format := &hexOnlyObject{}
+
+		pinBlock, err := formats.EncodeBytes(format, "1234", account)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x12, 0x34, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, pinBlock)
+
+		pin, err := formats.DecodeBytes(format, pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+}
@@ -0,0 +1,189 @@
+package formats
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// BlockFormat is a Format with an allocation free path for the hot path of
+// PIN translation: PIN blocks are fixed arrays of 8 bytes and the decoded PIN
+// is appended to a buffer of the caller. ISO-0, ISO-1, ISO-2, ISO-3, the
+// formats that are the same (ANSI X9.8, ECI-1, ECI-4, VISA-1 and VISA-4) and
+// the encrypted formats that wrap them implement BlockFormat.
+//
+//	iso0 := formats.NewEncrypted(formats.NewISO0(), zpk).(formats.BlockFormat)
+//	pin := make([]byte, 0, 12)
+//	pin, err := iso0.DecodeBlock(pin[:0], field52, account)
+//
+// The encode and decode operations do not allocate, unless the format is
+// traced or returns an error, or the cipher of an encrypted format does not
+// implement BlockCipher.
+type BlockFormat interface {
+	Format
+
+	// EncodeBlock returns the PIN block of pin
+	EncodeBlock(pin []byte, account string) ([8]byte, error)
+
+	// DecodeBlock appends the PIN of pinBlock to dst and returns the
+	// extended buffer
+	DecodeBlock(dst []byte, pinBlock [8]byte, account string) ([]byte, error)
+}
+
+// Block16Format is the BlockFormat of the PIN blocks of 16 bytes, implemented
+// by ISO-4
+type Block16Format interface {
+	Format
+
+	// EncodeBlock returns the PIN block of pin
+	EncodeBlock(pin []byte, account string) ([16]byte, error)
+
+	// DecodeBlock appends the PIN of pinBlock to dst and returns the
+	// extended buffer
+	DecodeBlock(dst []byte, pinBlock [16]byte, account string) ([]byte, error)
+}
+
+var (
+	_ BlockFormat   = (*iso0Object)(nil)
+	_ BlockFormat   = (*iso1Object)(nil)
+	_ BlockFormat   = (*encryptedObject)(nil)
+	_ Block16Format = (*iso4Object)(nil)
+)
+
+// BlockCipher is a Cipher that encrypts and decrypts into a buffer of the
+// caller. The ciphers of the encryption package implement it, the block
+// formats use it to encrypt without allocating.
+type BlockCipher interface {
+	Cipher
+
+	EncryptTo(dst, plainText []byte) error
+	DecryptTo(dst, cipherText []byte) error
+}
+
+// blockBuffers are the buffers of the encryption of a PIN block. They are
+// pooled, the arguments of the methods of a Cipher escape to the heap.
+type blockBuffers struct {
+	in, out [16]byte
+}
+
+var blockBuffersPool = sync.Pool{
+	New: func() any {
+		return new(blockBuffers)
+	},
+}
+
+func getBlockBuffers() *blockBuffers {
+	return blockBuffersPool.Get().(*blockBuffers)
+}
+
+// putBlockBuffers wipes the buffers and returns them to the pool
+func putBlockBuffers(buffers *blockBuffers) {
+	wipe(buffers.in[:])
+	wipe(buffers.out[:])
+	blockBuffersPool.Put(buffers)
+}
+
+// encryptTo encrypts src into dst, in place when cipher is a BlockCipher
+func encryptTo(cipher Cipher, dst, src []byte) error {
+	if c, ok := cipher.(BlockCipher); ok {
+		return c.EncryptTo(dst, src)
+	}
+
+	cipherText, err := cipher.Encrypt(src)
+	if err != nil {
+		return err
+	}
+
+	if len(cipherText) != len(dst) {
+		return fmt.Errorf("cipher text length must be %d bytes", len(dst))
+	}
+	copy(dst, cipherText)
+
+	return nil
+}
+
+// decryptTo decrypts src into dst, in place when cipher is a BlockCipher
+func decryptTo(cipher Cipher, dst, src []byte) error {
+	if c, ok := cipher.(BlockCipher); ok {
+		return c.DecryptTo(dst, src)
+	}
+
+	plainText, err := cipher.Decrypt(src)
+	if err != nil {
+		return err
+	}
+
+	// ciphers that do not encrypt can return src
+	if len(plainText) > 0 && &plainText[0] != &src[0] {
+		defer wipe(plainText)
+	}
+
+	if len(plainText) != len(dst) {
+		return fmt.Errorf("plain text length must be %d bytes", len(dst))
+	}
+	copy(dst, plainText)
+
+	return nil
+}
+
+// fillField writes the fill of a PIN field to dst: filler repeated, or
+// random characters of table when there is no filler
+func fillField(dst []byte, filler string, table []byte) error {
+	if filler != "" {
+		for n := range dst {
+			dst[n] = filler[0]
+		}
+		return nil
+	}
+
+	if _, err := rand.Read(dst); err != nil {
+		return err
+	}
+	for n := range dst {
+		dst[n] = table[int(dst[n])%len(table)]
+	}
+
+	return nil
+}
+
+// packHex writes to dst the bytes of the hex characters of a XOR-ed with b,
+// nibble by nibble. b is nil when a is not XOR-ed.
+func packHex(dst, a, b []byte) error {
+	for n := 0; n < len(dst); n++ {
+		high, err := hexValue(a[2*n])
+		if err != nil {
+			return err
+		}
+
+		low, err := hexValue(a[2*n+1])
+		if err != nil {
+			return err
+		}
+
+		if b != nil {
+			x, err := hexValue(b[2*n])
+			if err != nil {
+				return err
+			}
+
+			y, err := hexValue(b[2*n+1])
+			if err != nil {
+				return err
+			}
+
+			high, low = high^x, low^y
+		}
+
+		dst[n] = high<<4 | low
+	}
+
+	return nil
+}
+
+// unpackHex writes to dst the upper case hex characters of src
+func unpackHex(dst, src []byte) {
+	for n, c := range src {
+		dst[2*n] = upperHex[c>>4]
+		dst[2*n+1] = upperHex[c&0x0F]
+	}
+}
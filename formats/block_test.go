@@ -0,0 +1,260 @@
+package formats_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockFormat(t *testing.T) {
+	account := "5432101234567891"
+
+	key, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	require.NoError(t, err)
+
+	tdes, err := encryption.NewTdesECB(key)
+	require.NoError(t, err)
+
+	t.Run("ISO-0", func(t *testing.T) {
+		iso0 := formats.NewISO0().(formats.BlockFormat)
+
+		pinBlock, err := iso0.EncodeBlock([]byte("1234"), account)
+		require.NoError(t, err)
+		require.Equal(t, "041215FEDCBA9876", fmt.Sprintf("%X", pinBlock[:]))
+
+		// the PIN is appended to dst
+		pin, err := iso0.DecodeBlock([]byte("PIN:"), pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "PIN:1234", string(pin))
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(formats.NewISO0(), tdes).(formats.BlockFormat)
+
+		pinBlock, err := iso0.EncodeBlock([]byte("1234"), account)
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", fmt.Sprintf("%X", pinBlock[:]))
+
+		pin, err := iso0.DecodeBlock(nil, pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", string(pin))
+
+		// the cipher is not required to implement BlockCipher
+		iso0 = formats.NewEncrypted(formats.NewISO0(), &hsmCipher{}).(formats.BlockFormat)
+
+		pinBlock, err = iso0.EncodeBlock([]byte("1234"), account)
+		require.NoError(t, err)
+		require.Equal(t, "041215FEDCBA9876", fmt.Sprintf("%X", pinBlock[:]))
+	})
+
+	t.Run("same as Encode", func(t *testing.T) {
+		for _, format := range []formats.Format{
+			formats.NewISO0(),
+			formats.NewISO1(),
+			formats.NewISO2(),
+			formats.NewISO3(),
+			formats.NewANSIX98(),
+			formats.NewECI4(),
+			formats.NewEncrypted(formats.NewISO3(), tdes),
+		} {
+			blockFormat := format.(formats.BlockFormat)
+
+			for _, pin := range []string{"1234", "123456789012"} {
+				pinBlock, err := blockFormat.EncodeBlock([]byte(pin), account)
+				require.NoError(t, err)
+
+				decoded, err := format.Decode(fmt.Sprintf("%X", pinBlock[:]), account)
+				require.NoError(t, err)
+				require.Equal(t, pin, decoded)
+
+				encoded, err := format.Encode(pin, account)
+				require.NoError(t, err)
+
+				rawPinBlock, err := hex.DecodeString(encoded)
+				require.NoError(t, err)
+
+				decodedPIN, err := blockFormat.DecodeBlock(nil, [8]byte(rawPinBlock), account)
+				require.NoError(t, err)
+				require.Equal(t, pin, string(decodedPIN))
+			}
+		}
+	})
+
+	t.Run("ISO-4", func(t *testing.T) {
+		aes, err := encryption.NewAesECB([]byte("1234567890123456"))
+		require.NoError(t, err)
+
+		iso4 := formats.NewISO4(aes)
+
+		pinBlock, err := iso4.(formats.Block16Format).EncodeBlock([]byte("1234"), account)
+		require.NoError(t, err)
+
+		pin, err := iso4.Decode(fmt.Sprintf("%X", pinBlock[:]), account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		// the cipher is not required to implement BlockCipher
+		iso4 = formats.NewISO4(encryption.NewNoOp())
+
+		pinBlock, err = iso4.(formats.Block16Format).EncodeBlock([]byte("1234"), "432198765432109870")
+		require.NoError(t, err)
+		require.Equal(t, "20202D2DCFE98BA3", fmt.Sprintf("%X", pinBlock[:8]))
+
+		decoded, err := iso4.(formats.Block16Format).DecodeBlock(nil, pinBlock, "432198765432109870")
+		require.NoError(t, err)
+		require.Equal(t, "1234", string(decoded))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		iso0 := formats.NewISO0().(formats.BlockFormat)
+
+		_, err := iso0.EncodeBlock([]byte("123"), account)
+		require.ErrorIs(t, err, formats.ErrInvalidPINLength)
+
+		_, err = iso0.EncodeBlock([]byte("12G4"), account)
+		require.ErrorIs(t, err, formats.ErrInvalidPIN)
+
+		_, err = formats.NewISO1().(formats.BlockFormat).EncodeBlock([]byte("12G4"), "")
+		require.ErrorIs(t, err, formats.ErrInvalidPIN)
+
+		pin, err := iso0.DecodeBlock([]byte("PIN:"), [8]byte{0x34, 0x12, 0x15, 0xFE, 0xDC, 0xBA, 0x98, 0x76}, account)
+		require.ErrorIs(t, err, formats.ErrFormatMismatch)
+		require.Equal(t, "PIN:", string(pin))
+
+		eci2 := formats.NewEncrypted(formats.NewECI2(), tdes).(formats.BlockFormat)
+		_, err = eci2.EncodeBlock([]byte("1234"), account)
+		require.ErrorIs(t, err, formats.ErrUnsupportedFormat)
+		require.EqualError(t, err, "format does not support fixed size pin blocks")
+	})
+}
+
+// raceEnabled is set when the tests are run with the race detector
+var raceEnabled bool
+
+func TestBlockFormatAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not measured with the race detector")
+	}
+
+	account := "5432101234567891"
+	digits := []byte("1234")
+
+	tdes, err := encryption.NewTdesECB([]byte("0123456789ABCDEF01234567"))
+	require.NoError(t, err)
+
+	aes, err := encryption.NewAesECB([]byte("1234567890123456"))
+	require.NoError(t, err)
+
+	for name, format := range map[string]formats.BlockFormat{
+		"ISO-0":     formats.NewISO0().(formats.BlockFormat),
+		"ISO-1":     formats.NewISO1().(formats.BlockFormat),
+		"ISO-2":     formats.NewISO2().(formats.BlockFormat),
+		"ISO-3":     formats.NewISO3().(formats.BlockFormat),
+		"encrypted": formats.NewEncrypted(formats.NewISO0(), tdes).(formats.BlockFormat),
+	} {
+		pin := make([]byte, 0, 12)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			pinBlock, err := format.EncodeBlock(digits, account)
+			if err != nil {
+				panic(err)
+			}
+
+			pin, err = format.DecodeBlock(pin[:0], pinBlock, account)
+			if err != nil {
+				panic(err)
+			}
+		})
+		require.Zero(t, allocs, name)
+		require.Equal(t, "1234", string(pin), name)
+	}
+
+	iso4 := formats.NewISO4(aes).(formats.Block16Format)
+	pin := make([]byte, 0, 12)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		pinBlock, err := iso4.EncodeBlock(digits, account)
+		if err != nil {
+			panic(err)
+		}
+
+		pin, err = iso4.DecodeBlock(pin[:0], pinBlock, account)
+		if err != nil {
+			panic(err)
+		}
+	})
+	require.Zero(t, allocs, "ISO-4")
+	require.Equal(t, "1234", string(pin))
+}
+
+func BenchmarkEncode(b *testing.B) {
+	iso0 := formats.NewISO0()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := iso0.Encode("1234", "5432101234567891"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeBlock(b *testing.B) {
+	iso0 := formats.NewISO0().(formats.BlockFormat)
+	pin := []byte("1234")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := iso0.EncodeBlock(pin, "5432101234567891"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBlock(b *testing.B) {
+	iso0 := formats.NewISO0().(formats.BlockFormat)
+	pinBlock := [8]byte{0x04, 0x12, 0x15, 0xFE, 0xDC, 0xBA, 0x98, 0x76}
+	pin := make([]byte, 0, 12)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var err error
+		if pin, err = iso0.DecodeBlock(pin[:0], pinBlock, "5432101234567891"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTranslateBlock translates an ISO-0 PIN block under a TDES key to
+// an ISO-4 PIN block under an AES key
+func BenchmarkTranslateBlock(b *testing.B) {
+	account := "5432101234567891"
+
+	tdes, err := encryption.NewTdesECB([]byte("0123456789ABCDEF01234567"))
+	require.NoError(b, err)
+
+	aes, err := encryption.NewAesECB([]byte("1234567890123456"))
+	require.NoError(b, err)
+
+	from := formats.NewEncrypted(formats.NewISO0(), tdes).(formats.BlockFormat)
+	to := formats.NewISO4(aes).(formats.Block16Format)
+
+	pinBlock, err := from.EncodeBlock([]byte("1234"), account)
+	require.NoError(b, err)
+
+	pin := make([]byte, 0, 12)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if pin, err = from.DecodeBlock(pin[:0], pinBlock, account); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err = to.EncodeBlock(pin, account); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package formats
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// settings holds the tracer and the validation of a format. They are read
+// once by every operation and can be replaced while the format is in use.
+type settings struct {
+	tracerPtr     atomic.Pointer[Tracer]
+	validationPtr atomic.Pointer[Validation]
+}
+
+func (s *settings) tracer() Tracer {
+	if tracer := s.tracerPtr.Load(); tracer != nil {
+		return *tracer
+	}
+	return nil
+}
+
+func (s *settings) setTracer(tracer Tracer) {
+	s.tracerPtr.Store(&tracer)
+}
+
+func (s *settings) validation() Validation {
+	if validation := s.validationPtr.Load(); validation != nil {
+		return *validation
+	}
+	return Validation{}
+}
+
+func (s *settings) setValidation(validation Validation) {
+	s.validationPtr.Store(&validation)
+}
+
+// ContextCipher is a Cipher that takes the context of the operation, such as
+// the client of a hardware security module. EncodeContext and DecodeContext
+// pass their context to it.
+type ContextCipher interface {
+	Cipher
+
+	EncryptContext(ctx context.Context, plainText []byte) ([]byte, error)
+	DecryptContext(ctx context.Context, cipherText []byte) ([]byte, error)
+}
+
+// contextCipher is the cipher of a single operation, it stops once ctx is
+// done
+type contextCipher struct {
+	ctx    context.Context
+	cipher Cipher
+}
+
+func (c *contextCipher) Encrypt(plainText []byte) ([]byte, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if cipher, ok := c.cipher.(ContextCipher); ok {
+		return cipher.EncryptContext(c.ctx, plainText)
+	}
+
+	return c.cipher.Encrypt(plainText)
+}
+
+func (c *contextCipher) Decrypt(cipherText []byte) ([]byte, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if cipher, ok := c.cipher.(ContextCipher); ok {
+		return cipher.DecryptContext(c.ctx, cipherText)
+	}
+
+	return c.cipher.Decrypt(cipherText)
+}
+
+// EncodeContext returns the PIN block of pin and account encoded by format,
+// with options that apply to this call only: the tracer, the validation, the
+// filler and the cipher. The cipher of format is replaced, or the PIN block is
+// encrypted with it when format is not encrypted. format is not modified.
+//
+// The context is checked before the PIN block is encoded and is passed to
+// the cipher, errors.Is(err, context.Canceled) reports a canceled call.
+//
+//	// iso0 is shared by the goroutines
+//	pinBlock, err := formats.EncodeContext(ctx, iso0, pin, account,
+//		formats.WithTracer(requestTracer),
+//		formats.WithCipher(acquirerZPK),
+//	)
+func EncodeContext(ctx context.Context, format Format, pin, account string, opts ...Option) (string, error) {
+	f, err := withOptions(ctx, format, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return f.Encode(pin, account)
+}
+
+// DecodeContext returns the PIN of a PIN block decoded by format, with
+// options that apply to this call only, like EncodeContext
+func DecodeContext(ctx context.Context, format Format, pinBlock, account string, opts ...Option) (string, error) {
+	f, err := withOptions(ctx, format, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return f.Decode(pinBlock, account)
+}
+
+// copyable is a format of this package, copied to apply the options of a
+// call
+type copyable interface {
+	Format
+
+	copy() copyable
+	tracer() Tracer
+	setTracer(tracer Tracer)
+	validation() Validation
+	setValidation(validation Validation)
+}
+
+// withOptions returns the format of a single call, a copy of format with the
+// options and the context. Other formats are returned as is when there are
+// no options.
+func withOptions(ctx context.Context, format Format, opts []Option) (Format, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// an encrypted format is replaced by a copy of the format it wraps,
+	// encrypted with the cipher of the call
+	var cipher Cipher
+	inner := format
+	if e, ok := format.(*encryptedObject); ok {
+		inner, cipher = e.format, e.cipher
+	}
+
+	source, ok := inner.(copyable)
+	if !ok {
+		if len(opts) == 0 {
+			return format, nil
+		}
+		return nil, newError(describe(format), FieldNameFormat, ErrUnsupportedFormat, "format does not support call options")
+	}
+
+	f := source.copy()
+	if iso4, ok := f.(*iso4Object); ok {
+		cipher = iso4.getCipher()
+	}
+
+	options := Options{
+		Cipher:     cipher,
+		Tracer:     f.tracer(),
+		Validation: f.validation(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.Filler != "" {
+		if err := setFiller(f, options.Filler); err != nil {
+			return nil, err
+		}
+	}
+
+	f.setTracer(options.Tracer)
+	f.setValidation(options.Validation)
+
+	if options.Cipher == nil {
+		return f, nil
+	}
+
+	cipher = &contextCipher{ctx: ctx, cipher: options.Cipher}
+	if iso4, ok := f.(*iso4Object); ok {
+		iso4.SetCipher(cipher)
+		return iso4, nil
+	}
+
+	return NewEncrypted(f, cipher), nil
+}
+
+// copySettings sets the tracer and the validation of a copy of a format
+func copySettings(dst, src copyable) copyable {
+	dst.setTracer(src.tracer())
+	dst.setValidation(src.validation())
+	return dst
+}
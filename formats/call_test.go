@@ -0,0 +1,268 @@
+package formats_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+// contextKey is the key of the request id of the contexts of the tests
+type contextKey struct{}
+
+// hsmCipher is a ContextCipher that records the request id of the last call
+// and returns the data unchanged
+type hsmCipher struct {
+	requestID any
+}
+
+func (c *hsmCipher) Encrypt(plainText []byte) ([]byte, error) {
+	return c.EncryptContext(context.Background(), plainText)
+}
+
+func (c *hsmCipher) Decrypt(cipherText []byte) ([]byte, error) {
+	return c.DecryptContext(context.Background(), cipherText)
+}
+
+func (c *hsmCipher) EncryptContext(ctx context.Context, plainText []byte) ([]byte, error) {
+	c.requestID = ctx.Value(contextKey{})
+	return bytes.Clone(plainText), nil
+}
+
+func (c *hsmCipher) DecryptContext(ctx context.Context, cipherText []byte) ([]byte, error) {
+	c.requestID = ctx.Value(contextKey{})
+	return bytes.Clone(cipherText), nil
+}
+
+func TestCallOptions(t *testing.T) {
+	ctx := context.Background()
+	account := "5432101234567891"
+
+	key, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	require.NoError(t, err)
+
+	tdes, err := encryption.NewTdesECB(key)
+	require.NoError(t, err)
+
+	t.Run("tracer", func(t *testing.T) {
+		iso0 := formats.NewISO0()
+
+		var events []formats.TraceEvent
+		tracer := formats.TracerFunc(func(event formats.TraceEvent) {
+			events = append(events, event)
+		})
+
+		pinBlock, err := formats.EncodeContext(ctx, iso0, "1234", account, formats.WithTracer(tracer))
+		require.NoError(t, err)
+		require.Equal(t, "041215FEDCBA9876", pinBlock)
+
+		pin, err := formats.DecodeContext(ctx, iso0, pinBlock, account, formats.WithTracer(tracer))
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		require.Len(t, events, 2)
+		require.Equal(t, formats.StepEncode, events[0].Step)
+		require.Equal(t, formats.StepDecode, events[1].Step)
+
+		// the tracer of the format is not changed
+		_, err = iso0.Encode("1234", account)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+	})
+
+	t.Run("tracer off", func(t *testing.T) {
+		iso0 := formats.NewISO0()
+
+		var buf bytes.Buffer
+		iso0.SetDebugWriter(&buf)
+
+		_, err := formats.EncodeContext(ctx, iso0, "1234", account, formats.WithTracer(nil))
+		require.NoError(t, err)
+		require.Empty(t, buf.String())
+
+		_, err = formats.EncodeContext(ctx, iso0, "1234", account)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), "PIN block encode operation finished")
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		iso0 := formats.NewISO0()
+
+		_, err := formats.EncodeContext(ctx, iso0, "1234", account, formats.WithValidation(formats.StrictValidation))
+		require.ErrorIs(t, err, formats.ErrInvalidAccount)
+
+		_, err = iso0.Encode("1234", account)
+		require.NoError(t, err)
+	})
+
+	t.Run("filler", func(t *testing.T) {
+		pinBlock, err := formats.EncodeContext(ctx, formats.NewISO0(), "1234", account, formats.WithFiller("A"))
+		require.NoError(t, err)
+		require.Equal(t, "041215AB89EFCD23", pinBlock)
+
+		_, err = formats.EncodeContext(ctx, formats.NewISO3(), "1234", account, formats.WithFiller("A"))
+		require.ErrorIs(t, err, formats.ErrInvalidFiller)
+	})
+
+	t.Run("cipher", func(t *testing.T) {
+		pinBlock, err := formats.EncodeContext(ctx, formats.NewISO0(), "1234", account, formats.WithCipher(tdes))
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", pinBlock)
+
+		pin, err := formats.DecodeContext(ctx, formats.NewISO0(), pinBlock, account, formats.WithCipher(tdes))
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		// the cipher of an encrypted format is replaced
+		wrongKey, err := encryption.NewTdesECB([]byte("0123456789ABCDEF01234567"))
+		require.NoError(t, err)
+
+		iso0 := formats.NewEncrypted(formats.NewISO0(), wrongKey)
+		pin, err = formats.DecodeContext(ctx, iso0, pinBlock, account, formats.WithCipher(tdes))
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("ISO-4 cipher", func(t *testing.T) {
+		key, err := encryption.NewAesECB([]byte("1234567890123456"))
+		require.NoError(t, err)
+
+		otherKey, err := encryption.NewAesECB([]byte("6543210987654321"))
+		require.NoError(t, err)
+
+		iso4 := formats.NewISO4(otherKey)
+
+		pinBlock, err := formats.EncodeContext(ctx, iso4, "1234", account, formats.WithCipher(key))
+		require.NoError(t, err)
+
+		pin, err := formats.NewISO4(key).Decode(pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		_, err = iso4.Decode(pinBlock, account)
+		require.Error(t, err)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		cipher := &hsmCipher{}
+		iso4 := formats.NewISO4(cipher)
+
+		requestCtx := context.WithValue(ctx, contextKey{}, "request-1")
+		pinBlock, err := formats.EncodeContext(requestCtx, iso4, "1234", account)
+		require.NoError(t, err)
+		require.Equal(t, "request-1", cipher.requestID)
+
+		canceled, cancel := context.WithCancel(requestCtx)
+		cancel()
+
+		_, err = formats.DecodeContext(canceled, iso4, pinBlock, account)
+		require.ErrorIs(t, err, context.Canceled)
+
+		_, err = formats.EncodeContext(canceled, formats.NewISO0(), "1234", account)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("other formats", func(t *testing.T) {
+		pinBlock, err := formats.EncodeContext(ctx, &hexOnlyObject{}, "1234", account)
+		require.NoError(t, err)
+		require.Equal(t, "1234FFFFFFFFFFFF", pinBlock)
+
+		_, err = formats.EncodeContext(ctx, &hexOnlyObject{}, "1234", account, formats.WithTracer(nil))
+		require.ErrorIs(t, err, formats.ErrUnsupportedFormat)
+		require.EqualError(t, err, "format does not support call options")
+	})
+}
+
+func TestConcurrentUse(t *testing.T) {
+	account := "4111111111111111"
+
+	aes, err := encryption.NewAesECB([]byte("1234567890123456"))
+	require.NoError(t, err)
+
+	tdes, err := encryption.NewTdesECB([]byte("0123456789ABCDEF01234567"))
+	require.NoError(t, err)
+
+	tests := map[string]formats.Format{
+		"ISO-0":     formats.NewISO0(),
+		"ISO-1":     formats.NewISO1(),
+		"ISO-2":     formats.NewISO2(),
+		"ISO-3":     formats.NewISO3(),
+		"ISO-4":     formats.NewISO4(aes),
+		"OEM-1":     formats.NewOEM1(),
+		"ECI2":      formats.NewECI2(),
+		"ECI3":      formats.NewECI3(),
+		"VISA2":     formats.NewVISA2(),
+		"VISA3":     formats.NewVISA3(),
+		"encrypted": formats.NewEncrypted(formats.NewISO0(), tdes),
+	}
+
+	for name, format := range tests {
+		t.Run(name, func(t *testing.T) {
+			// the writer tracer serializes the events written to buf
+			var buf bytes.Buffer
+			writerTracer := formats.NewWriterTracer(&buf, nil)
+			formats.SetTracer(format, writerTracer)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 8)
+
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+
+					ctx := context.Background()
+					pin := fmt.Sprintf("%04d", 1000+g)
+					tracer := formats.TracerFunc(func(event formats.TraceEvent) {})
+
+					for i := 0; i < 50; i++ {
+						pinBlock, err := format.Encode(pin, account)
+						if err != nil {
+							errs <- err
+							return
+						}
+
+						decoded, err := formats.DecodeContext(ctx, format, pinBlock, account, formats.WithTracer(tracer))
+						if err != nil {
+							errs <- err
+							return
+						}
+
+						if decoded != pin {
+							errs <- fmt.Errorf("decoded %s, expected %s", decoded, pin)
+							return
+						}
+					}
+				}(g)
+			}
+
+			// the settings are replaced while the format is in use
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for i := 0; i < 50; i++ {
+					formats.SetValidation(format, formats.Validation{NumericPIN: i%2 == 0})
+					if i%2 == 0 {
+						formats.SetTracer(format, nil)
+					} else {
+						formats.SetTracer(format, writerTracer)
+					}
+				}
+			}()
+
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package formats
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/moov-io/pinblock/encryption"
+)
+
+// Candidate is a format that parses a clear PIN block
+type Candidate struct {
+	// Name is the name of the format in the registry
+	Name string
+
+	// PIN is the PIN decoded with the format
+	PIN string
+
+	// Confidence is between 0 and 1, the bits of structure of the format
+	// (control field, PIN length, PIN digits, fill) found in the PIN block
+	// divided by the bits of structure of the format. A PIN block produced by
+	// the format has a confidence of 1.
+	Confidence float64
+
+	// Bits are the bits of structure of the format found in the PIN block.
+	// The candidates are ranked by them: formats with a random fill, such as
+	// ISO-1 or ECI-2, parse most blocks but match few bits.
+	Bits float64
+}
+
+// weights of the nibbles of a template, the bits of structure they carry
+var (
+	fixedWeight  = 4.0
+	digitWeight  = math.Log2(16.0 / 10.0)
+	letterWeight = math.Log2(16.0 / 6.0)
+)
+
+// detector parses a clear PIN block with a format and returns the template of
+// the PIN block the format would have produced for the decoded PIN.
+//
+// A template has one character per nibble: a hex character is a fixed value,
+// d is a decimal digit, l is a letter from A to F, = repeats the previous
+// nibble and * is any value.
+type detector struct {
+	name          string
+	newFormat     func() Format
+	length        int
+	accountNeeded bool
+	clearField    func(pinBlock, account string) (string, error)
+	template      func(pin string) string
+}
+
+var detectors = []detector{
+	{
+		name:          "ISO-0",
+		newFormat:     NewISO0,
+		length:        16,
+		accountNeeded: true,
+		clearField:    iso0ClearField,
+		template: func(pin string) string {
+			return fmt.Sprintf("0%X%s%s", len(pin), repeat("d", len(pin)), repeat("F", 14-len(pin)))
+		},
+	},
+	{
+		name:      "ISO-1",
+		newFormat: NewISO1,
+		length:    16,
+		template: func(pin string) string {
+			return fmt.Sprintf("1%X%s", len(pin), repeat("d", 14))
+		},
+	},
+	{
+		name:      "ISO-2",
+		newFormat: NewISO2,
+		length:    16,
+		template: func(pin string) string {
+			return fmt.Sprintf("2%X%s%s", len(pin), repeat("d", len(pin)), repeat("F", 14-len(pin)))
+		},
+	},
+	{
+		name:          "ISO-3",
+		newFormat:     NewISO3,
+		length:        16,
+		accountNeeded: true,
+		clearField:    iso0ClearField,
+		template: func(pin string) string {
+			return fmt.Sprintf("3%X%s%s", len(pin), repeat("d", len(pin)), repeat("l", 14-len(pin)))
+		},
+	},
+	{
+		name: "ISO-4",
+		newFormat: func() Format {
+			return NewISO4(encryption.NewNoOp())
+		},
+		length:        32,
+		accountNeeded: true,
+		clearField:    iso4ClearField,
+		template: func(pin string) string {
+			// the second half of the PIN field is random and not matched
+			return fmt.Sprintf("4%X%s%s", len(pin), repeat("d", len(pin)), repeat("A", 14-len(pin)))
+		},
+	},
+	{
+		name:      "OEM-1",
+		newFormat: NewOEM1,
+		length:    16,
+		template: func(pin string) string {
+			// the pad value is the same for the whole pad
+			return repeat("d", len(pin)) + "*" + repeat("=", 15-len(pin))
+		},
+	},
+	{
+		name:      "ECI2",
+		newFormat: NewECI2,
+		length:    16,
+		template: func(pin string) string {
+			return repeat("d", 4) + repeat("*", 12)
+		},
+	},
+	{
+		name:      "ECI3",
+		newFormat: NewECI3,
+		length:    16,
+		template: func(pin string) string {
+			return fmt.Sprintf("%d%s%s%s", len(pin), repeat("d", len(pin)), repeat("0", 6-len(pin)), repeat("*", 9))
+		},
+	},
+	{
+		name:      "VISA2",
+		newFormat: NewVISA2,
+		length:    16,
+		template: func(pin string) string {
+			return fmt.Sprintf("%d%s%s%s", len(pin), repeat("d", len(pin)), repeat("0", 6-len(pin)), repeat("d", 9))
+		},
+	},
+	{
+		name:      "VISA3",
+		newFormat: NewVISA3,
+		length:    16,
+		template: func(pin string) string {
+			return repeat("d", len(pin)) + "Fl" + repeat("=", 14-len(pin))
+		},
+	},
+}
+
+// Detect returns the formats that parse the clear pinBlock, ranked by the bits
+// of structure they match, with the PIN decoded by each of them. The formats that bind the
+// PIN to the account (ISO-0, ISO-3 and ISO-4) are only tried when the account
+// is given. An empty list is returned when no format parses the PIN block.
+//
+//	candidates, err := formats.Detect("041215FEDCBA9876", "5432101234567891")
+//	// candidates[0].Name is ISO-0, candidates[0].PIN is 1234
+//
+// The candidates contain clear PINs, they should not be logged.
+func Detect(pinBlock, account string) ([]Candidate, error) {
+	if len(pinBlock) != 16 && len(pinBlock) != 32 {
+		return nil, newError("", FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 or 32 characters")
+	}
+
+	if _, err := hex.DecodeString(pinBlock); err != nil {
+		return nil, wrapError("", FieldNamePINBlock, ErrInvalidPINBlock, "decoding pin block", err)
+	}
+
+	pinBlock = strings.ToUpper(pinBlock)
+
+	candidates := []Candidate{}
+
+	for _, d := range detectors {
+		if d.length != len(pinBlock) || (d.accountNeeded && account == "") {
+			continue
+		}
+
+		// the fill is rated by the template rather than checked
+		format := d.newFormat()
+		SetValidation(format, Validation{LenientDecode: true})
+
+		pin, err := format.Decode(pinBlock, account)
+		if err != nil {
+			continue
+		}
+
+		if len(pin) < 4 || len(pin) > 12 || !isDecimal(pin) {
+			continue
+		}
+
+		field := pinBlock
+		if d.clearField != nil {
+			field, err = d.clearField(pinBlock, account)
+			if err != nil {
+				continue
+			}
+		}
+
+		bits, structure := matchTemplate(strings.ToUpper(field), d.template(pin))
+		if structure == 0 {
+			continue
+		}
+
+		candidates = append(candidates, Candidate{
+			Name:       d.name,
+			PIN:        pin,
+			Confidence: bits / structure,
+			Bits:       bits,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Bits > candidates[j].Bits
+	})
+
+	return candidates, nil
+}
+
+// matchTemplate returns the bits of structure of template found in field and
+// the bits of structure of template, the * nibbles have none
+func matchTemplate(field, template string) (matched, structure float64) {
+	if len(field) < len(template) {
+		return 0, 0
+	}
+
+	for i := 0; i < len(template); i++ {
+		var weight float64
+		var ok bool
+
+		switch template[i] {
+		case '*':
+			continue
+		case 'd':
+			weight = digitWeight
+			ok = field[i] >= '0' && field[i] <= '9'
+		case 'l':
+			weight = letterWeight
+			ok = field[i] >= 'A' && field[i] <= 'F'
+		case '=':
+			weight = fixedWeight
+			ok = i > 0 && field[i] == field[i-1]
+		default:
+			weight = fixedWeight
+			ok = field[i] == template[i]
+		}
+
+		structure += weight
+		if ok {
+			matched += weight
+		}
+	}
+
+	return matched, structure
+}
+
+// iso0ClearField returns the PIN field of an ISO-0 or ISO-3 PIN block
+func iso0ClearField(pinBlock, account string) (string, error) {
+	if len(account) < 13 {
+		return "", fmt.Errorf("account length must be at least 13 digits")
+	}
+
+	accountField := iso0AccountField(account)
+	return clearField(pinBlock, accountField[:])
+}
+
+// iso4ClearField returns the PIN field of a clear ISO-4 PIN block, the PIN
+// block XOR-ed with the PAN field
+func iso4ClearField(pinBlock, account string) (string, error) {
+	if len(account) < 12 || len(account) > 19 {
+		return "", fmt.Errorf("account length must be between 12 and 19 digits")
+	}
+
+	panField := iso4PanField(account)
+	return clearField(pinBlock, panField[:])
+}
+
+// clearField returns the hex pinBlock XOR-ed with the hex field of the same
+// length
+func clearField(pinBlock string, field []byte) (string, error) {
+	rawField := make([]byte, len(field)/2)
+	defer wipe(rawField)
+
+	if err := packHex(rawField, []byte(pinBlock), field); err != nil {
+		return "", err
+	}
+
+	clear := make([]byte, len(field))
+	defer wipe(clear)
+	unpackHex(clear, rawField)
+
+	return string(clear), nil
+}
+
+func repeat(s string, count int) string {
+	if count < 0 {
+		return ""
+	}
+	return strings.Repeat(s, count)
+}
+
+func isDecimal[T string | []byte](s T) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
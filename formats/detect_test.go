@@ -0,0 +1,101 @@
+package formats_test
+
+import (
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	account := "5432101234567891"
+
+	names := func(candidates []formats.Candidate) []string {
+		var names []string
+		for _, c := range candidates {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	t.Run("ISO-0", func(t *testing.T) {
+		candidates, err := formats.Detect("041215FEDCBA9876", account)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ISO-0", "VISA3", "ECI2"}, names(candidates))
+		require.Equal(t, "1234", candidates[0].PIN)
+		require.InDelta(t, 1, candidates[0].Confidence, 1e-9)
+		require.InDelta(t, 50.71, candidates[0].Bits, 0.01)
+
+		// the length and the fill of VISA3 do not match
+		require.InDelta(t, 0.23, candidates[1].Confidence, 0.01)
+		require.InDelta(t, 9.48, candidates[1].Bits, 0.01)
+
+		// formats bound to the account are not tried without it
+		candidates, err = formats.Detect("041215FEDCBA9876", "")
+		require.NoError(t, err)
+		require.NotContains(t, names(candidates), "ISO-0")
+	})
+
+	t.Run("ISO-2 is ranked above the formats that also parse it", func(t *testing.T) {
+		candidates, err := formats.Detect("241234ffffffffff", "")
+		require.NoError(t, err)
+		require.Equal(t, []string{"ISO-2", "VISA3", "OEM-1", "ECI2"}, names(candidates))
+		require.Equal(t, "1234", candidates[0].PIN)
+		require.Equal(t, "241234", candidates[1].PIN)
+	})
+
+	t.Run("random fill", func(t *testing.T) {
+		candidates, err := formats.Detect("1412345678901234", "")
+		require.NoError(t, err)
+		require.Equal(t, []string{"ISO-1", "ECI2"}, names(candidates))
+		require.Equal(t, "1234", candidates[0].PIN)
+
+		// the block matches ISO-1, which has little structure
+		require.InDelta(t, 1, candidates[0].Confidence, 1e-9)
+		require.InDelta(t, 17.49, candidates[0].Bits, 0.01)
+	})
+
+	t.Run("encoded blocks", func(t *testing.T) {
+		for _, name := range []string{"ISO-0", "ISO-2", "ISO-3", "OEM-1", "VISA2", "VISA3"} {
+			format, err := formats.NewFormatter(name)
+			require.NoError(t, err)
+
+			pinBlock, err := format.Encode("1234", account)
+			require.NoError(t, err)
+
+			candidates, err := formats.Detect(pinBlock, account)
+			require.NoError(t, err)
+			require.NotEmpty(t, candidates, name)
+			require.Equal(t, name, candidates[0].Name, pinBlock)
+			require.Equal(t, "1234", candidates[0].PIN, name)
+		}
+	})
+
+	t.Run("ISO-4", func(t *testing.T) {
+		account := "432198765432109870"
+
+		pinBlock, err := formats.NewISO4(encryption.NewNoOp()).Encode("1234", account)
+		require.NoError(t, err)
+
+		candidates, err := formats.Detect(pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ISO-4"}, names(candidates))
+		require.Equal(t, "1234", candidates[0].PIN)
+		require.InDelta(t, 1, candidates[0].Confidence, 1e-9)
+	})
+
+	t.Run("no candidate", func(t *testing.T) {
+		candidates, err := formats.Detect("ABCDEFABCDEFABCD", "")
+		require.NoError(t, err)
+		require.Empty(t, candidates)
+	})
+
+	t.Run("invalid pin block", func(t *testing.T) {
+		_, err := formats.Detect("0412", account)
+		require.EqualError(t, err, "pin block must be 16 or 32 characters")
+
+		_, err = formats.Detect("0412ZZFEDCBA9876", account)
+		require.ErrorContains(t, err, "decoding pin block")
+	})
+}
@@ -4,13 +4,12 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"text/tabwriter"
 )
 
 type eciObject struct {
-	format      string
-	version     string
-	debugWriter io.Writer
+	format  string
+	version string
+	settings
 }
 
 func (i *eciObject) getVersion() string {
@@ -20,13 +19,22 @@ func (i *eciObject) getVersion() string {
 	return eci2Version
 }
 
+// maxPINLength returns the number of PIN digits of the PIN block, longer PINs
+// are truncated
+func (i *eciObject) maxPINLength() int {
+	if i.getVersion() == eci2Version {
+		return 4
+	}
+	return 6
+}
+
 // Padding returns padding pattern
-func (i *eciObject) padding(pin string) (string, error) {
-	if len(pin) < 4 {
-		return "", fmt.Errorf("pin length must be between 4 and 12 digits")
+func (i *eciObject) padding(pinFieldLength int) (string, error) {
+	if pinFieldLength < 4 {
+		return "", newError(i.format, FieldNamePIN, ErrInvalidPINLength, "pin length must be between 4 and 12 digits")
 	}
 
-	length := 16 - len(pin)
+	length := 16 - pinFieldLength
 	t := hexLetters
 	if i.getVersion() == visa2Version {
 		t = hexDigits
@@ -34,111 +42,210 @@ func (i *eciObject) padding(pin string) (string, error) {
 	return randomLetters(length, t)
 }
 
-// SetDebugWriter will set writer for getting output message of encoding and decoding logic
+// SetDebugWriter will set writer for getting output message of encoding and decoding logic,
+// the PAN and the PIN are masked
 func (i *eciObject) SetDebugWriter(writer io.Writer) {
-	i.debugWriter = tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	i.setTracer(NewWriterTracer(writer, DefaultMask))
+}
+
+// SetTracer sets the tracer of the encode and decode operations
+func (i *eciObject) SetTracer(tracer Tracer) {
+	i.setTracer(tracer)
+}
+
+// SetValidation sets the checks of the PIN and the account
+func (i *eciObject) SetValidation(validation Validation) {
+	i.setValidation(validation)
+}
+
+// copy returns a copy of the format with the same settings
+func (i *eciObject) copy() copyable {
+	return copySettings(&eciObject{format: i.format, version: i.version}, i)
 }
 
 // Encode returns the OEM-1 PIN block for the given PIN
 func (i *eciObject) Encode(pin, account string) (string, error) {
+	return encodeString(i.encode, pin, account)
+}
+
+// EncodePIN returns the PIN block for the given PIN, the PIN is wiped
+func (i *eciObject) EncodePIN(pin *PIN, account string) (string, error) {
+	defer pin.Wipe()
+	return i.encode(pin.Bytes(), account)
+}
+
+func (i *eciObject) encode(pin []byte, account string) (string, error) {
+	validation := i.validation()
+
+	if err := validation.checkPIN(i.format, pin, i.maxPINLength()); err != nil {
+		return "", err
+	}
+
+	if err := validation.checkAccount(i.format, account, false); err != nil {
+		return "", err
+	}
+
 	isTruncated := false
 
 	if len(pin) < 4 || len(pin) > 12 {
-		return "", fmt.Errorf("pin length must be between 4 and 12 digits")
+		return "", newError(i.format, FieldNamePIN, ErrInvalidPINLength, "pin length must be between 4 and 12 digits")
 	}
 
-	var rawPin string
+	pinBlock := make([]byte, 16)
+	defer wipe(pinBlock)
+
+	var rawPin []byte
+	var pinFieldLength int
 	if i.getVersion() == eci2Version {
 		if len(pin) > 4 {
 			pin = pin[:4]
 			isTruncated = true
 		}
 		rawPin = pin
+		pinFieldLength = copy(pinBlock, pin)
 	} else {
 		if len(pin) > 6 {
 			pin = pin[:6]
 			isTruncated = true
 		}
 		rawPin = pin
-		pin = fmt.Sprintf("%d%s", len(pin), pin)
-		pin = pin + strings.Repeat("0", 7-len(pin))
+
+		// length of pin, then pin, then 0 until 7 characters
+		pinBlock[0] = upperHex[len(pin)]
+		copy(pinBlock[1:], pin)
+		for j := 1 + len(pin); j < 7; j++ {
+			pinBlock[j] = '0'
+		}
+		pinFieldLength = 7
 	}
 
-	pad, err := i.padding(pin)
+	pad, err := i.padding(pinFieldLength)
 	if err != nil {
 		return "", err
 	}
 
 	// Pad value has a 4-bit value from X’0′ to X’F’ and must be different from any PIN digit.
 	// The number of pad values for this format is in the range from 4 to 12, and all the pad values must have the same value.
-	pinBlock := fmt.Sprintf("%s%s", pin, pad)
+	copy(pinBlock[pinFieldLength:], pad)
+	toUpper(pinBlock)
 
-	// write encode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block encode operation finished\n")
+	// trace encode information
+	if tracer := i.tracer(); tracer != nil {
+		var notes []string
 		if isTruncated {
-			fmt.Fprintf(tw, "The pin is truncated on the right as 12 digits\n")
-		}
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "PIN\t: %s\n", rawPin)
-		if pad == "" {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
+			notes = append(notes, "The pin is truncated on the right as 12 digits")
 		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(pinBlock))
-		tw.Write([]byte("\n"))
+		tracer.Trace(TraceEvent{
+			Step:   StepEncode,
+			Format: i.format,
+			Notes:  notes,
+			Fields: []TraceField{
+				{Name: "PIN", Kind: FieldPIN, Value: string(rawPin)},
+				{Name: "PAD", Kind: FieldText, Value: pad},
+			},
+			Results: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: string(pinBlock)},
+			},
+		})
 	}
 
-	return strings.ToUpper(pinBlock), nil
+	return string(pinBlock), nil
 }
 
 func (i *eciObject) Decode(pinBlock, account string) (string, error) {
+	return decodeString(i.decode, pinBlock, account)
+}
+
+// DecodePIN returns the PIN of a PIN block
+func (i *eciObject) DecodePIN(pinBlock, account string) (*PIN, error) {
+	pin, err := i.decode(pinBlock, account)
+	if err != nil {
+		return nil, err
+	}
+	return NewPIN(pin), nil
+}
+
+func (i *eciObject) decode(pinBlock, account string) ([]byte, error) {
+	validation := i.validation()
+
 	if len(pinBlock) != 16 {
-		return "", fmt.Errorf("pin block must be 16 characters")
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 characters")
+	}
+
+	if err := validation.checkAccount(i.format, account, false); err != nil {
+		return nil, err
 	}
 
 	pinLength := 4
 	remainder := pinBlock
 	if i.getVersion() != eci2Version {
-		var rest string
-		_, err := fmt.Sscanf(pinBlock, "%01d%s", &pinLength, &rest)
-		if err != nil {
-			return "", fmt.Errorf("unable to parse pin block")
+		// the block starts with the length of pin
+		if pinBlock[0] < '0' || pinBlock[0] > '9' {
+			return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlock, "unable to parse pin block")
 		}
+		pinLength = int(pinBlock[0] - '0')
 		if pinLength > 6 || pinLength < 4 {
-			return "", fmt.Errorf("unable to parse pin block")
+			return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlock, "unable to parse pin block")
+		}
+		remainder = pinBlock[1:]
+		if strings.ContainsAny(remainder, " \t\r\n") {
+			return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlock, "unable to parse pin block")
 		}
-		remainder = rest
 	}
 
 	if pinLength > len(remainder) {
-		return "", fmt.Errorf("pin length %d exceeds remaining block length %d", pinLength, len(remainder))
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINLength, fmt.Sprintf("pin length %d exceeds remaining block length %d", pinLength, len(remainder)))
+	}
+
+	if err := validation.checkDecoded(i.format, isDecimal(remainder[:pinLength]), "pin digits must be decimal"); err != nil {
+		return nil, err
 	}
 
-	// write decode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block decode operation finished\n")
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(pinBlock))
+	// ECI-3 and VISA-2 pad the PIN with zeros to 6 digits
+	fill := remainder[pinLength:]
+	validFill := isHex(fill)
+	if i.getVersion() != eci2Version {
+		validFill = isFill(fill[:6-pinLength], '0') && isHex(fill[6-pinLength:])
+	}
+	if err := validation.checkDecoded(i.format, validFill, "invalid fill"); err != nil {
+		return nil, err
+	}
+
+	pin := []byte(remainder[:pinLength])
+
+	if err := validation.checkDecodedPIN(i.format, pin, i.maxPINLength()); err != nil {
+		wipe(pin)
+		return nil, err
+	}
+
+	// trace decode information
+	if tracer := i.tracer(); tracer != nil {
 		var pad string
 		if len(remainder) > pinLength {
 			pad = remainder[pinLength:]
 		}
-		if pad == "" {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Decoded PIN\t: %s\n", remainder[:pinLength])
-		tw.Write([]byte("\n"))
+		tracer.Trace(TraceEvent{
+			Step:   StepDecode,
+			Format: i.format,
+			Fields: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: strings.ToUpper(pinBlock)},
+				{Name: "PAD", Kind: FieldText, Value: pad},
+			},
+			Results: []TraceField{
+				{Name: "Decoded PIN", Kind: FieldPIN, Value: string(pin)},
+			},
+		})
 	}
 
-	return remainder[:pinLength], nil
+	return pin, nil
+}
+
+// EncodeBytes returns the 8 byte PIN block for the given PIN and account number
+func (i *eciObject) EncodeBytes(pin, account string) ([]byte, error) {
+	return encodeHexBytes(i, pin, account)
+}
+
+// DecodeBytes returns the PIN from an 8 byte PIN block
+func (i *eciObject) DecodeBytes(pinBlock []byte, account string) (string, error) {
+	return decodeHexBytes(i, pinBlock, account)
 }
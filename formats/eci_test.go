@@ -52,7 +52,7 @@ func TestECI2(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PIN     : 1234`
+PIN     : ****`
 		require.Contains(t, out.String(), expectedOutput)
 	})
 
@@ -68,11 +68,11 @@ PIN     : 1234`
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PIN block  : 123456789012AAAA
+Formatted PIN block  : ****************
 PAD                  : 56789012AAAA
 Format               : ECI-2
 ------------------------------------
-Decoded PIN  : 1234
+Decoded PIN  : ****
 
 `
 		require.Equal(t, out.String(), expectedOutput)
@@ -121,7 +121,7 @@ func TestECI3(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PIN     : 1234`
+PIN     : ****`
 		require.Contains(t, out.String(), expectedOutput)
 	})
 
@@ -137,11 +137,11 @@ PIN     : 1234`
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PIN block  : 6123456789012AAA
+Formatted PIN block  : ****************
 PAD                  : 789012AAA
 Format               : ECI-3
 ------------------------------------
-Decoded PIN  : 123456
+Decoded PIN  : ****
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -190,7 +190,7 @@ func TestVISA2(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PIN     : 1234`
+PIN     : ****`
 		require.Contains(t, out.String(), expectedOutput)
 	})
 
@@ -206,11 +206,11 @@ PIN     : 1234`
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PIN block  : 6123456789012222
+Formatted PIN block  : ****************
 PAD                  : 789012222
 Format               : VISA-2
 ------------------------------------
-Decoded PIN  : 123456
+Decoded PIN  : ****
 
 `
 		require.Equal(t, expectedOutput, out.String())
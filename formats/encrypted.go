@@ -0,0 +1,247 @@
+package formats
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+type encryptedObject struct {
+	format Format
+	cipher Cipher
+}
+
+// NewEncrypted wraps an 8 byte PIN block format (ISO-0, ISO-1, ISO-3, ANSI X9.8,
+// ECI, VISA, ...) so that Encode returns the PIN block encrypted with cipher and
+// Decode accepts an encrypted PIN block. Both are 16 hex characters.
+//
+//	cipher, err := encryption.NewTdesECB(zpk)
+//	iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+//	encryptedBlock, err := iso0.Encode("1234", "5432101234567891")
+func NewEncrypted(format Format, cipher Cipher) Format {
+	return &encryptedObject{
+		format: format,
+		cipher: cipher,
+	}
+}
+
+// SetDebugWriter will set writer for getting output message of encoding and decoding logic
+func (e *encryptedObject) SetDebugWriter(writer io.Writer) {
+	e.format.SetDebugWriter(writer)
+}
+
+// SetTracer sets the tracer of the wrapped format
+func (e *encryptedObject) SetTracer(tracer Tracer) {
+	SetTracer(e.format, tracer)
+}
+
+// SetValidation sets the checks of the wrapped format
+func (e *encryptedObject) SetValidation(validation Validation) {
+	SetValidation(e.format, validation)
+}
+
+// Encode returns the encrypted PIN block for the given PIN and account number
+func (e *encryptedObject) Encode(pin, account string) (string, error) {
+	pinBlock, err := e.format.Encode(pin, account)
+	if err != nil {
+		return "", err
+	}
+
+	return e.encrypt(pinBlock)
+}
+
+// EncodePIN returns the encrypted PIN block for the given PIN and account
+// number, the PIN is wiped. The clear PIN block is only held in wiped
+// buffers when the wrapped format implements BlockFormat.
+func (e *encryptedObject) EncodePIN(pin *PIN, account string) (string, error) {
+	if _, ok := e.format.(BlockFormat); ok {
+		defer pin.Wipe()
+
+		encryptedPinBlock, err := e.EncodeBlock(pin.Bytes(), account)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%X", encryptedPinBlock[:]), nil
+	}
+
+	pinBlock, err := EncodePIN(e.format, pin, account)
+	if err != nil {
+		return "", err
+	}
+
+	return e.encrypt(pinBlock)
+}
+
+// encrypt returns the encrypted hex PIN block of a clear hex PIN block
+func (e *encryptedObject) encrypt(pinBlock string) (string, error) {
+	if len(pinBlock) != 16 {
+		return "", newError(describe(e.format), FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 characters")
+	}
+
+	rawPinBlock, err := hex.DecodeString(pinBlock)
+	if err != nil {
+		return "", wrapError(describe(e.format), FieldNamePINBlock, ErrInvalidPINBlock, "decoding pinBlock", err)
+	}
+	defer wipe(rawPinBlock)
+
+	encryptedPinBlock, err := e.cipher.Encrypt(rawPinBlock)
+	if err != nil {
+		return "", wrapError(describe(e.format), FieldNamePINBlock, ErrCipher, "encrypting pinBlock", err)
+	}
+
+	return fmt.Sprintf("%X", encryptedPinBlock), nil
+}
+
+// EncodeBytes returns the encrypted PIN block of 8 bytes for the given PIN and
+// account number
+func (e *encryptedObject) EncodeBytes(pin, account string) ([]byte, error) {
+	if _, ok := e.format.(BlockFormat); ok {
+		return encodeBlockBytes(e, pin, account)
+	}
+
+	rawPinBlock, err := EncodeBytes(e.format, pin, account)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rawPinBlock) != 8 {
+		wipe(rawPinBlock)
+		return nil, newError(describe(e.format), FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 8 bytes")
+	}
+
+	encryptedPinBlock, err := e.cipher.Encrypt(rawPinBlock)
+	if err != nil {
+		wipe(rawPinBlock)
+		return nil, wrapError(describe(e.format), FieldNamePINBlock, ErrCipher, "encrypting pinBlock", err)
+	}
+
+	// ciphers that do not encrypt can return the clear PIN block
+	if len(encryptedPinBlock) > 0 && &encryptedPinBlock[0] != &rawPinBlock[0] {
+		wipe(rawPinBlock)
+	}
+
+	return encryptedPinBlock, nil
+}
+
+// Decode returns the PIN from an encrypted PIN block
+func (e *encryptedObject) Decode(pinBlock, account string) (string, error) {
+	if len(pinBlock) != 16 {
+		return "", newError(describe(e.format), FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 characters")
+	}
+
+	encryptedPinBlock, err := hex.DecodeString(pinBlock)
+	if err != nil {
+		return "", wrapError(describe(e.format), FieldNamePINBlock, ErrInvalidPINBlock, "decoding pinBlock", err)
+	}
+
+	return e.DecodeBytes(encryptedPinBlock, account)
+}
+
+// DecodePIN returns the PIN from an encrypted PIN block. The clear PIN block
+// is only held in wiped buffers when the wrapped format implements
+// BlockFormat.
+func (e *encryptedObject) DecodePIN(pinBlock, account string) (*PIN, error) {
+	if len(pinBlock) != 16 {
+		return nil, newError(describe(e.format), FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 characters")
+	}
+
+	encryptedPinBlock, err := hex.DecodeString(pinBlock)
+	if err != nil {
+		return nil, wrapError(describe(e.format), FieldNamePINBlock, ErrInvalidPINBlock, "decoding pinBlock", err)
+	}
+
+	if _, ok := e.format.(BlockFormat); ok {
+		pin, err := e.DecodeBlock(nil, [8]byte(encryptedPinBlock), account)
+		if err != nil {
+			wipe(pin)
+			return nil, err
+		}
+
+		return NewPIN(pin), nil
+	}
+
+	// the wrapped format only decodes hex strings
+	rawPinBlock, err := e.cipher.Decrypt(encryptedPinBlock)
+	if err != nil {
+		return nil, wrapError(describe(e.format), FieldNamePINBlock, ErrCipher, "decrypting pinBlock", err)
+	}
+	defer wipe(rawPinBlock)
+
+	clearPinBlock := make([]byte, 16)
+	defer wipe(clearPinBlock)
+	hex.Encode(clearPinBlock, rawPinBlock)
+	toUpper(clearPinBlock)
+
+	return DecodePIN(e.format, string(clearPinBlock), account)
+}
+
+// DecodeBytes returns the PIN from an encrypted PIN block of 8 bytes
+func (e *encryptedObject) DecodeBytes(pinBlock []byte, account string) (string, error) {
+	if _, ok := e.format.(BlockFormat); ok {
+		return decodeBlockBytes(e, pinBlock, account)
+	}
+
+	if len(pinBlock) != 8 {
+		return "", newError(describe(e.format), FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 8 bytes")
+	}
+
+	rawPinBlock, err := e.cipher.Decrypt(pinBlock)
+	if err != nil {
+		return "", wrapError(describe(e.format), FieldNamePINBlock, ErrCipher, "decrypting pinBlock", err)
+	}
+
+	// ciphers that do not encrypt can return the PIN block of the caller
+	if len(rawPinBlock) > 0 && &rawPinBlock[0] != &pinBlock[0] {
+		defer wipe(rawPinBlock)
+	}
+
+	return DecodeBytes(e.format, rawPinBlock, account)
+}
+
+// EncodeBlock returns the encrypted PIN block of 8 bytes for the given PIN and
+// account number. The wrapped format must implement BlockFormat.
+func (e *encryptedObject) EncodeBlock(pin []byte, account string) ([8]byte, error) {
+	var encryptedPinBlock [8]byte
+
+	format, ok := e.format.(BlockFormat)
+	if !ok {
+		return encryptedPinBlock, newError(describe(e.format), FieldNameFormat, ErrUnsupportedFormat, "format does not support fixed size pin blocks")
+	}
+
+	pinBlock, err := format.EncodeBlock(pin, account)
+	if err != nil {
+		return encryptedPinBlock, err
+	}
+	defer wipe(pinBlock[:])
+
+	buffers := getBlockBuffers()
+	defer putBlockBuffers(buffers)
+
+	copy(buffers.in[:8], pinBlock[:])
+	if err := encryptTo(e.cipher, buffers.out[:8], buffers.in[:8]); err != nil {
+		return encryptedPinBlock, wrapError(describe(e.format), FieldNamePINBlock, ErrCipher, "encrypting pinBlock", err)
+	}
+	copy(encryptedPinBlock[:], buffers.out[:8])
+
+	return encryptedPinBlock, nil
+}
+
+// DecodeBlock appends the PIN of an encrypted PIN block of 8 bytes to dst.
+// The wrapped format must implement BlockFormat.
+func (e *encryptedObject) DecodeBlock(dst []byte, encryptedPinBlock [8]byte, account string) ([]byte, error) {
+	format, ok := e.format.(BlockFormat)
+	if !ok {
+		return dst, newError(describe(e.format), FieldNameFormat, ErrUnsupportedFormat, "format does not support fixed size pin blocks")
+	}
+
+	buffers := getBlockBuffers()
+	defer putBlockBuffers(buffers)
+
+	copy(buffers.in[:8], encryptedPinBlock[:])
+	if err := decryptTo(e.cipher, buffers.out[:8], buffers.in[:8]); err != nil {
+		return dst, wrapError(describe(e.format), FieldNamePINBlock, ErrCipher, "decrypting pinBlock", err)
+	}
+
+	return format.DecodeBlock(dst, [8]byte(buffers.out[:8]), account)
+}
@@ -0,0 +1,182 @@
+package formats_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+// blockOnlyObject is a BlockFormat whose string methods fail, to check that
+// the clear PIN block is not formatted as hex
+type blockOnlyObject struct {
+	format formats.BlockFormat
+}
+
+func (b *blockOnlyObject) SetDebugWriter(writer io.Writer) {}
+
+func (b *blockOnlyObject) Encode(pin, account string) (string, error) {
+	return "", errors.New("clear pin block formatted as hex")
+}
+
+func (b *blockOnlyObject) Decode(pinBlock, account string) (string, error) {
+	return "", errors.New("clear pin block formatted as hex")
+}
+
+func (b *blockOnlyObject) EncodeBlock(pin []byte, account string) ([8]byte, error) {
+	return b.format.EncodeBlock(pin, account)
+}
+
+func (b *blockOnlyObject) DecodeBlock(dst []byte, pinBlock [8]byte, account string) ([]byte, error) {
+	return b.format.DecodeBlock(dst, pinBlock, account)
+}
+
+func TestEncrypted(t *testing.T) {
+	key, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	require.NoError(t, err)
+
+	cipher, err := encryption.NewTdesECB(key)
+	require.NoError(t, err)
+
+	t.Run("Encode", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+
+		// clear block is 041215FEDCBA9876
+		pinBlock, err := iso0.Encode("1234", "5432101234567891")
+
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", pinBlock)
+	})
+
+	t.Run("Decode", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+
+		pin, err := iso0.Decode("BA2ADC4EBA48F711", "5432101234567891")
+
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+
+		// lower case hex is accepted as well
+		pin, err = iso0.Decode("ba2adc4eba48f711", "5432101234567891")
+
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("Encode/Decode", func(t *testing.T) {
+		for _, ctor := range []func() formats.Format{
+			formats.NewISO0,
+			formats.NewISO1,
+			formats.NewISO2,
+			formats.NewISO3,
+			formats.NewANSIX98,
+			formats.NewOEM1,
+			formats.NewECI1,
+			formats.NewECI2,
+			formats.NewECI3,
+			formats.NewECI4,
+			formats.NewVISA1,
+			formats.NewVISA2,
+			formats.NewVISA3,
+			formats.NewVISA4,
+		} {
+			format := formats.NewEncrypted(ctor(), cipher)
+
+			pinBlock, err := format.Encode("1234", "5432101234567891")
+			require.NoError(t, err)
+			require.Len(t, pinBlock, 16)
+
+			pin, err := format.Decode(pinBlock, "5432101234567891")
+			require.NoError(t, err)
+			require.Equal(t, "1234", pin)
+		}
+	})
+
+	t.Run("debug writer of wrapped format", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+
+		out := bytes.NewBuffer([]byte{})
+		iso0.SetDebugWriter(out)
+
+		_, err := iso0.Encode("1234", "5432101234567891")
+		require.NoError(t, err)
+		require.Contains(t, out.String(), "Formatted PIN block  : ****************")
+	})
+
+	t.Run("tracer of wrapped format", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+
+		out := bytes.NewBuffer([]byte{})
+		require.True(t, formats.SetTracer(iso0, formats.NewWriterTracer(out, formats.NoMask)))
+
+		_, err := iso0.Encode("1234", "5432101234567891")
+		require.NoError(t, err)
+		require.Contains(t, out.String(), "Formatted PIN block  : 041215FEDCBA9876")
+	})
+
+	t.Run("bad pin block", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+
+		_, err := iso0.Decode("BA2ADC4EBA48F7", "5432101234567891")
+		require.EqualError(t, err, "pin block must be 16 characters")
+
+		_, err = iso0.Decode("XA2ADC4EBA48F711", "5432101234567891")
+		require.ErrorContains(t, err, "decoding pinBlock")
+	})
+
+	t.Run("Decode DUKPT encrypted block", func(t *testing.T) {
+		bdk, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+		require.NoError(t, err)
+
+		ksn, err := hex.DecodeString("FFFF9876543210E00001")
+		require.NoError(t, err)
+
+		cipher, err := encryption.NewDukpt(bdk, ksn)
+		require.NoError(t, err)
+
+		iso0 := formats.NewEncrypted(formats.NewISO0(), cipher)
+
+		pin, err := iso0.Decode("1B9C1845EB993A7A", "4012345678909")
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("PIN values of a block format", func(t *testing.T) {
+		iso0 := formats.NewEncrypted(&blockOnlyObject{format: formats.NewISO0().(formats.BlockFormat)}, cipher)
+
+		pin := formats.PINFromString("1234")
+		pinBlock, err := formats.EncodePIN(iso0, pin, "5432101234567891")
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", pinBlock)
+		require.Zero(t, pin.Len())
+
+		decoded, err := formats.DecodePIN(iso0, pinBlock, "5432101234567891")
+		require.NoError(t, err)
+		require.Equal(t, "1234", decoded.Reveal())
+		decoded.Wipe()
+
+		_, err = formats.DecodePIN(iso0, pinBlock, "1234")
+		require.EqualError(t, err, "account length must be at least 13 digits")
+
+		// translation decodes and encodes the blocks without formatting them
+		translated, err := formats.TranslatePIN(pinBlock, "5432101234567891", iso0, formats.NewISO4(encryption.NewNoOp()))
+		require.NoError(t, err)
+		require.Len(t, translated, 32)
+
+		translated, err = formats.TranslatePIN(translated, "5432101234567891", formats.NewISO4(encryption.NewNoOp()), iso0)
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", translated)
+	})
+
+	t.Run("16 byte pin block format", func(t *testing.T) {
+		iso4 := formats.NewEncrypted(formats.NewISO4(encryption.NewNoOp()), cipher)
+
+		_, err := iso4.Encode("1234", "5432101234567891")
+		require.EqualError(t, err, "pin block must be 16 characters")
+	})
+}
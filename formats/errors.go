@@ -0,0 +1,138 @@
+package formats
+
+import "errors"
+
+// Errors of the encode and decode operations. The formats return an *Error
+// that wraps one of them, errors.Is matches it whatever the message is:
+//
+//	pin, err := iso0.Decode(pinBlock, account)
+//	switch {
+//	case errors.Is(err, formats.ErrFormatMismatch), errors.Is(err, formats.ErrCipher):
+//		// response code 81, PIN cryptographic error
+//	case errors.Is(err, formats.ErrInvalidPINLength):
+//		// response code 55, incorrect PIN
+//	}
+var (
+	// ErrInvalidPIN is returned for a PIN with characters that are not digits
+	ErrInvalidPIN = errors.New("invalid pin")
+
+	// ErrInvalidPINLength is returned for a PIN that is too short or too long,
+	// or for a PIN block with an invalid PIN length
+	ErrInvalidPINLength = errors.New("invalid pin length")
+
+	// ErrInvalidAccount is returned for an account number of invalid length
+	// or characters
+	ErrInvalidAccount = errors.New("invalid account")
+
+	// ErrInvalidPINBlockLength is returned for a PIN block of invalid length
+	ErrInvalidPINBlockLength = errors.New("invalid pin block length")
+
+	// ErrInvalidPINBlock is returned for a PIN block that can not be parsed
+	ErrInvalidPINBlock = errors.New("invalid pin block")
+
+	// ErrFormatMismatch is returned for a PIN block of another format, which
+	// usually means that it was decrypted with the wrong key
+	ErrFormatMismatch = errors.New("format mismatch")
+
+	// ErrCipher is returned when a PIN block can not be encrypted or decrypted
+	ErrCipher = errors.New("cipher failure")
+
+	// ErrInvalidFiller is returned for a fill digit that is not a single hex
+	// character or that the format does not support
+	ErrInvalidFiller = errors.New("invalid filler")
+
+	// ErrUnsupportedFormat is returned for an unknown format name
+	ErrUnsupportedFormat = errors.New("unsupported format")
+)
+
+// Fields of an Error
+const (
+	FieldNamePIN      = "pin"
+	FieldNameAccount  = "account"
+	FieldNamePINBlock = "pin block"
+	FieldNameFiller   = "filler"
+	FieldNameFormat   = "format"
+)
+
+// Error is the error of an encode or decode operation. Error() returns the
+// reason only, as the formats did before they returned typed errors.
+//
+//	var formatErr *formats.Error
+//	if errors.As(err, &formatErr) {
+//		log.Printf("%s: %s: %s", formatErr.Format, formatErr.Field, formatErr.Reason)
+//	}
+type Error struct {
+	// Format is the description of the format, such as Format 0 (ISO-0). It
+	// is empty when the error is not specific to a format.
+	Format string
+
+	// Field is the invalid input, one of the FieldName constants
+	Field string
+
+	// Reason describes the failure
+	Reason string
+
+	// Err is one of the errors of the package, such as ErrInvalidPINLength
+	Err error
+
+	// Cause is the error that caused the failure, such as the error of a
+	// cipher, or nil
+	Cause error
+}
+
+// Error returns the reason of the failure
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+// Unwrap returns the error of the package and the cause of the failure
+func (e *Error) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
+
+// newError returns the *Error of a failure of format
+func newError(format, field string, err error, reason string) error {
+	return &Error{
+		Format: format,
+		Field:  field,
+		Reason: reason,
+		Err:    err,
+	}
+}
+
+// wrapError returns the *Error of a failure of format caused by cause, the
+// reason is followed by the message of the cause
+func wrapError(format, field string, err error, reason string, cause error) error {
+	return &Error{
+		Format: format,
+		Field:  field,
+		Reason: reason + ": " + cause.Error(),
+		Err:    err,
+		Cause:  cause,
+	}
+}
+
+// describe returns the description of the formats of this package, or an
+// empty string
+func describe(format Format) string {
+	switch f := format.(type) {
+	case *iso0Object:
+		return f.format
+	case *iso1Object:
+		return f.format
+	case *iso4Object:
+		return f.format
+	case *eciObject:
+		return f.format
+	case *oemObject:
+		return f.format
+	case *visa3Object:
+		return f.format
+	case *encryptedObject:
+		return describe(f.format)
+	}
+	return ""
+}
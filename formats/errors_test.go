@@ -0,0 +1,194 @@
+package formats_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+// failingCipher is a cipher that always fails
+type failingCipher struct{}
+
+var errCipherFailed = errors.New("hsm unavailable")
+
+func (c *failingCipher) Encrypt(plainText []byte) ([]byte, error) {
+	return nil, errCipherFailed
+}
+
+func (c *failingCipher) Decrypt(cipherText []byte) ([]byte, error) {
+	return nil, errCipherFailed
+}
+
+func TestErrors(t *testing.T) {
+	account := "5432101234567891"
+
+	cipher, err := encryption.NewAesECB([]byte("1234567890123456"))
+	require.NoError(t, err)
+
+	encode := func(format formats.Format, pin, account string) error {
+		_, err := format.Encode(pin, account)
+		return err
+	}
+
+	// hex PINs are only encoded with HexPIN
+	hexISO0, err := formats.NewFormatter("ISO-0", formats.WithValidation(formats.Validation{HexPIN: true}))
+	require.NoError(t, err)
+
+	decode := func(format formats.Format, pinBlock, account string) error {
+		_, err := format.Decode(pinBlock, account)
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		format string
+		field  string
+		reason string
+	}{
+		{
+			name:   "ISO-0 short pin",
+			err:    encode(formats.NewISO0(), "123", account),
+			target: formats.ErrInvalidPINLength,
+			format: "Format 0 (ISO-0)",
+			field:  formats.FieldNamePIN,
+			reason: "pin length must be between 4 and 12 digits",
+		},
+		{
+			name:   "ISO-0 non numeric pin",
+			err:    encode(formats.NewISO0(), "12A4", account),
+			target: formats.ErrInvalidPIN,
+			format: "Format 0 (ISO-0)",
+			field:  formats.FieldNamePIN,
+			reason: "pin must be numeric",
+		},
+		{
+			name:   "ISO-0 non hex pin",
+			err:    encode(hexISO0, "12G4", account),
+			target: formats.ErrInvalidPIN,
+			format: "Format 0 (ISO-0)",
+			field:  formats.FieldNamePIN,
+			reason: "encoding/hex: invalid byte: U+0047 'G'",
+		},
+		{
+			name:   "ISO-0 short account",
+			err:    encode(formats.NewISO0(), "1234", "123456789012"),
+			target: formats.ErrInvalidAccount,
+			format: "Format 0 (ISO-0)",
+			field:  formats.FieldNameAccount,
+			reason: "account length must be at least 13 digits",
+		},
+		{
+			name:   "ISO-0 other format",
+			err:    decode(formats.NewISO0(), "341215FEDCBA9876", account),
+			target: formats.ErrFormatMismatch,
+			format: "Format 0 (ISO-0)",
+			field:  formats.FieldNamePINBlock,
+			reason: "format is different",
+		},
+		{
+			name:   "ISO-3 pin block length",
+			err:    decode(formats.NewISO3(), "341215FEDCBA98", account),
+			target: formats.ErrInvalidPINBlockLength,
+			format: "Format 3 (ISO-3)",
+			field:  formats.FieldNamePINBlock,
+			reason: "pin block must be 16 characters",
+		},
+		{
+			name:   "ISO-1 unparsable pin block",
+			err:    decode(formats.NewISO1(), "041234FFFFFFFFFF", ""),
+			target: formats.ErrInvalidPINBlock,
+			format: "Format 1 (ISO-1)",
+			field:  formats.FieldNamePINBlock,
+			reason: "unable to parse pin block",
+		},
+		{
+			name:   "ECI-3 pin length",
+			err:    decode(formats.NewECI3(), "8123456712345678", ""),
+			target: formats.ErrInvalidPINBlock,
+			format: "ECI-3",
+			field:  formats.FieldNamePINBlock,
+			reason: "unable to parse pin block",
+		},
+		{
+			name:   "OEM-1 pin length",
+			err:    decode(formats.NewOEM1(), "FFFFFFFFFFFFFFFF", ""),
+			target: formats.ErrInvalidPINLength,
+			format: "Diebold, Docutel, NCR",
+			field:  formats.FieldNamePINBlock,
+			reason: "invalid pin length 0",
+		},
+		{
+			name:   "ISO-4 account",
+			err:    encode(formats.NewISO4(cipher), "1234", "12345678901"),
+			target: formats.ErrInvalidAccount,
+			format: "Format 4 (ISO-4)",
+			field:  formats.FieldNameAccount,
+			reason: "account length must be between 12 and 19 digits",
+		},
+		{
+			name:   "ISO-4 cipher",
+			err:    encode(formats.NewISO4(&failingCipher{}), "1234", account),
+			target: formats.ErrCipher,
+			format: "Format 4 (ISO-4)",
+			field:  formats.FieldNamePINBlock,
+			reason: "encrypting pinBlock: hsm unavailable",
+		},
+		{
+			name:   "encrypted cipher",
+			err:    decode(formats.NewEncrypted(formats.NewISO0(), &failingCipher{}), "BA2ADC4EBA48F711", account),
+			target: formats.ErrCipher,
+			format: "Format 0 (ISO-0)",
+			field:  formats.FieldNamePINBlock,
+			reason: "decrypting pinBlock: hsm unavailable",
+		},
+		{
+			name: "translate",
+			err: func() error {
+				_, err := formats.TranslatePIN("341215FEDCBA9876", account, formats.NewISO0(), formats.NewISO1())
+				return err
+			}(),
+			target: formats.ErrFormatMismatch,
+			format: "Format 0 (ISO-0)",
+			field:  formats.FieldNamePINBlock,
+			reason: "format is different",
+		},
+		{
+			name:   "unsupported format",
+			err:    func() error { _, err := formats.NewFormatter("ISO-9"); return err }(),
+			target: formats.ErrUnsupportedFormat,
+			field:  formats.FieldNameFormat,
+			reason: "unsupported pinblock type",
+		},
+		{
+			name:   "filler",
+			err:    func() error { _, err := formats.NewFormatter("ISO-1", formats.WithFiller("A")); return err }(),
+			target: formats.ErrInvalidFiller,
+			format: "Format 1 (ISO-1)",
+			field:  formats.FieldNameFiller,
+			reason: "format does not support a fixed filler",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, tt.err, tt.target)
+
+			var formatErr *formats.Error
+			require.ErrorAs(t, tt.err, &formatErr)
+			require.Equal(t, tt.format, formatErr.Format)
+			require.Equal(t, tt.field, formatErr.Field)
+			require.Equal(t, tt.reason, formatErr.Reason)
+		})
+	}
+
+	t.Run("cause", func(t *testing.T) {
+		err := encode(formats.NewISO4(&failingCipher{}), "1234", account)
+		require.ErrorIs(t, err, errCipherFailed)
+		require.EqualError(t, err, "encrypting pinBlock: hsm unavailable")
+	})
+}
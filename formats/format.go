@@ -1,10 +1,7 @@
 package formats
 
 import (
-	"fmt"
 	"io"
-
-	"github.com/moov-io/pinblock/encryption"
 )
 
 const (
@@ -23,6 +20,13 @@ var (
 	hexCharacters = []byte{'A', 'B', 'C', 'D', 'E', 'F'}
 )
 
+// Format encodes a PIN and an account number into a PIN block and decodes it.
+//
+// The formats of this package are safe for concurrent use by multiple
+// goroutines. Encode and Decode only read the format, and the settings that
+// can be changed later, such as the tracer and the validation, are replaced
+// atomically and apply to the operations that start afterwards. To change
+// them for a single operation, use EncodeContext and DecodeContext.
 type Format interface {
 	SetDebugWriter(writer io.Writer)
 	Encode(pin, account string) (string, error)
@@ -34,36 +38,6 @@ type Cipher interface {
 	Decrypt(cipherText []byte) ([]byte, error)
 }
 
-type constructorFunc func() Format
-
-var (
-	formatConstructor = map[string]constructorFunc{
-		"ISO-0": func() Format { return NewISO0() },
-		"ISO-1": func() Format { return NewISO1() },
-		"ISO-2": func() Format { return NewISO2() },
-		"ISO-3": func() Format { return NewISO3() },
-		"ISO-4": func() Format { return NewISO4(encryption.NewNoOp()) },
-		"ANSI":  func() Format { return NewANSIX98() },
-		"ECI1":  func() Format { return NewECI1() },
-		"ECI2":  func() Format { return NewECI2() },
-		"ECI3":  func() Format { return NewECI3() },
-		"ECI4":  func() Format { return NewECI4() },
-		"VISA1": func() Format { return NewVISA1() },
-		"VISA2": func() Format { return NewVISA2() },
-		"VISA3": func() Format { return NewVISA3() },
-		"VISA4": func() Format { return NewVISA4() },
-	}
-)
-
-func NewFormatter(bType string) (Format, error) {
-	constructor := formatConstructor[bType]
-	if constructor == nil {
-		return nil, fmt.Errorf("unsupported pinblock type")
-	}
-
-	return constructor(), nil
-}
-
 func NewISO0() Format {
 	return &iso0Object{
 		Filler: "F", // default to ISO0's Filler
@@ -104,12 +78,14 @@ func NewISO3() Format {
 }
 
 func NewISO4(cipher Cipher) Format {
-	return &iso4Object{
+	format := &iso4Object{
 		Filler: "A", // default to ISO-4
 
-		cipher: cipher,
 		format: "Format 4 (ISO-4)",
 	}
+	format.cipher.Store(&cipher)
+
+	return format
 }
 
 // ANSI X9.8:
@@ -4,15 +4,14 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"text/tabwriter"
 )
 
 type iso0Object struct {
 	Filler string
 
-	version     string
-	format      string
-	debugWriter io.Writer
+	version string
+	format  string
+	settings
 }
 
 func (i *iso0Object) getVersion() string {
@@ -22,118 +21,243 @@ func (i *iso0Object) getVersion() string {
 	return iso0Version
 }
 
-// Padding returns padding pattern
-func (i *iso0Object) padding(pin string) (string, error) {
-	if len(pin) < 4 || len(pin) > 12 {
-		return "", fmt.Errorf("pin length must be between 4 and 12 digits")
-	}
+// SetDebugWriter will set writer for getting output message of encoding and decoding logic,
+// the PAN and the PIN are masked
+func (i *iso0Object) SetDebugWriter(writer io.Writer) {
+	i.setTracer(NewWriterTracer(writer, DefaultMask))
+}
 
-	length := 14 - len(pin)
-	if i.Filler == "" {
-		// ISO3
-		//  fill is random values from 10 to 15,
-		return randomLetters(length, hexCharacters)
-	}
-	return strings.Repeat(i.Filler, length), nil
+// SetTracer sets the tracer of the encode and decode operations
+func (i *iso0Object) SetTracer(tracer Tracer) {
+	i.setTracer(tracer)
 }
 
-// SetDebugWriter will set writer for getting output message of encoding and decoding logic
-func (i *iso0Object) SetDebugWriter(writer io.Writer) {
-	i.debugWriter = tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+// SetValidation sets the checks of the PIN and the account
+func (i *iso0Object) SetValidation(validation Validation) {
+	i.setValidation(validation)
+}
+
+// copy returns a copy of the format with the same settings
+func (i *iso0Object) copy() copyable {
+	return copySettings(&iso0Object{Filler: i.Filler, version: i.version, format: i.format}, i)
 }
 
 // Encode returns the ISO0 PIN block for the given PIN and account number
 func (i *iso0Object) Encode(pin, account string) (string, error) {
-	pad, err := i.padding(pin)
+	return encodeString(i.encode, pin, account)
+}
+
+// EncodePIN returns the ISO0 PIN block for the given PIN and account number,
+// the PIN is wiped
+func (i *iso0Object) EncodePIN(pin *PIN, account string) (string, error) {
+	defer pin.Wipe()
+	return i.encode(pin.Bytes(), account)
+}
+
+func (i *iso0Object) encode(pin []byte, account string) (string, error) {
+	pinBlock, err := i.EncodeBlock(pin, account)
 	if err != nil {
 		return "", err
 	}
+	defer wipe(pinBlock[:])
 
-	// pin block should start with 0, then add length of pin, then add pin,
-	// then add F until 16 characters
-	pinBlock := fmt.Sprintf("%s%X%s%s", i.getVersion(), len(pin), pin, pad)
+	return fmt.Sprintf("%X", pinBlock[:]), nil
+}
+
+// EncodeBlock returns the ISO0 PIN block for the given PIN and account
+// number, it does not allocate unless the format is traced
+func (i *iso0Object) EncodeBlock(pin []byte, account string) ([8]byte, error) {
+	var pinBlock [8]byte
+	validation := i.validation()
+
+	if err := validation.checkPIN(i.format, pin, 12); err != nil {
+		return pinBlock, err
+	}
+
+	if err := validation.checkAccount(i.format, account, true); err != nil {
+		return pinBlock, err
+	}
+
+	if len(pin) < 4 || len(pin) > 12 {
+		return pinBlock, newError(i.format, FieldNamePIN, ErrInvalidPINLength, "pin length must be between 4 and 12 digits")
+	}
 
 	// account number must be at least 13 digits, including the check digit
 	if len(account) < 13 {
-		return "", fmt.Errorf("account length must be at least 13 digits")
+		return pinBlock, newError(i.format, FieldNameAccount, ErrInvalidAccount, "account length must be at least 13 digits")
 	}
 
-	// take the last 12 digits of the account number excluding the check digit
-	accountBlock := fmt.Sprintf("0000%s", account[len(account)-13:len(account)-1])
+	if err := checkHex(pin); err != nil {
+		return pinBlock, newError(i.format, FieldNamePIN, ErrInvalidPIN, err.Error())
+	}
 
-	xorBlock, err := xorHex(pinBlock, accountBlock)
-	if err != nil {
-		return "", err
+	// pin field should start with 0, then add length of pin, then add pin,
+	// then add F until 16 characters
+	var pinField [16]byte
+	defer wipe(pinField[:])
+
+	pinField[0] = i.getVersion()[0]
+	pinField[1] = upperHex[len(pin)]
+	copy(pinField[2:], pin)
+
+	// ISO3
+	//  fill is random values from 10 to 15,
+	if err := fillField(pinField[2+len(pin):], i.Filler, hexCharacters); err != nil {
+		return pinBlock, err
 	}
 
-	// write encode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block encode operation finished\n")
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "PAN\t: %s\n", account)
-		fmt.Fprintf(tw, "PIN\t: %s\n", pin)
-		if len(pad) == 0 {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(xorBlock))
-		fmt.Fprintf(tw, "Formatted PAN block\t: %s\n", strings.ToUpper(accountBlock))
-		tw.Write([]byte("\n"))
+	accountField := iso0AccountField(account)
+	if err := packHex(pinBlock[:], pinField[:], accountField[:]); err != nil {
+		return pinBlock, newError(i.format, FieldNameAccount, ErrInvalidAccount, err.Error())
 	}
 
-	return strings.ToUpper(xorBlock), nil
+	// trace encode information
+	if tracer := i.tracer(); tracer != nil {
+		tracer.Trace(TraceEvent{
+			Step:   StepEncode,
+			Format: i.format,
+			Fields: []TraceField{
+				{Name: "PAN", Kind: FieldPAN, Value: account},
+				{Name: "PIN", Kind: FieldPIN, Value: string(pin)},
+				{Name: "PAD", Kind: FieldText, Value: string(pinField[2+len(pin):])},
+			},
+			Results: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: fmt.Sprintf("%X", pinBlock)},
+				{Name: "Formatted PAN block", Kind: FieldPANBlock, Value: strings.ToUpper(string(accountField[:]))},
+			},
+		})
+	}
+
+	return pinBlock, nil
 }
 
 func (i *iso0Object) Decode(pinBlock, account string) (string, error) {
+	return decodeString(i.decode, pinBlock, account)
+}
+
+// DecodePIN returns the PIN of an ISO0 PIN block
+func (i *iso0Object) DecodePIN(pinBlock, account string) (*PIN, error) {
+	pin, err := i.decode(pinBlock, account)
+	if err != nil {
+		return nil, err
+	}
+	return NewPIN(pin), nil
+}
+
+func (i *iso0Object) decode(pinBlock, account string) ([]byte, error) {
 	if len(pinBlock) != 16 {
-		return "", fmt.Errorf("pin block must be 16 characters")
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 characters")
+	}
+
+	var rawPinBlock [8]byte
+	defer wipe(rawPinBlock[:])
+
+	if err := packHex(rawPinBlock[:], []byte(pinBlock), nil); err != nil {
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlock, err.Error())
+	}
+
+	return i.DecodeBlock(nil, rawPinBlock, account)
+}
+
+// DecodeBlock appends the PIN of an ISO0 PIN block to dst, it does not
+// allocate unless the format is traced or dst is too short
+func (i *iso0Object) DecodeBlock(dst []byte, pinBlock [8]byte, account string) ([]byte, error) {
+	validation := i.validation()
+
+	if err := validation.checkAccount(i.format, account, true); err != nil {
+		return dst, err
 	}
 
 	if len(account) < 13 {
-		return "", fmt.Errorf("account length must be at least 13 digits")
+		return dst, newError(i.format, FieldNameAccount, ErrInvalidAccount, "account length must be at least 13 digits")
 	}
 
-	// take the last 12 digits of the account number excluding the check digit
-	accountBlock := fmt.Sprintf("0000%s", account[len(account)-13:len(account)-1])
+	accountField := iso0AccountField(account)
 
-	decodedBlock, err := xorHex(pinBlock, accountBlock)
-	if err != nil {
-		return "", err
+	var rawAccountBlock [8]byte
+	if err := packHex(rawAccountBlock[:], accountField[:], nil); err != nil {
+		return dst, newError(i.format, FieldNameAccount, ErrInvalidAccount, err.Error())
+	}
+
+	for n := range pinBlock {
+		pinBlock[n] ^= rawAccountBlock[n]
 	}
+	defer wipe(pinBlock[:])
+
+	var decodedBlock [16]byte
+	defer wipe(decodedBlock[:])
+	unpackHex(decodedBlock[:], pinBlock[:])
 
 	// checking format
-	if decodedBlock[0:1] != i.getVersion() {
-		return "", fmt.Errorf("format is different")
+	if decodedBlock[0] != i.getVersion()[0] {
+		return dst, newError(i.format, FieldNamePINBlock, ErrFormatMismatch, "format is different")
 	}
 
 	// decodedBlock should start with 0, then has length of pin, then has pin, then has F until 16 characters
-	pinLength := int(decodedBlock[1] - '0')
-	if pinLength < 4 || pinLength > 12 || 2+pinLength > len(decodedBlock) {
-		return "", fmt.Errorf("invalid pin length %d", pinLength)
-	}
-	pin := decodedBlock[2 : 2+pinLength]
-
-	// write decode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block decode operation finished\n")
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "Formatted PAN block\t: %s\n", strings.ToUpper(accountBlock))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(decodedBlock))
-		if pad, _ := i.padding(pin); len(pad) == 0 {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Decoded PIN\t: %s\n", pin)
-		tw.Write([]byte("\n"))
-	}
-
-	return pin, nil
+	pinLength := int(pinBlock[0] & 0x0F)
+	if pinLength < 4 || pinLength > 12 {
+		return dst, newError(i.format, FieldNamePINBlock, ErrInvalidPINLength, fmt.Sprintf("invalid pin length %d", pinLength))
+	}
+
+	if err := validation.checkDecoded(i.format, isDecimal(decodedBlock[2:2+pinLength]), "pin digits must be decimal"); err != nil {
+		return dst, err
+	}
+
+	fill := decodedBlock[2+pinLength:]
+	validFill := isHexLetters(fill)
+	if i.Filler != "" {
+		validFill = isFill(fill, i.Filler[0])
+	}
+	if err := validation.checkDecoded(i.format, validFill, "invalid fill"); err != nil {
+		return dst, err
+	}
+
+	start := len(dst)
+	dst = append(dst, decodedBlock[2:2+pinLength]...)
+	pin := dst[start:]
+
+	if err := validation.checkDecodedPIN(i.format, pin, 12); err != nil {
+		wipe(pin)
+		return dst[:start], err
+	}
+
+	// trace decode information
+	if tracer := i.tracer(); tracer != nil {
+		tracer.Trace(TraceEvent{
+			Step:   StepDecode,
+			Format: i.format,
+			Fields: []TraceField{
+				{Name: "Formatted PAN block", Kind: FieldPANBlock, Value: strings.ToUpper(string(accountField[:]))},
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: string(decodedBlock[:])},
+				{Name: "PAD", Kind: FieldText, Value: string(fill)},
+			},
+			Results: []TraceField{
+				{Name: "Decoded PIN", Kind: FieldPIN, Value: string(pin)},
+			},
+		})
+	}
+
+	return dst, nil
+}
+
+// iso0AccountField returns the account block of an account of at least 13
+// digits as hex characters
+func iso0AccountField(account string) [16]byte {
+	var field [16]byte
+
+	// take the last 12 digits of the account number excluding the check digit
+	copy(field[:], "0000")
+	copy(field[4:], account[len(account)-13:len(account)-1])
+
+	return field
+}
+
+// EncodeBytes returns the 8 byte PIN block for the given PIN and account number
+func (i *iso0Object) EncodeBytes(pin, account string) ([]byte, error) {
+	return encodeBlockBytes(i, pin, account)
+}
+
+// DecodeBytes returns the PIN from an 8 byte PIN block
+func (i *iso0Object) DecodeBytes(pinBlock []byte, account string) (string, error) {
+	return decodeBlockBytes(i, pinBlock, account)
 }
@@ -38,13 +38,13 @@ func TestISO0(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PAN     : 5432101234567891
-PIN     : 1234
+PAN     : 543210******7891
+PIN     : ****
 PAD     : FFFFFFFFFF
 Format  : Format 0 (ISO-0)
 ------------------------------------
-Formatted PIN block  : 041215FEDCBA9876
-Formatted PAN block  : 0000210123456789
+Formatted PIN block  : ****************
+Formatted PAN block  : ****************
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -113,8 +113,8 @@ func TestISO3(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PAN     : 5432101234567891
-PIN     : 1234`
+PAN     : 543210******7891
+PIN     : ****`
 		require.Contains(t, out.String(), expectedOutput)
 	})
 
@@ -180,12 +180,12 @@ func TestISO0_Decode(t *testing.T) {
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PAN block  : 0000210123456789
-Formatted PIN block  : 041234FFFFFFFFFF
+Formatted PAN block  : ****************
+Formatted PIN block  : ****************
 PAD                  : FFFFFFFFFF
 Format               : Format 0 (ISO-0)
 ------------------------------------
-Decoded PIN  : 1234
+Decoded PIN  : ****
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -251,8 +251,8 @@ func TestISO3_Decode(t *testing.T) {
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PAN block  : 0000210123456789
-Formatted PIN block  : 341234FFFFFFFFFF`
+Formatted PAN block  : ****************
+Formatted PIN block  : ****************`
 		require.Contains(t, out.String(), expectedOutput)
 	})
 
@@ -303,13 +303,13 @@ func TestANSIX98(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PAN     : 5432101234567891
-PIN     : 1234
+PAN     : 543210******7891
+PIN     : ****
 PAD     : FFFFFFFFFF
 Format  : ANSI X9.8
 ------------------------------------
-Formatted PIN block  : 041215FEDCBA9876
-Formatted PAN block  : 0000210123456789
+Formatted PIN block  : ****************
+Formatted PAN block  : ****************
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -332,13 +332,13 @@ func TestECI1(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PAN     : 5432101234567891
-PIN     : 1234
+PAN     : 543210******7891
+PIN     : ****
 PAD     : FFFFFFFFFF
 Format  : ECI-1
 ------------------------------------
-Formatted PIN block  : 041215FEDCBA9876
-Formatted PAN block  : 0000210123456789
+Formatted PIN block  : ****************
+Formatted PAN block  : ****************
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -361,13 +361,13 @@ func TestVISA1(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PAN     : 5432101234567891
-PIN     : 1234
+PAN     : 543210******7891
+PIN     : ****
 PAD     : FFFFFFFFFF
 Format  : VISA-1
 ------------------------------------
-Formatted PIN block  : 041215FEDCBA9876
-Formatted PAN block  : 0000210123456789
+Formatted PIN block  : ****************
+Formatted PAN block  : ****************
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -390,13 +390,13 @@ func TestVISA4(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PAN     : 5432101234567891
-PIN     : 1234
+PAN     : 543210******7891
+PIN     : ****
 PAD     : FFFFFFFFFF
 Format  : VISA-4
 ------------------------------------
-Formatted PIN block  : 041215FEDCBA9876
-Formatted PAN block  : 0000210123456789
+Formatted PIN block  : ****************
+Formatted PAN block  : ****************
 
 `
 		require.Equal(t, expectedOutput, out.String())
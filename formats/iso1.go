@@ -3,16 +3,14 @@ package formats
 import (
 	"fmt"
 	"io"
-	"strings"
-	"text/tabwriter"
 )
 
 type iso1Object struct {
 	Filler string
 
-	version     string
-	format      string
-	debugWriter io.Writer
+	version string
+	format  string
+	settings
 }
 
 func (i *iso1Object) getVersion() string {
@@ -22,28 +20,25 @@ func (i *iso1Object) getVersion() string {
 	return iso1Version
 }
 
-// Padding returns padding pattern
-func (i *iso1Object) padding(pin string) (string, error) {
-	if len(pin) < 4 {
-		return "", fmt.Errorf("pin length must be between 4 and 12 digits")
-	}
+// SetDebugWriter will set writer for getting output message of encoding and decoding logic,
+// the PAN and the PIN are masked
+func (i *iso1Object) SetDebugWriter(writer io.Writer) {
+	i.setTracer(NewWriterTracer(writer, DefaultMask))
+}
 
-	length := 14 - len(pin)
-	if length < 1 {
-		return "", nil
-	}
+// SetTracer sets the tracer of the encode and decode operations
+func (i *iso1Object) SetTracer(tracer Tracer) {
+	i.setTracer(tracer)
+}
 
-	if i.Filler == "" {
-		// ISO2
-		//  fill is 0xF instead of random digits
-		return randomLetters(length, hexDigits)
-	}
-	return strings.Repeat(i.Filler, length), nil
+// SetValidation sets the checks of the PIN and the account
+func (i *iso1Object) SetValidation(validation Validation) {
+	i.setValidation(validation)
 }
 
-// SetDebugWriter will set writer for getting output message of encoding and decoding logic
-func (i *iso1Object) SetDebugWriter(writer io.Writer) {
-	i.debugWriter = tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+// copy returns a copy of the format with the same settings
+func (i *iso1Object) copy() copyable {
+	return copySettings(&iso1Object{Filler: i.Filler, version: i.version, format: i.format}, i)
 }
 
 // Encode returns the ISO1 PIN block for the given PIN
@@ -51,6 +46,67 @@ func (i *iso1Object) SetDebugWriter(writer io.Writer) {
 //	The `ISO-1` PIN block format is equivalent to an `ECI-4` PIN block format
 //	and is recommended for usage where no PAN data is available.
 func (i *iso1Object) Encode(pin, account string) (string, error) {
+	return encodeString(i.encode, pin, account)
+}
+
+// EncodePIN returns the ISO1 PIN block for the given PIN, the PIN is wiped
+func (i *iso1Object) EncodePIN(pin *PIN, account string) (string, error) {
+	defer pin.Wipe()
+	return i.encode(pin.Bytes(), account)
+}
+
+func (i *iso1Object) encode(pin []byte, account string) (string, error) {
+	pinBlock, err := i.EncodeBlock(pin, account)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(pinBlock[:])
+
+	return fmt.Sprintf("%X", pinBlock[:]), nil
+}
+
+func (i *iso1Object) Decode(pinBlock, account string) (string, error) {
+	return decodeString(i.decode, pinBlock, account)
+}
+
+// DecodePIN returns the PIN of an ISO1 PIN block
+func (i *iso1Object) DecodePIN(pinBlock, account string) (*PIN, error) {
+	pin, err := i.decode(pinBlock, account)
+	if err != nil {
+		return nil, err
+	}
+	return NewPIN(pin), nil
+}
+
+func (i *iso1Object) decode(pinBlock, account string) ([]byte, error) {
+	if len(pinBlock) != 16 {
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 characters")
+	}
+
+	var rawPinBlock [8]byte
+	defer wipe(rawPinBlock[:])
+
+	if err := packHex(rawPinBlock[:], []byte(pinBlock), nil); err != nil {
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlock, err.Error())
+	}
+
+	return i.DecodeBlock(nil, rawPinBlock, account)
+}
+
+// EncodeBlock returns the ISO1 PIN block for the given PIN, it does not
+// allocate unless the format is traced
+func (i *iso1Object) EncodeBlock(pin []byte, account string) ([8]byte, error) {
+	var pinBlock [8]byte
+	validation := i.validation()
+
+	if err := validation.checkPIN(i.format, pin, 12); err != nil {
+		return pinBlock, err
+	}
+
+	if err := validation.checkAccount(i.format, account, false); err != nil {
+		return pinBlock, err
+	}
+
 	isTruncated := false
 
 	// A PIN that is longer than 12 digits is truncated on the right.
@@ -59,75 +115,130 @@ func (i *iso1Object) Encode(pin, account string) (string, error) {
 		isTruncated = true
 	}
 
-	pad, err := i.padding(pin)
-	if err != nil {
-		return "", err
+	if len(pin) < 4 {
+		return pinBlock, newError(i.format, FieldNamePIN, ErrInvalidPINLength, "pin length must be between 4 and 12 digits")
+	}
+
+	if err := checkHex(pin); err != nil {
+		return pinBlock, newError(i.format, FieldNamePIN, ErrInvalidPIN, err.Error())
 	}
 
-	// A PIN that is longer than 12 digits is truncated on the right.
 	// The first nibble (which identifies the block format) has the value 1.
-	pinBlock := fmt.Sprintf("%s%X%s%s", i.getVersion(), len(pin), pin, pad)
+	var pinField [16]byte
+	defer wipe(pinField[:])
+
+	pinField[0] = i.getVersion()[0]
+	pinField[1] = upperHex[len(pin)]
+	copy(pinField[2:], pin)
+
+	// ISO1
+	//  fill is random digits
+	if err := fillField(pinField[2+len(pin):], i.Filler, hexDigits); err != nil {
+		return pinBlock, err
+	}
 
-	// write encode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block encode operation finished\n")
+	if err := packHex(pinBlock[:], pinField[:], nil); err != nil {
+		return pinBlock, newError(i.format, FieldNamePIN, ErrInvalidPIN, err.Error())
+	}
+
+	// trace encode information
+	if tracer := i.tracer(); tracer != nil {
+		var notes []string
 		if isTruncated {
-			fmt.Fprintf(tw, "The pin is truncated on the right as 12 digits\n")
+			notes = append(notes, "The pin is truncated on the right as 12 digits")
 		}
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "PIN\t: %s\n", pin)
-		if pad == "" {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(pinBlock))
-		tw.Write([]byte("\n"))
+		toUpper(pinField[:])
+		tracer.Trace(TraceEvent{
+			Step:   StepEncode,
+			Format: i.format,
+			Notes:  notes,
+			Fields: []TraceField{
+				{Name: "PIN", Kind: FieldPIN, Value: string(pin)},
+				{Name: "PAD", Kind: FieldText, Value: string(pinField[2+len(pin):])},
+			},
+			Results: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: string(pinField[:])},
+			},
+		})
 	}
 
-	return strings.ToUpper(pinBlock), nil
+	return pinBlock, nil
 }
 
-func (i *iso1Object) Decode(pinBlock, account string) (string, error) {
-	if len(pinBlock) != 16 {
-		return "", fmt.Errorf("pin block must be 16 characters")
+// DecodeBlock appends the PIN of an ISO1 PIN block to dst, it does not
+// allocate unless the format is traced or dst is too short
+func (i *iso1Object) DecodeBlock(dst []byte, pinBlock [8]byte, account string) ([]byte, error) {
+	validation := i.validation()
+
+	if err := validation.checkAccount(i.format, account, false); err != nil {
+		return dst, err
 	}
 
-	var pinLength int
-	var decodedBlock string
+	var decodedBlock [16]byte
+	defer wipe(decodedBlock[:])
+	unpackHex(decodedBlock[:], pinBlock[:])
 
-	_, err := fmt.Sscanf(pinBlock, i.getVersion()+"%01X%s", &pinLength, &decodedBlock)
-	if err != nil {
-		return "", fmt.Errorf("unable to parse pin block")
+	// the block starts with the version, then has the length of pin in hex,
+	// then has the pin and the fill
+	if decodedBlock[0] != i.getVersion()[0] {
+		return dst, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlock, "unable to parse pin block")
 	}
 
-	if len(decodedBlock) < pinLength {
-		return "", fmt.Errorf("parsed pin length is incorrect")
+	pinLength := int(pinBlock[0] & 0x0F)
+	if pinLength > 14 {
+		return dst, newError(i.format, FieldNamePINBlock, ErrInvalidPINLength, "parsed pin length is incorrect")
 	}
 
-	// write decode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block decode operation finished\n")
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(decodedBlock))
-		var pad string
-		if len(decodedBlock) > pinLength {
-			pad = decodedBlock[pinLength:]
+	if pinLength < 4 || pinLength > 12 {
+		if err := validation.checkDecoded(i.format, false, fmt.Sprintf("invalid pin length %d", pinLength)); err != nil {
+			return dst, err
 		}
-		if pad == "" {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
+	}
+
+	if err := validation.checkDecoded(i.format, isDecimal(decodedBlock[2:2+pinLength]), "pin digits must be decimal"); err != nil {
+		return dst, err
+	}
+
+	fill := decodedBlock[2+pinLength:]
+	if i.Filler != "" {
+		if err := validation.checkDecoded(i.format, isFill(fill, i.Filler[0]), "invalid fill"); err != nil {
+			return dst, err
 		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Decoded PIN\t: %s\n", decodedBlock[:pinLength])
-		tw.Write([]byte("\n"))
 	}
 
-	return decodedBlock[:pinLength], nil
+	start := len(dst)
+	dst = append(dst, decodedBlock[2:2+pinLength]...)
+	pin := dst[start:]
+
+	if err := validation.checkDecodedPIN(i.format, pin, 12); err != nil {
+		wipe(pin)
+		return dst[:start], err
+	}
+
+	// trace decode information
+	if tracer := i.tracer(); tracer != nil {
+		tracer.Trace(TraceEvent{
+			Step:   StepDecode,
+			Format: i.format,
+			Fields: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: string(decodedBlock[2:])},
+				{Name: "PAD", Kind: FieldText, Value: string(fill)},
+			},
+			Results: []TraceField{
+				{Name: "Decoded PIN", Kind: FieldPIN, Value: string(pin)},
+			},
+		})
+	}
+
+	return dst, nil
+}
+
+// EncodeBytes returns the 8 byte PIN block for the given PIN and account number
+func (i *iso1Object) EncodeBytes(pin, account string) ([]byte, error) {
+	return encodeBlockBytes(i, pin, account)
+}
+
+// DecodeBytes returns the PIN from an 8 byte PIN block
+func (i *iso1Object) DecodeBytes(pinBlock []byte, account string) (string, error) {
+	return decodeBlockBytes(i, pinBlock, account)
 }
@@ -38,6 +38,25 @@ func TestISO1(t *testing.T) {
 		require.Equal(t, "123456789012", pin)
 	})
 
+	t.Run("string and block", func(t *testing.T) {
+		iso1 := formats.NewISO1()
+		formats.SetValidation(iso1, formats.Validation{LenientDecode: true})
+
+		_, err := iso1.Encode("00 0", "")
+		require.ErrorIs(t, err, formats.ErrInvalidPIN)
+
+		_, err = iso1.(formats.BlockFormat).EncodeBlock([]byte("00 0"), "")
+		require.ErrorIs(t, err, formats.ErrInvalidPIN)
+
+		_, err = iso1.Decode("14123499999999G9", "")
+		require.ErrorIs(t, err, formats.ErrInvalidPINBlock)
+
+		// the fill of ISO-1 is random, any hex fill is valid
+		pin, err := iso1.Decode("1412349A9B9C9D9E", "")
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
 	t.Run("encode logs", func(t *testing.T) {
 
 		iso1 := formats.NewISO1()
@@ -52,7 +71,7 @@ func TestISO1(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PIN     : 1234`
+PIN     : ****`
 		require.Contains(t, out.String(), expectedOutput)
 	})
 
@@ -68,11 +87,11 @@ PIN     : 1234`
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PIN block  : 123456789012FF
+Formatted PIN block  : **************
 PAD                  : FF
 Format               : Format 1 (ISO-1)
 ------------------------------------
-Decoded PIN  : 123456789012
+Decoded PIN  : ****
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -123,11 +142,11 @@ func TestISO2(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PIN     : 1234
+PIN     : ****
 PAD     : FFFFFFFFFF
 Format  : Format 2 (ISO-2)
 ------------------------------------
-Formatted PIN block  : 241234FFFFFFFFFF
+Formatted PIN block  : ****************
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -145,11 +164,11 @@ Formatted PIN block  : 241234FFFFFFFFFF
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PIN block  : 123456789012FF
+Formatted PIN block  : **************
 PAD                  : FF
 Format               : Format 2 (ISO-2)
 ------------------------------------
-Decoded PIN  : 123456789012
+Decoded PIN  : ****
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -169,11 +188,11 @@ func TestECI4(t *testing.T) {
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PIN block  : 123456789012FF
+Formatted PIN block  : **************
 PAD                  : FF
 Format               : ECI-4
 ------------------------------------
-Decoded PIN  : 123456789012
+Decoded PIN  : ****
 
 `
 		require.Equal(t, expectedOutput, out.String())
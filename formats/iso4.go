@@ -5,27 +5,16 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
-	"text/tabwriter"
+	"sync/atomic"
 )
 
 type iso4Object struct {
 	Filler string
 
-	cipher      Cipher
-	format      string
-	debugWriter io.Writer
-}
-
-// Padding returns padding pattern
-func (i *iso4Object) padding(pin string) (string, error) {
-	// both pinBlock and panBlock are 16 bytes (128 bits)
-	if len(pin) < 4 || len(pin) > 12 {
-		return "", fmt.Errorf("pin length must be between 4 and 12 digits")
-	}
-
-	return strings.Repeat(i.Filler, 16-len(pin)-2), nil
+	cipher atomic.Pointer[Cipher]
+	format string
+	settings
 }
 
 func (i *iso4Object) SetCipher(cipher Cipher) {
@@ -37,161 +26,332 @@ func (i *iso4Object) SetCipher(cipher Cipher) {
 		return
 	}
 
-	i.cipher = cipher
+	i.cipher.Store(&cipher)
 }
 
-// SetDebugWriter will set writer for getting output message of encoding and decoding logic
+// getCipher returns the cipher of the PIN block
+func (i *iso4Object) getCipher() Cipher {
+	if cipher := i.cipher.Load(); cipher != nil {
+		return *cipher
+	}
+	return nil
+}
+
+// SetDebugWriter will set writer for getting output message of encoding and decoding logic,
+// the PAN and the PIN are masked
 func (i *iso4Object) SetDebugWriter(writer io.Writer) {
-	i.debugWriter = tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	i.setTracer(NewWriterTracer(writer, DefaultMask))
+}
+
+// SetTracer sets the tracer of the encode and decode operations
+func (i *iso4Object) SetTracer(tracer Tracer) {
+	i.setTracer(tracer)
+}
+
+// SetValidation sets the checks of the PIN and the account
+func (i *iso4Object) SetValidation(validation Validation) {
+	i.setValidation(validation)
+}
+
+// copy returns a copy of the format with the same settings
+func (i *iso4Object) copy() copyable {
+	format := &iso4Object{Filler: i.Filler, format: i.format}
+	format.SetCipher(i.getCipher())
+
+	return copySettings(format, i)
 }
 
 // Encode returns an ISO-4 formatted and encrypted PIN block
 func (i *iso4Object) Encode(pin, account string) (string, error) {
-	pad, err := i.padding(pin)
+	encryptedPinBlock, err := i.EncodeBytes(pin, account)
 	if err != nil {
 		return "", err
 	}
 
-	randomBytes := make([]byte, 8)
-	_, err = rand.Read(randomBytes)
+	return fmt.Sprintf("%X", encryptedPinBlock), nil
+}
+
+// EncodeBytes returns an ISO-4 formatted and encrypted PIN block of 16 bytes
+func (i *iso4Object) EncodeBytes(pin, account string) ([]byte, error) {
+	digits := []byte(pin)
+	defer wipe(digits)
+
+	return i.encode(digits, account)
+}
+
+// EncodePIN returns an ISO-4 formatted and encrypted PIN block, the PIN is
+// wiped
+func (i *iso4Object) EncodePIN(pin *PIN, account string) (string, error) {
+	defer pin.Wipe()
+
+	encryptedPinBlock, err := i.encode(pin.Bytes(), account)
 	if err != nil {
-		return "", fmt.Errorf("generating random bytes: %w", err)
+		return "", err
 	}
 
-	pinBlock := fmt.Sprintf("4%X%s%s%X", len(pin), pin, pad, randomBytes)
+	return fmt.Sprintf("%X", encryptedPinBlock), nil
+}
 
-	rawPinBlock, err := hex.DecodeString(pinBlock)
+func (i *iso4Object) encode(pin []byte, account string) ([]byte, error) {
+	encryptedPinBlock, err := i.EncodeBlock(pin, account)
 	if err != nil {
-		return "", fmt.Errorf("decoding pinBlock: %w", err)
+		return nil, err
 	}
 
-	blockA, err := i.cipher.Encrypt(rawPinBlock)
-	if err != nil {
-		return "", fmt.Errorf("encrypting pinBlock: %w", err)
+	return encryptedPinBlock[:], nil
+}
+
+// EncodeBlock returns an ISO-4 formatted and encrypted PIN block, it does
+// not allocate unless the format is traced or its cipher does not implement
+// BlockCipher
+func (i *iso4Object) EncodeBlock(pin []byte, account string) ([16]byte, error) {
+	var encryptedPinBlock [16]byte
+	validation := i.validation()
+	cipher := i.getCipher()
+
+	if err := validation.checkPIN(i.format, pin, 12); err != nil {
+		return encryptedPinBlock, err
 	}
 
-	if len(account) < 12 || len(account) > 19 {
-		return "", fmt.Errorf("account length must be between 12 and 19 digits")
+	if err := validation.checkAccount(i.format, account, true); err != nil {
+		return encryptedPinBlock, err
 	}
 
-	// 4-bit field with permissible values 0000 (zero) to 0111 (7) indicate
-	// a PAN length of 12 plus the value of the field (ranging then from 12
-	// to 19). If the PAN is less than 12 digits, the digits are right
-	// justified and padded to the left with zeros, and M is set to 0;
-	controlField := fmt.Sprintf("%X", len(account)-12)
+	// both pinBlock and panBlock are 16 bytes (128 bits)
+	if len(pin) < 4 || len(pin) > 12 {
+		return encryptedPinBlock, newError(i.format, FieldNamePIN, ErrInvalidPINLength, "pin length must be between 4 and 12 digits")
+	}
 
-	panBlock := fmt.Sprintf("%s%s%s", controlField, account, strings.Repeat("0", 32-len(account)-1))
+	// the PIN field is 4, the length of pin, the pin and the fill, as 16 hex
+	// characters, followed by 8 random bytes
+	var pinField [16]byte
+	defer wipe(pinField[:])
 
-	rawPanBlock, err := hex.DecodeString(panBlock)
-	if err != nil {
-		return "", fmt.Errorf("decoding panBlock: %w", err)
+	pinField[0] = '4'
+	pinField[1] = upperHex[len(pin)]
+	copy(pinField[2:], pin)
+	if err := fillField(pinField[2+len(pin):], i.Filler, hexCharacters); err != nil {
+		return encryptedPinBlock, err
 	}
 
-	blockB, err := xor(rawPanBlock, blockA)
-	if err != nil {
-		return "", fmt.Errorf("xor-ing block A and pan block: %w", err)
+	buffers := getBlockBuffers()
+	defer putBlockBuffers(buffers)
+
+	rawPinBlock := buffers.in[:]
+	if err := packHex(rawPinBlock[:8], pinField[:], nil); err != nil {
+		return encryptedPinBlock, wrapError(i.format, FieldNamePIN, ErrInvalidPIN, "decoding pinBlock", err)
 	}
 
-	encryptedPinBlock, err := i.cipher.Encrypt(blockB)
-	if err != nil {
-		return "", fmt.Errorf("encrypting block B: %w", err)
-	}
-
-	// write encode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block encode operation finished\n")
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "PAN\t: %s\n", account)
-		fmt.Fprintf(tw, "PIN\t: %s\n", pin)
-		if len(pad) == 0 {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "PAN block\t: %s\n", strings.ToUpper(panBlock))
-		fmt.Fprintf(tw, "PIN block\t: %s\n", strings.ToUpper(pinBlock))
-		fmt.Fprintf(tw, "Encrypted PIN block\t: %s\n", fmt.Sprintf("%X", encryptedPinBlock))
-		tw.Write([]byte("\n"))
+	if _, err := rand.Read(rawPinBlock[8:]); err != nil {
+		return encryptedPinBlock, fmt.Errorf("generating random bytes: %w", err)
 	}
 
-	return fmt.Sprintf("%X", encryptedPinBlock), nil
+	blockA := buffers.out[:]
+	if err := encryptTo(cipher, blockA, rawPinBlock); err != nil {
+		return encryptedPinBlock, wrapError(i.format, FieldNamePINBlock, ErrCipher, "encrypting pinBlock", err)
+	}
+
+	if len(account) < 12 || len(account) > 19 {
+		return encryptedPinBlock, newError(i.format, FieldNameAccount, ErrInvalidAccount, "account length must be between 12 and 19 digits")
+	}
+
+	panField := iso4PanField(account)
+
+	var rawPanBlock [16]byte
+	if err := packHex(rawPanBlock[:], panField[:], nil); err != nil {
+		return encryptedPinBlock, wrapError(i.format, FieldNameAccount, ErrInvalidAccount, "decoding panBlock", err)
+	}
+
+	// the clear PIN block is kept for the trace
+	var clearPinBlock [32]byte
+	defer wipe(clearPinBlock[:])
+	unpackHex(clearPinBlock[:], rawPinBlock)
+
+	// block B is block A XOR-ed with the PAN block
+	blockB := buffers.in[:]
+	for n := range blockB {
+		blockB[n] = blockA[n] ^ rawPanBlock[n]
+	}
+
+	if err := encryptTo(cipher, buffers.out[:], blockB); err != nil {
+		return encryptedPinBlock, wrapError(i.format, FieldNamePINBlock, ErrCipher, "encrypting block B", err)
+	}
+	copy(encryptedPinBlock[:], buffers.out[:])
+
+	// trace encode information
+	if tracer := i.tracer(); tracer != nil {
+		tracer.Trace(TraceEvent{
+			Step:   StepEncode,
+			Format: i.format,
+			Fields: []TraceField{
+				{Name: "PAN", Kind: FieldPAN, Value: account},
+				{Name: "PIN", Kind: FieldPIN, Value: string(pin)},
+				{Name: "PAD", Kind: FieldText, Value: string(pinField[2+len(pin):])},
+			},
+			Results: []TraceField{
+				{Name: "PAN block", Kind: FieldPANBlock, Value: strings.ToUpper(string(panField[:]))},
+				{Name: "PIN block", Kind: FieldClearBlock, Value: string(clearPinBlock[:])},
+				{Name: "Encrypted PIN block", Kind: FieldEncryptedBlock, Value: fmt.Sprintf("%X", encryptedPinBlock)},
+			},
+		})
+	}
+
+	return encryptedPinBlock, nil
 }
 
 // Decode returns the PIN from an ISO-4 encrypted PIN block
 func (i *iso4Object) Decode(pinBlock, account string) (string, error) {
+	return decodeString(i.decodeHex, pinBlock, account)
+}
+
+// DecodeBytes returns the PIN from an ISO-4 encrypted PIN block of 16 bytes
+func (i *iso4Object) DecodeBytes(encryptedPinBlock []byte, account string) (string, error) {
+	pin, err := i.decode(encryptedPinBlock, account)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(pin)
+
+	return string(pin), nil
+}
+
+// DecodePIN returns the PIN from an ISO-4 encrypted PIN block
+func (i *iso4Object) DecodePIN(pinBlock, account string) (*PIN, error) {
+	pin, err := i.decodeHex(pinBlock, account)
+	if err != nil {
+		return nil, err
+	}
+	return NewPIN(pin), nil
+}
+
+func (i *iso4Object) decodeHex(pinBlock, account string) ([]byte, error) {
 	if len(pinBlock) != 32 {
-		return "", fmt.Errorf("pinBlock must be 32 hex characters (16 bytes)")
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlockLength, "pinBlock must be 32 hex characters (16 bytes)")
 	}
 
 	encryptedPinBlock, err := hex.DecodeString(pinBlock)
 	if err != nil {
-		return "", fmt.Errorf("decoding pinBlock: %w", err)
+		return nil, wrapError(i.format, FieldNamePINBlock, ErrInvalidPINBlock, "decoding pinBlock", err)
 	}
 
-	blockB, err := i.cipher.Decrypt(encryptedPinBlock)
-	if err != nil {
-		return "", fmt.Errorf("decrypting pinBlock: %w", err)
+	return i.decode(encryptedPinBlock, account)
+}
+
+func (i *iso4Object) decode(encryptedPinBlock []byte, account string) ([]byte, error) {
+	if len(encryptedPinBlock) != 16 {
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 bytes")
+	}
+
+	return i.DecodeBlock(nil, [16]byte(encryptedPinBlock), account)
+}
+
+// DecodeBlock appends the PIN of an ISO-4 encrypted PIN block to dst, it
+// does not allocate unless the format is traced, its cipher does not
+// implement BlockCipher or dst is too short
+func (i *iso4Object) DecodeBlock(dst []byte, encryptedPinBlock [16]byte, account string) ([]byte, error) {
+	validation := i.validation()
+	cipher := i.getCipher()
+
+	if err := validation.checkAccount(i.format, account, true); err != nil {
+		return dst, err
+	}
+
+	buffers := getBlockBuffers()
+	defer putBlockBuffers(buffers)
+
+	copy(buffers.in[:], encryptedPinBlock[:])
+
+	blockB := buffers.out[:]
+	if err := decryptTo(cipher, blockB, buffers.in[:]); err != nil {
+		return dst, wrapError(i.format, FieldNamePINBlock, ErrCipher, "decrypting pinBlock", err)
 	}
 
 	if len(account) < 12 || len(account) > 19 {
-		return "", fmt.Errorf("account length must be between 12 and 19 digits")
+		return dst, newError(i.format, FieldNameAccount, ErrInvalidAccount, "account length must be between 12 and 19 digits")
 	}
 
-	controlField := fmt.Sprintf("%X", len(account)-12)
+	panField := iso4PanField(account)
 
-	panBlock := fmt.Sprintf("%s%s%s", controlField, account, strings.Repeat("0", 32-len(account)-1))
+	var rawPanBlock [16]byte
+	if err := packHex(rawPanBlock[:], panField[:], nil); err != nil {
+		return dst, wrapError(i.format, FieldNameAccount, ErrInvalidAccount, "decoding panBlock", err)
+	}
 
-	rawPanBlock, err := hex.DecodeString(panBlock)
-	if err != nil {
-		return "", fmt.Errorf("decoding panBlock: %w", err)
+	// block A is block B XOR-ed with the PAN block
+	blockA := buffers.in[:]
+	for n := range blockA {
+		blockA[n] = blockB[n] ^ rawPanBlock[n]
 	}
 
-	blockA, err := xor(rawPanBlock, blockB)
-	if err != nil {
-		return "", fmt.Errorf("xor-ing block B and pan block: %w", err)
+	rawPinBlock := buffers.out[:]
+	if err := decryptTo(cipher, rawPinBlock, blockA); err != nil {
+		return dst, wrapError(i.format, FieldNamePINBlock, ErrCipher, "decrypting block A", err)
 	}
 
-	rawPinBlock, err := i.cipher.Decrypt(blockA)
-	if err != nil {
-		return "", fmt.Errorf("decrypting block A: %w", err)
+	var plainPinBlock [32]byte
+	defer wipe(plainPinBlock[:])
+	unpackHex(plainPinBlock[:], rawPinBlock)
+
+	// plainPinBlock should now be the original pinBlock, we'll parse it to get the PIN.
+	pinLength := int(rawPinBlock[0] & 0x0F)
+	if pinLength < 4 || pinLength > 12 {
+		return dst, newError(i.format, FieldNamePINBlock, ErrInvalidPINLength, fmt.Sprintf("invalid pin length %d", pinLength))
+	}
+
+	if plainPinBlock[0] != '4' && !validation.LenientDecode {
+		return dst, newError(i.format, FieldNamePINBlock, ErrFormatMismatch, "format is different")
 	}
 
-	plainPinBlock := hex.EncodeToString(rawPinBlock)
+	if err := validation.checkDecoded(i.format, isDecimal(plainPinBlock[2:2+pinLength]), "pin digits must be decimal"); err != nil {
+		return dst, err
+	}
 
-	// rawPinBlock should now be the original pinBlock, we'll parse it to get the PIN.
-	if len(plainPinBlock) < 2 {
-		return "", fmt.Errorf("plain pin block too short")
+	if err := validation.checkDecoded(i.format, isFill(plainPinBlock[2+pinLength:16], i.Filler[0]), "invalid fill"); err != nil {
+		return dst, err
 	}
-	pinLength, err := strconv.ParseInt(string(plainPinBlock[1]), 16, 64)
-	if err != nil {
-		return "", fmt.Errorf("parsing pin length: %w", err)
+
+	start := len(dst)
+	dst = append(dst, plainPinBlock[2:2+pinLength]...)
+	pin := dst[start:]
+
+	if err := validation.checkDecodedPIN(i.format, pin, 12); err != nil {
+		wipe(pin)
+		return dst[:start], err
 	}
-	if pinLength < 4 || pinLength > 12 || 2+int(pinLength) > len(plainPinBlock) {
-		return "", fmt.Errorf("invalid pin length %d", pinLength)
+
+	// trace decode information
+	if tracer := i.tracer(); tracer != nil {
+		tracer.Trace(TraceEvent{
+			Step:   StepDecode,
+			Format: i.format,
+			Fields: []TraceField{
+				{Name: "Formatted PAN block", Kind: FieldPANBlock, Value: strings.ToUpper(string(panField[:]))},
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: string(plainPinBlock[:])},
+				{Name: "PAD", Kind: FieldText, Value: string(plainPinBlock[2+pinLength : 16])},
+			},
+			Results: []TraceField{
+				{Name: "Decoded PIN", Kind: FieldPIN, Value: string(pin)},
+			},
+		})
 	}
 
-	pin := string(plainPinBlock[2 : 2+pinLength])
+	return dst, nil
+}
+
+// iso4PanField returns the PAN block of an account of 12 to 19 digits as hex
+// characters
+func iso4PanField(account string) [32]byte {
+	var field [32]byte
 
-	// write decode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block decode operation finished\n")
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "Formatted PAN block\t: %s\n", strings.ToUpper(panBlock))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(plainPinBlock))
-		if pad, _ := i.padding(pin); len(pad) == 0 {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Decoded PIN\t: %s\n", pin)
-		tw.Write([]byte("\n"))
+	// 4-bit field with permissible values 0000 (zero) to 0111 (7) indicate
+	// a PAN length of 12 plus the value of the field (ranging then from 12
+	// to 19). If the PAN is less than 12 digits, the digits are right
+	// justified and padded to the left with zeros, and M is set to 0;
+	field[0] = upperHex[len(account)-12]
+	copy(field[1:], account)
+	for n := 1 + len(account); n < len(field); n++ {
+		field[n] = '0'
 	}
 
-	return pin, nil
+	return field
 }
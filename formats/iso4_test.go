@@ -2,6 +2,7 @@ package formats
 
 import (
 	"bytes"
+	"encoding/hex"
 	"testing"
 
 	"github.com/moov-io/pinblock/encryption"
@@ -62,12 +63,12 @@ func TestISO4(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PAN     : 432198765432109870
-PIN     : 12344
+PAN     : 432198********9870
+PIN     : ****
 PAD     : AAAAAAAAA
 Format  : Format 4 (ISO-4)
 ------------------------------------
-PAN block            : 64321987654321098700000000000000`
+PAN block            : ********************************`
 		require.Contains(t, out.String(), expectedOutput)
 
 		// flash buffer
@@ -83,3 +84,23 @@ PAN block            : 64321987654321098700000000000000`
 		require.Contains(t, out.String(), expectedOutput)
 	})
 }
+
+func TestISO4WithAesDukpt(t *testing.T) {
+	bdk, err := hex.DecodeString("FEDCBA9876543210F1F1F1F1F1F1F1F1")
+	require.NoError(t, err)
+
+	ksn, err := hex.DecodeString("123456789012345600000001")
+	require.NoError(t, err)
+
+	cipher, err := encryption.NewAesDukpt(bdk, ksn, 16)
+	require.NoError(t, err)
+
+	iso4 := NewISO4(cipher)
+
+	pinBlock, err := iso4.Encode("1234", "4111111111111111")
+	require.NoError(t, err)
+
+	pin, err := iso4.Decode(pinBlock, "4111111111111111")
+	require.NoError(t, err)
+	require.Equal(t, "1234", pin)
+}
@@ -1,21 +1,21 @@
 package formats
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"strings"
-	"text/tabwriter"
 )
 
 type oemObject struct {
-	format      string
-	debugWriter io.Writer
+	format string
+	settings
 }
 
 // Padding returns padding pattern
-func (i *oemObject) padding(pin string) (string, error) {
+func (i *oemObject) padding(pin []byte) (string, error) {
 	if len(pin) < 4 {
-		return "", fmt.Errorf("pin length must be between 4 and 12 digits")
+		return "", newError(i.format, FieldNamePIN, ErrInvalidPINLength, "pin length must be between 4 and 12 digits")
 	}
 
 	length := 16 - len(pin)
@@ -25,7 +25,7 @@ func (i *oemObject) padding(pin string) (string, error) {
 
 	var exclusiveLetter byte
 	for _, l := range hexLetters {
-		if !strings.Contains(pin, string(l)) {
+		if bytes.IndexByte(pin, l) < 0 {
 			exclusiveLetter = l
 			break
 		}
@@ -35,13 +35,49 @@ func (i *oemObject) padding(pin string) (string, error) {
 	return strings.Repeat(filler, length), nil
 }
 
-// SetDebugWriter will set writer for getting output message of encoding and decoding logic
+// SetDebugWriter will set writer for getting output message of encoding and decoding logic,
+// the PAN and the PIN are masked
 func (i *oemObject) SetDebugWriter(writer io.Writer) {
-	i.debugWriter = tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	i.setTracer(NewWriterTracer(writer, DefaultMask))
+}
+
+// SetTracer sets the tracer of the encode and decode operations
+func (i *oemObject) SetTracer(tracer Tracer) {
+	i.setTracer(tracer)
+}
+
+// SetValidation sets the checks of the PIN and the account
+func (i *oemObject) SetValidation(validation Validation) {
+	i.setValidation(validation)
+}
+
+// copy returns a copy of the format with the same settings
+func (i *oemObject) copy() copyable {
+	return copySettings(&oemObject{format: i.format}, i)
 }
 
 // Encode returns the OEM-1 PIN block for the given PIN
 func (i *oemObject) Encode(pin, account string) (string, error) {
+	return encodeString(i.encode, pin, account)
+}
+
+// EncodePIN returns the OEM-1 PIN block for the given PIN, the PIN is wiped
+func (i *oemObject) EncodePIN(pin *PIN, account string) (string, error) {
+	defer pin.Wipe()
+	return i.encode(pin.Bytes(), account)
+}
+
+func (i *oemObject) encode(pin []byte, account string) (string, error) {
+	validation := i.validation()
+
+	if err := validation.checkPIN(i.format, pin, 12); err != nil {
+		return "", err
+	}
+
+	if err := validation.checkAccount(i.format, account, false); err != nil {
+		return "", err
+	}
+
 	isTruncated := false
 
 	// A PIN that is longer than 12 digits is truncated on the right.
@@ -57,62 +93,114 @@ func (i *oemObject) Encode(pin, account string) (string, error) {
 
 	// Pad value has a 4-bit value from X’0′ to X’F’ and must be different from any PIN digit.
 	// The number of pad values for this format is in the range from 4 to 12, and all the pad values must have the same value.
-	pinBlock := fmt.Sprintf("%s%s", pin, pad)
+	pinBlock := make([]byte, 16)
+	defer wipe(pinBlock)
+
+	copy(pinBlock, pin)
+	copy(pinBlock[len(pin):], pad)
+	toUpper(pinBlock)
 
-	// write encode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block encode operation finished\n")
+	// trace encode information
+	if tracer := i.tracer(); tracer != nil {
+		var notes []string
 		if isTruncated {
-			fmt.Fprintf(tw, "The pin is truncated on the right as 12 digits\n")
-		}
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "PIN\t: %s\n", pin)
-		if pad == "" {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
+			notes = append(notes, "The pin is truncated on the right as 12 digits")
 		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(pinBlock))
-		tw.Write([]byte("\n"))
+		tracer.Trace(TraceEvent{
+			Step:   StepEncode,
+			Format: i.format,
+			Notes:  notes,
+			Fields: []TraceField{
+				{Name: "PIN", Kind: FieldPIN, Value: string(pin)},
+				{Name: "PAD", Kind: FieldText, Value: pad},
+			},
+			Results: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: string(pinBlock)},
+			},
+		})
 	}
 
-	return strings.ToUpper(pinBlock), nil
+	return string(pinBlock), nil
 }
 
 func (i *oemObject) Decode(pinBlock, account string) (string, error) {
+	return decodeString(i.decode, pinBlock, account)
+}
+
+// DecodePIN returns the PIN of an OEM-1 PIN block
+func (i *oemObject) DecodePIN(pinBlock, account string) (*PIN, error) {
+	pin, err := i.decode(pinBlock, account)
+	if err != nil {
+		return nil, err
+	}
+	return NewPIN(pin), nil
+}
+
+func (i *oemObject) decode(pinBlock, account string) ([]byte, error) {
+	validation := i.validation()
+
 	if len(pinBlock) != 16 {
-		return "", fmt.Errorf("pin block must be 16 characters")
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 characters")
+	}
+
+	if err := validation.checkAccount(i.format, account, false); err != nil {
+		return nil, err
 	}
 
 	// getting pin length (characters before the padding digit)
-	pinLength := len(strings.ReplaceAll(pinBlock, pinBlock[len(pinBlock)-1:], ""))
+	pinLength := len(pinBlock) - strings.Count(pinBlock, pinBlock[len(pinBlock)-1:])
 	if pinLength <= 0 || pinLength > len(pinBlock) {
-		return "", fmt.Errorf("invalid pin length %d", pinLength)
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINLength, fmt.Sprintf("invalid pin length %d", pinLength))
+	}
+
+	if err := validation.checkDecoded(i.format, pinLength >= 4 && pinLength <= 12, fmt.Sprintf("invalid pin length %d", pinLength)); err != nil {
+		return nil, err
+	}
+
+	if err := validation.checkDecoded(i.format, isDecimal(pinBlock[:pinLength]), "pin digits must be decimal"); err != nil {
+		return nil, err
 	}
 
-	// write decode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block decode operation finished\n")
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(pinBlock))
+	// the pad digit is not a digit of the PIN
+	if err := validation.checkDecoded(i.format, isHex(pinBlock) && isFill(pinBlock[pinLength:], pinBlock[len(pinBlock)-1]), "invalid fill"); err != nil {
+		return nil, err
+	}
+
+	pin := []byte(pinBlock[:pinLength])
+
+	if err := validation.checkDecodedPIN(i.format, pin, 12); err != nil {
+		wipe(pin)
+		return nil, err
+	}
+
+	// trace decode information
+	if tracer := i.tracer(); tracer != nil {
 		var pad string
 		if len(pinBlock) > pinLength {
 			pad = pinBlock[pinLength:]
 		}
-		if pad == "" {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Decoded PIN\t: %s\n", pinBlock[:pinLength])
-		tw.Write([]byte("\n"))
+		tracer.Trace(TraceEvent{
+			Step:   StepDecode,
+			Format: i.format,
+			Fields: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: strings.ToUpper(pinBlock)},
+				{Name: "PAD", Kind: FieldText, Value: pad},
+			},
+			Results: []TraceField{
+				{Name: "Decoded PIN", Kind: FieldPIN, Value: string(pin)},
+			},
+		})
 	}
 
-	return pinBlock[:pinLength], nil
+	return pin, nil
+}
+
+// EncodeBytes returns the 8 byte PIN block for the given PIN and account number
+func (i *oemObject) EncodeBytes(pin, account string) ([]byte, error) {
+	return encodeHexBytes(i, pin, account)
+}
+
+// DecodeBytes returns the PIN from an 8 byte PIN block
+func (i *oemObject) DecodeBytes(pinBlock []byte, account string) (string, error) {
+	return decodeHexBytes(i, pinBlock, account)
 }
@@ -52,11 +52,11 @@ func TestOEM1(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PIN     : 1234
+PIN     : ****
 PAD     : 555555555555
 Format  : Diebold, Docutel, NCR
 ------------------------------------
-Formatted PIN block  : 1234555555555555
+Formatted PIN block  : ****************
 
 `
 		require.Equal(t, out.String(), expectedOutput)
@@ -74,11 +74,11 @@ Formatted PIN block  : 1234555555555555
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PIN block  : 123456789012AAAA
+Formatted PIN block  : ****************
 PAD                  : AAAA
 Format               : Diebold, Docutel, NCR
 ------------------------------------
-Decoded PIN  : 123456789012
+Decoded PIN  : ****
 
 `
 		require.Equal(t, expectedOutput, out.String())
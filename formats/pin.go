@@ -0,0 +1,207 @@
+package formats
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// redacted is printed in place of a PIN
+const redacted = "[REDACTED]"
+
+// PIN is a clear PIN. The digits are held in a byte slice that is zeroed by
+// Wipe, unlike a string that lingers in memory until it is garbage collected.
+// A PIN never prints its digits: fmt prints [REDACTED] for every verb.
+//
+//	pin := formats.NewPIN(digits)
+//	pinBlock, err := iso0.EncodePIN(pin, account) // pin is wiped
+//
+//	pin, err := iso0.DecodePIN(pinBlock, account)
+//	defer pin.Wipe()
+type PIN struct {
+	digits []byte
+}
+
+// NewPIN returns a PIN holding digits. The PIN does not copy digits, the
+// slice is zeroed by Wipe.
+func NewPIN(digits []byte) *PIN {
+	return &PIN{
+		digits: digits,
+	}
+}
+
+// PINFromString returns a PIN holding a copy of pin. The string itself can
+// not be zeroed, it should be avoided where the PIN is available as bytes.
+func PINFromString(pin string) *PIN {
+	return NewPIN([]byte(pin))
+}
+
+// Bytes returns the digits of the PIN. The slice is zeroed by Wipe and must
+// not be retained.
+func (p *PIN) Bytes() []byte {
+	if p == nil {
+		return nil
+	}
+	return p.digits
+}
+
+// Len returns the number of digits of the PIN
+func (p *PIN) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.digits)
+}
+
+// Reveal returns the digits of the PIN as a string, for the APIs that only
+// accept strings. The string can not be wiped.
+func (p *PIN) Reveal() string {
+	if p == nil {
+		return ""
+	}
+	return string(p.digits)
+}
+
+// Equal reports whether p and other are the same PIN, in constant time for
+// PINs of the same length
+func (p *PIN) Equal(other *PIN) bool {
+	return subtle.ConstantTimeCompare(p.Bytes(), other.Bytes()) == 1
+}
+
+// Wipe zeroes the digits of the PIN. The PIN is empty afterwards.
+func (p *PIN) Wipe() {
+	if p == nil {
+		return
+	}
+	wipe(p.digits)
+	p.digits = nil
+}
+
+// String returns [REDACTED]
+func (p *PIN) String() string {
+	return redacted
+}
+
+// GoString returns [REDACTED]
+func (p *PIN) GoString() string {
+	return redacted
+}
+
+// Format prints [REDACTED] for every verb
+func (p *PIN) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redacted)
+}
+
+// PINFormat is a Format that encodes and decodes PIN values. All the formats
+// of this package implement PINFormat, their Encode and Decode methods are
+// string adapters of EncodePIN and DecodePIN.
+type PINFormat interface {
+	Format
+
+	// EncodePIN returns the PIN block of pin. The PIN is wiped, even when
+	// an error is returned.
+	EncodePIN(pin *PIN, account string) (string, error)
+
+	// DecodePIN returns the PIN of pinBlock. The caller wipes the PIN when
+	// it is done with it.
+	DecodePIN(pinBlock, account string) (*PIN, error)
+}
+
+var (
+	_ PINFormat = (*iso0Object)(nil)
+	_ PINFormat = (*iso1Object)(nil)
+	_ PINFormat = (*iso4Object)(nil)
+	_ PINFormat = (*eciObject)(nil)
+	_ PINFormat = (*oemObject)(nil)
+	_ PINFormat = (*visa3Object)(nil)
+	_ PINFormat = (*encryptedObject)(nil)
+)
+
+// EncodePIN returns the PIN block of pin encoded with format and wipes pin.
+// Formats that do not implement PINFormat are given the PIN as a string.
+func EncodePIN(format Format, pin *PIN, account string) (string, error) {
+	if f, ok := format.(PINFormat); ok {
+		return f.EncodePIN(pin, account)
+	}
+
+	defer pin.Wipe()
+
+	return format.Encode(pin.Reveal(), account)
+}
+
+// DecodePIN returns the PIN of pinBlock decoded with format. Formats that do
+// not implement PINFormat return the PIN as a string.
+func DecodePIN(format Format, pinBlock, account string) (*PIN, error) {
+	if f, ok := format.(PINFormat); ok {
+		return f.DecodePIN(pinBlock, account)
+	}
+
+	pin, err := format.Decode(pinBlock, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return PINFromString(pin), nil
+}
+
+// encodeString is the string adapter of the encode function of a format
+func encodeString(encode func(pin []byte, account string) (string, error), pin, account string) (string, error) {
+	digits := []byte(pin)
+	defer wipe(digits)
+
+	return encode(digits, account)
+}
+
+// decodeString is the string adapter of the decode function of a format
+func decodeString(decode func(pinBlock, account string) ([]byte, error), pinBlock, account string) (string, error) {
+	digits, err := decode(pinBlock, account)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(digits)
+
+	return string(digits), nil
+}
+
+// wipe zeroes b
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// upperHex are the upper case hex digits
+const upperHex = "0123456789ABCDEF"
+
+// toUpper converts the ASCII letters of b to upper case
+func toUpper(b []byte) {
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+}
+
+// hexValue returns the value of the hex character c
+func hexValue(c byte) (byte, error) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', nil
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, nil
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, nil
+	}
+	return 0, hex.InvalidByteError(c)
+}
+
+// checkHex returns an error for the first character of s that is not hex
+func checkHex[T string | []byte](s T) error {
+	for i := 0; i < len(s); i++ {
+		if _, err := hexValue(s[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package formats_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPIN(t *testing.T) {
+	account := "5432101234567891"
+
+	t.Run("redacted", func(t *testing.T) {
+		pin := formats.PINFromString("1234")
+
+		for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q", "%d", "%x"} {
+			require.Equal(t, "[REDACTED]", fmt.Sprintf(verb, pin), verb)
+		}
+		require.Equal(t, "[REDACTED]", fmt.Sprint(pin))
+		require.Equal(t, "1234", pin.Reveal())
+	})
+
+	t.Run("wipe", func(t *testing.T) {
+		digits := []byte("1234")
+		pin := formats.NewPIN(digits)
+		require.Equal(t, 4, pin.Len())
+
+		pin.Wipe()
+		require.Equal(t, []byte{0, 0, 0, 0}, digits)
+		require.Equal(t, 0, pin.Len())
+		require.Empty(t, pin.Reveal())
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		require.True(t, formats.PINFromString("1234").Equal(formats.PINFromString("1234")))
+		require.False(t, formats.PINFromString("1234").Equal(formats.PINFromString("1235")))
+		require.False(t, formats.PINFromString("1234").Equal(formats.PINFromString("12345")))
+	})
+
+	t.Run("ISO-0", func(t *testing.T) {
+		iso0 := formats.NewISO0().(formats.PINFormat)
+
+		digits := []byte("1234")
+		pinBlock, err := iso0.EncodePIN(formats.NewPIN(digits), account)
+		require.NoError(t, err)
+		require.Equal(t, "041215FEDCBA9876", pinBlock)
+		require.Equal(t, []byte{0, 0, 0, 0}, digits)
+
+		pin, err := iso0.DecodePIN(pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin.Reveal())
+	})
+
+	t.Run("wiped on error", func(t *testing.T) {
+		digits := []byte("123")
+		_, err := formats.NewISO0().(formats.PINFormat).EncodePIN(formats.NewPIN(digits), account)
+		require.Error(t, err)
+		require.Equal(t, []byte{0, 0, 0}, digits)
+	})
+
+	t.Run("all formats", func(t *testing.T) {
+		for _, name := range []string{
+			"ISO-0", "ISO-1", "ISO-2", "ISO-3", "ISO-4", "ANSI", "OEM-1",
+			"ECI1", "ECI2", "ECI3", "ECI4", "VISA1", "VISA2", "VISA3", "VISA4",
+		} {
+			format, err := formats.NewFormatter(name)
+			require.NoError(t, err)
+
+			pinBlock, err := formats.EncodePIN(format, formats.PINFromString("1234"), account)
+			require.NoError(t, err, name)
+
+			pin, err := formats.DecodePIN(format, pinBlock, account)
+			require.NoError(t, err, name)
+			require.Equal(t, "1234", pin.Reveal(), name)
+		}
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		key, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+		require.NoError(t, err)
+
+		cipher, err := encryption.NewTdesECB(key)
+		require.NoError(t, err)
+
+		iso0, err := formats.NewFormatter("ISO-0", formats.WithCipher(cipher))
+		require.NoError(t, err)
+
+		pinBlock, err := formats.EncodePIN(iso0, formats.PINFromString("1234"), account)
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", pinBlock)
+
+		pin, err := formats.DecodePIN(iso0, pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin.Reveal())
+	})
+
+	t.Run("not a PINFormat", func(t *testing.T) {
+		digits := []byte("1234")
+		pinBlock, err := formats.EncodePIN(&hexOnlyObject{}, formats.NewPIN(digits), account)
+		require.NoError(t, err)
+		require.Equal(t, "1234FFFFFFFFFFFF", pinBlock)
+		require.Equal(t, []byte{0, 0, 0, 0}, digits)
+
+		pin, err := formats.DecodePIN(&hexOnlyObject{}, pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin.Reveal())
+	})
+}
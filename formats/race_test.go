@@ -0,0 +1,8 @@
+//go:build race
+
+package formats_test
+
+func init() {
+	// the race detector drops the items of sync.Pool and allocates
+	raceEnabled = true
+}
@@ -0,0 +1,215 @@
+package formats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/moov-io/pinblock/encryption"
+)
+
+// Options configures a format created by a registered constructor
+type Options struct {
+	// Cipher encrypts the PIN block. ISO-4 is encrypted by design, other
+	// formats are wrapped with NewEncrypted.
+	Cipher Cipher
+
+	// Filler replaces the fill digit of the formats with a fixed fill, such as
+	// the F of ISO-0 and ISO-2 or the A of ISO-4.
+	Filler string
+
+	// Validation sets the checks of the PIN and the account
+	Validation Validation
+
+	// Tracer receives the trace events of the format
+	Tracer Tracer
+}
+
+// Option sets a value of Options
+type Option func(*Options)
+
+// WithCipher sets the cipher of the format
+func WithCipher(cipher Cipher) Option {
+	return func(o *Options) {
+		o.Cipher = cipher
+	}
+}
+
+// WithFiller sets the fill digit of the format
+func WithFiller(filler string) Option {
+	return func(o *Options) {
+		o.Filler = filler
+	}
+}
+
+// WithValidation sets the checks of the PIN and the account of the format
+func WithValidation(validation Validation) Option {
+	return func(o *Options) {
+		o.Validation = validation
+	}
+}
+
+// WithTracer sets the tracer of the format, nil turns tracing off
+func WithTracer(tracer Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = tracer
+	}
+}
+
+// Constructor creates a format from options. It returns an error for options
+// the format does not support.
+type Constructor func(options Options) (Format, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Constructor{
+		"ISO-0": newBuiltin(NewISO0),
+		"ISO-1": newBuiltin(NewISO1),
+		"ISO-2": newBuiltin(NewISO2),
+		"ISO-3": newBuiltin(NewISO3),
+		"ISO-4": newISO4,
+		"ANSI":  newBuiltin(NewANSIX98),
+		"OEM-1": newBuiltin(NewOEM1),
+		"ECI1":  newBuiltin(NewECI1),
+		"ECI2":  newBuiltin(NewECI2),
+		"ECI3":  newBuiltin(NewECI3),
+		"ECI4":  newBuiltin(NewECI4),
+		"VISA1": newBuiltin(NewVISA1),
+		"VISA2": newBuiltin(NewVISA2),
+		"VISA3": newBuiltin(NewVISA3),
+		"VISA4": newBuiltin(NewVISA4),
+	}
+)
+
+// Register makes a format available by name to NewFormatter, for example a
+// proprietary format or a preconfigured one. A name can be registered once.
+func Register(name string, constructor Constructor) error {
+	if name == "" {
+		return fmt.Errorf("format name is required")
+	}
+
+	if constructor == nil {
+		return fmt.Errorf("constructor of format %s is required", name)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		return fmt.Errorf("format %s is already registered", name)
+	}
+
+	registry[name] = constructor
+
+	return nil
+}
+
+// Lookup returns the constructor of the format registered with name
+func Lookup(name string) (Constructor, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	constructor, ok := registry[name]
+	return constructor, ok
+}
+
+// List returns the sorted names of the registered formats
+func List() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewFormatter returns the format registered with bType, configured with opts
+//
+//	iso4, err := formats.NewFormatter("ISO-4", formats.WithCipher(aesCipher))
+func NewFormatter(bType string, opts ...Option) (Format, error) {
+	constructor, ok := Lookup(bType)
+	if !ok {
+		return nil, newError("", FieldNameFormat, ErrUnsupportedFormat, "unsupported pinblock type")
+	}
+
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return constructor(options)
+}
+
+// newBuiltin returns the constructor of an 8 byte format of this package
+func newBuiltin(newFormat func() Format) Constructor {
+	return func(options Options) (Format, error) {
+		format := newFormat()
+
+		if options.Filler != "" {
+			if err := setFiller(format, options.Filler); err != nil {
+				return nil, err
+			}
+		}
+
+		SetValidation(format, options.Validation)
+		SetTracer(format, options.Tracer)
+
+		if options.Cipher != nil {
+			return NewEncrypted(format, options.Cipher), nil
+		}
+
+		return format, nil
+	}
+}
+
+func newISO4(options Options) (Format, error) {
+	cipher := options.Cipher
+	if cipher == nil {
+		cipher = encryption.NewNoOp()
+	}
+
+	format := NewISO4(cipher)
+	SetValidation(format, options.Validation)
+	SetTracer(format, options.Tracer)
+
+	if options.Filler != "" {
+		if err := setFiller(format, options.Filler); err != nil {
+			return nil, err
+		}
+	}
+
+	return format, nil
+}
+
+// setFiller replaces the fill digit of the formats with a fixed fill. Random
+// fills (ISO-1, ISO-3, ...) can not be replaced.
+func setFiller(format Format, filler string) error {
+	if len(filler) != 1 || !strings.Contains(string(hexLetters), strings.ToUpper(filler)) {
+		return newError(describe(format), FieldNameFiller, ErrInvalidFiller, "filler must be a single hex character")
+	}
+
+	filler = strings.ToUpper(filler)
+
+	switch f := format.(type) {
+	case *iso0Object:
+		if f.Filler != "" {
+			f.Filler = filler
+			return nil
+		}
+	case *iso1Object:
+		if f.Filler != "" {
+			f.Filler = filler
+			return nil
+		}
+	case *iso4Object:
+		f.Filler = filler
+		return nil
+	}
+
+	return newError(describe(format), FieldNameFiller, ErrInvalidFiller, "format does not support a fixed filler")
+}
@@ -0,0 +1,161 @@
+package formats_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+// reversedObject is a proprietary format, the PIN is written backwards
+type reversedObject struct{}
+
+func (r *reversedObject) SetDebugWriter(writer io.Writer) {}
+
+func (r *reversedObject) Encode(pin, account string) (string, error) {
+	block := []byte(fmt.Sprintf("%-16s", pin))
+	for i, j := 0, len(pin)-1; i < j; i, j = i+1, j-1 {
+		block[i], block[j] = block[j], block[i]
+	}
+	return string(block), nil
+}
+
+func (r *reversedObject) Decode(pinBlock, account string) (string, error) {
+	return "", fmt.Errorf("not implemented")
+}
+
+func TestNewFormatter(t *testing.T) {
+	t.Run("built-in formats", func(t *testing.T) {
+		for _, name := range []string{
+			"ISO-0", "ISO-1", "ISO-2", "ISO-3", "ISO-4", "ANSI", "OEM-1",
+			"ECI1", "ECI2", "ECI3", "ECI4", "VISA1", "VISA2", "VISA3", "VISA4",
+		} {
+			format, err := formats.NewFormatter(name)
+			require.NoError(t, err, name)
+
+			pinBlock, err := format.Encode("1234", "5432101234567891")
+			require.NoError(t, err, name)
+
+			pin, err := format.Decode(pinBlock, "5432101234567891")
+			require.NoError(t, err, name)
+			require.Equal(t, "1234", pin, name)
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, err := formats.NewFormatter("ISO-9")
+		require.EqualError(t, err, "unsupported pinblock type")
+	})
+
+	t.Run("ISO-4 with cipher", func(t *testing.T) {
+		cipher, err := encryption.NewAesECB([]byte("1234567890123456"))
+		require.NoError(t, err)
+
+		iso4, err := formats.NewFormatter("ISO-4", formats.WithCipher(cipher))
+		require.NoError(t, err)
+
+		pinBlock, err := iso4.Encode("1234", "432198765432109870")
+		require.NoError(t, err)
+
+		// the block is decoded with the same key
+		pin, err := formats.NewISO4(cipher).Decode(pinBlock, "432198765432109870")
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("ISO-0 with cipher", func(t *testing.T) {
+		cipher, err := encryption.NewTdesECB([]byte("0123456789ABCDEF"))
+		require.NoError(t, err)
+
+		iso0, err := formats.NewFormatter("ISO-0", formats.WithCipher(cipher))
+		require.NoError(t, err)
+
+		pinBlock, err := iso0.Encode("1234", "5432101234567891")
+		require.NoError(t, err)
+		require.NotEqual(t, "041215FEDCBA9876", pinBlock)
+
+		pin, err := formats.NewEncrypted(formats.NewISO0(), cipher).Decode(pinBlock, "5432101234567891")
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("filler", func(t *testing.T) {
+		iso2, err := formats.NewFormatter("ISO-2", formats.WithFiller("e"))
+		require.NoError(t, err)
+
+		pinBlock, err := iso2.Encode("1234", "")
+		require.NoError(t, err)
+		require.Equal(t, "241234EEEEEEEEEE", pinBlock)
+
+		iso4, err := formats.NewFormatter("ISO-4", formats.WithFiller("B"))
+		require.NoError(t, err)
+
+		pinBlock, err = iso4.Encode("1234", "432198765432109870")
+		require.NoError(t, err)
+
+		// with the NoOp cipher the first half is the PIN field XOR-ed with the
+		// PAN field, the fill differs by one bit from the default A fill
+		require.Equal(t, "20202D3CDEF89AB2", pinBlock[:16])
+
+		_, err = formats.NewFormatter("ISO-3", formats.WithFiller("F"))
+		require.EqualError(t, err, "format does not support a fixed filler")
+
+		_, err = formats.NewFormatter("ISO-0", formats.WithFiller("FF"))
+		require.EqualError(t, err, "filler must be a single hex character")
+
+		_, err = formats.NewFormatter("ISO-0", formats.WithFiller("G"))
+		require.EqualError(t, err, "filler must be a single hex character")
+	})
+}
+
+func TestRegister(t *testing.T) {
+	// the registry is global, the name must be unique when tests run repeatedly
+	name := fmt.Sprintf("REVERSED-%d", time.Now().UnixNano())
+
+	err := formats.Register(name, func(options formats.Options) (formats.Format, error) {
+		if options.Cipher != nil {
+			return nil, fmt.Errorf("cipher is not supported")
+		}
+		return &reversedObject{}, nil
+	})
+	require.NoError(t, err)
+
+	require.Contains(t, formats.List(), name)
+	require.Contains(t, formats.List(), "OEM-1")
+
+	constructor, ok := formats.Lookup(name)
+	require.True(t, ok)
+
+	format, err := constructor(formats.Options{})
+	require.NoError(t, err)
+
+	pinBlock, err := format.Encode("1234", "")
+	require.NoError(t, err)
+	require.Equal(t, "4321            ", pinBlock)
+
+	_, err = formats.NewFormatter(name, formats.WithCipher(encryption.NewNoOp()))
+	require.EqualError(t, err, "cipher is not supported")
+
+	err = formats.Register(name, func(options formats.Options) (formats.Format, error) {
+		return &reversedObject{}, nil
+	})
+	require.EqualError(t, err, fmt.Sprintf("format %s is already registered", name))
+
+	err = formats.Register("ISO-0", func(options formats.Options) (formats.Format, error) {
+		return &reversedObject{}, nil
+	})
+	require.EqualError(t, err, "format ISO-0 is already registered")
+
+	err = formats.Register("", nil)
+	require.EqualError(t, err, "format name is required")
+
+	err = formats.Register("NIL", nil)
+	require.EqualError(t, err, "constructor of format NIL is required")
+
+	_, ok = formats.Lookup("NIL")
+	require.False(t, ok)
+}
@@ -0,0 +1,257 @@
+package formats
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Steps of a trace event
+const (
+	StepEncode = "encode"
+	StepDecode = "decode"
+)
+
+// FieldKind tells how sensitive the value of a trace field is, masks use it
+// to hide the PAN and the PIN
+type FieldKind int
+
+const (
+	// FieldText is a value that is not sensitive, such as the fill digits
+	FieldText FieldKind = iota
+
+	// FieldPAN is the primary account number
+	FieldPAN
+
+	// FieldPANBlock is a block made of the digits of the PAN
+	FieldPANBlock
+
+	// FieldPIN is the clear PIN
+	FieldPIN
+
+	// FieldClearBlock is a clear PIN block, or a field that contains the PIN
+	FieldClearBlock
+
+	// FieldEncryptedBlock is an encrypted PIN block
+	FieldEncryptedBlock
+)
+
+// TraceField is a named value of a trace event
+type TraceField struct {
+	Name  string
+	Kind  FieldKind
+	Value string
+}
+
+// TraceEvent describes an encode or decode operation of a format. The values
+// of the fields are not masked, the tracer masks them.
+type TraceEvent struct {
+	// Step is StepEncode or StepDecode
+	Step string
+
+	// Format is the description of the format, such as Format 0 (ISO-0)
+	Format string
+
+	// Notes are remarks on the operation, such as a truncated PIN
+	Notes []string
+
+	// Fields are the inputs of the operation
+	Fields []TraceField
+
+	// Results are the blocks and the PIN computed by the operation
+	Results []TraceField
+}
+
+// Tracer receives the trace events of the formats. The events contain the
+// clear PAN and PIN, a tracer masks them before they are written anywhere.
+type Tracer interface {
+	Trace(event TraceEvent)
+}
+
+// TracerFunc is a function used as a Tracer
+type TracerFunc func(event TraceEvent)
+
+// Trace calls f(event)
+func (f TracerFunc) Trace(event TraceEvent) {
+	f(event)
+}
+
+// Traceable is a Format that sends its trace events to a Tracer. All the
+// formats of this package implement Traceable.
+type Traceable interface {
+	Format
+
+	// SetTracer sets the tracer of the format, nil turns tracing off
+	SetTracer(tracer Tracer)
+}
+
+var (
+	_ Traceable = (*iso0Object)(nil)
+	_ Traceable = (*iso1Object)(nil)
+	_ Traceable = (*iso4Object)(nil)
+	_ Traceable = (*eciObject)(nil)
+	_ Traceable = (*oemObject)(nil)
+	_ Traceable = (*visa3Object)(nil)
+	_ Traceable = (*encryptedObject)(nil)
+)
+
+// SetTracer sets the tracer of format. It returns false when the format does
+// not implement Traceable.
+func SetTracer(format Format, tracer Tracer) bool {
+	f, ok := format.(Traceable)
+	if ok {
+		f.SetTracer(tracer)
+	}
+	return ok
+}
+
+// Mask returns the value of a trace field as it is written by a tracer
+type Mask func(kind FieldKind, value string) string
+
+// DefaultMask keeps the first 6 and the last 4 digits of the PAN and hides
+// the PIN, the clear PIN blocks and the PAN blocks. Encrypted PIN blocks and
+// the other values are kept.
+func DefaultMask(kind FieldKind, value string) string {
+	switch kind {
+	case FieldPAN:
+		return MaskPAN(value)
+	case FieldPIN:
+		return "****"
+	case FieldClearBlock, FieldPANBlock:
+		return strings.Repeat("*", len(value))
+	default:
+		return value
+	}
+}
+
+// NoMask keeps every value in clear. It must only be used with test keys.
+func NoMask(kind FieldKind, value string) string {
+	return value
+}
+
+// MaskPAN replaces the digits of pan with *, except the first 6 and the last
+// 4. A PAN shorter than 13 digits is masked entirely but its last 4 digits.
+func MaskPAN(pan string) string {
+	keep := 6
+	if len(pan) < 13 {
+		keep = 0
+	}
+
+	if len(pan) <= keep+4 {
+		return strings.Repeat("*", len(pan))
+	}
+
+	return pan[:keep] + strings.Repeat("*", len(pan)-keep-4) + pan[len(pan)-4:]
+}
+
+// writerTracer writes the trace events as text, aligned with a tabwriter
+type writerTracer struct {
+	mu   sync.Mutex
+	tw   *tabwriter.Writer
+	mask Mask
+}
+
+// NewWriterTracer returns a tracer that writes the events to writer as text
+// and masks their values with mask, DefaultMask when it is nil
+//
+//	PIN block encode operation finished
+//	************************************
+//	PAN     : 543210******7891
+//	PIN     : ****
+//	PAD     : FFFFFFFFFF
+//	Format  : Format 0 (ISO-0)
+//	------------------------------------
+//	Formatted PIN block  : ****************
+//	Formatted PAN block  : ****************
+func NewWriterTracer(writer io.Writer, mask Mask) Tracer {
+	if mask == nil {
+		mask = DefaultMask
+	}
+
+	return &writerTracer{
+		tw:   tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0),
+		mask: mask,
+	}
+}
+
+// Trace writes the event
+func (t *writerTracer) Trace(event TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tw := t.tw
+	fmt.Fprintf(tw, "PIN block %s operation finished\n", event.Step)
+	for _, note := range event.Notes {
+		fmt.Fprintf(tw, "%s\n", note)
+	}
+	fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
+	t.writeFields(event.Fields)
+	fmt.Fprintf(tw, "Format\t: %s\n", event.Format)
+	fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
+	t.writeFields(event.Results)
+	fmt.Fprintf(tw, "\n")
+	tw.Flush()
+}
+
+func (t *writerTracer) writeFields(fields []TraceField) {
+	for _, field := range fields {
+		value := t.mask(field.Kind, field.Value)
+		if value == "" {
+			value = "N/A"
+		}
+		fmt.Fprintf(t.tw, "%s\t: %s\n", field.Name, value)
+	}
+}
+
+// slogTracer logs the trace events as structured records
+type slogTracer struct {
+	logger *slog.Logger
+	mask   Mask
+}
+
+// NewSlogTracer returns a tracer that logs the events to handler at the debug
+// level and masks their values with mask, DefaultMask when it is nil. The
+// fields are logged as attributes in snake case:
+//
+//	level=DEBUG msg="pin block encode" format="Format 0 (ISO-0)" pan=543210******7891 pin=**** ...
+func NewSlogTracer(handler slog.Handler, mask Mask) Tracer {
+	if mask == nil {
+		mask = DefaultMask
+	}
+
+	return &slogTracer{
+		logger: slog.New(handler),
+		mask:   mask,
+	}
+}
+
+// Trace logs the event
+func (t *slogTracer) Trace(event TraceEvent) {
+	ctx := context.Background()
+	if !t.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, 2+len(event.Fields)+len(event.Results))
+	attrs = append(attrs, slog.String("format", event.Format))
+	if len(event.Notes) > 0 {
+		attrs = append(attrs, slog.Any("notes", event.Notes))
+	}
+	for _, field := range event.Fields {
+		attrs = append(attrs, t.attr(field))
+	}
+	for _, field := range event.Results {
+		attrs = append(attrs, t.attr(field))
+	}
+
+	t.logger.LogAttrs(ctx, slog.LevelDebug, "pin block "+event.Step, attrs...)
+}
+
+func (t *slogTracer) attr(field TraceField) slog.Attr {
+	key := strings.ReplaceAll(strings.ToLower(field.Name), " ", "_")
+	return slog.String(key, t.mask(field.Kind, field.Value))
+}
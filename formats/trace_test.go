@@ -0,0 +1,146 @@
+package formats_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskPAN(t *testing.T) {
+	require.Equal(t, "543210******7891", formats.MaskPAN("5432101234567891"))
+	require.Equal(t, "432198********9870", formats.MaskPAN("432198765432109870"))
+	require.Equal(t, "543210***4567", formats.MaskPAN("5432101234567"))
+	require.Equal(t, "********4567", formats.MaskPAN("210123454567"))
+	require.Equal(t, "****", formats.MaskPAN("4567"))
+	require.Equal(t, "", formats.MaskPAN(""))
+}
+
+func TestDefaultMask(t *testing.T) {
+	require.Equal(t, "543210******7891", formats.DefaultMask(formats.FieldPAN, "5432101234567891"))
+	require.Equal(t, "****", formats.DefaultMask(formats.FieldPIN, "123456"))
+	require.Equal(t, "****************", formats.DefaultMask(formats.FieldClearBlock, "041215FEDCBA9876"))
+	require.Equal(t, "****************", formats.DefaultMask(formats.FieldPANBlock, "0000210123456789"))
+	require.Equal(t, "BA2ADC4EBA48F711", formats.DefaultMask(formats.FieldEncryptedBlock, "BA2ADC4EBA48F711"))
+	require.Equal(t, "FFFFFFFFFF", formats.DefaultMask(formats.FieldText, "FFFFFFFFFF"))
+}
+
+func TestTracer(t *testing.T) {
+	account := "5432101234567891"
+
+	t.Run("events", func(t *testing.T) {
+		var events []formats.TraceEvent
+		iso0 := formats.NewISO0()
+		require.True(t, formats.SetTracer(iso0, formats.TracerFunc(func(event formats.TraceEvent) {
+			events = append(events, event)
+		})))
+
+		pinBlock, err := iso0.Encode("1234", account)
+		require.NoError(t, err)
+
+		_, err = iso0.Decode(pinBlock, account)
+		require.NoError(t, err)
+
+		require.Len(t, events, 2)
+		require.Equal(t, formats.StepEncode, events[0].Step)
+		require.Equal(t, "Format 0 (ISO-0)", events[0].Format)
+		require.Equal(t, formats.TraceField{Name: "PIN", Kind: formats.FieldPIN, Value: "1234"}, events[0].Fields[1])
+		require.Equal(t, formats.StepDecode, events[1].Step)
+		require.Equal(t, formats.TraceField{Name: "Decoded PIN", Kind: formats.FieldPIN, Value: "1234"}, events[1].Results[0])
+
+		// tracing is turned off
+		formats.SetTracer(iso0, nil)
+		_, err = iso0.Encode("1234", account)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+	})
+
+	t.Run("writer without mask", func(t *testing.T) {
+		iso0 := formats.NewISO0()
+		out := bytes.NewBuffer([]byte{})
+		formats.SetTracer(iso0, formats.NewWriterTracer(out, formats.NoMask))
+
+		_, err := iso0.Encode("1234", account)
+		require.NoError(t, err)
+
+		expectedOutput := `PIN block encode operation finished
+************************************
+PAN     : 5432101234567891
+PIN     : 1234
+PAD     : FFFFFFFFFF
+Format  : Format 0 (ISO-0)
+------------------------------------
+Formatted PIN block  : 041215FEDCBA9876
+Formatted PAN block  : 0000210123456789
+
+`
+		require.Equal(t, expectedOutput, out.String())
+	})
+
+	t.Run("encrypted block is not masked", func(t *testing.T) {
+		cipher, err := encryption.NewAesECB([]byte("1234567890123456"))
+		require.NoError(t, err)
+
+		iso4 := formats.NewISO4(cipher)
+		out := bytes.NewBuffer([]byte{})
+		iso4.SetDebugWriter(out)
+
+		pinBlock, err := iso4.Encode("1234", account)
+		require.NoError(t, err)
+		require.Contains(t, out.String(), "Encrypted PIN block  : "+pinBlock)
+		require.NotContains(t, out.String(), account)
+	})
+
+	t.Run("slog", func(t *testing.T) {
+		out := bytes.NewBuffer([]byte{})
+		handler := slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+		iso0 := formats.NewISO0()
+		formats.SetTracer(iso0, formats.NewSlogTracer(handler, nil))
+
+		_, err := iso0.Encode("1234", account)
+		require.NoError(t, err)
+
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+		require.Equal(t, "DEBUG", record["level"])
+		require.Equal(t, "pin block encode", record["msg"])
+		require.Equal(t, "Format 0 (ISO-0)", record["format"])
+		require.Equal(t, "543210******7891", record["pan"])
+		require.Equal(t, "****", record["pin"])
+		require.Equal(t, "FFFFFFFFFF", record["pad"])
+		require.Equal(t, "****************", record["formatted_pin_block"])
+		require.Equal(t, "****************", record["formatted_pan_block"])
+	})
+
+	t.Run("slog level", func(t *testing.T) {
+		out := bytes.NewBuffer([]byte{})
+		handler := slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelInfo})
+
+		iso0 := formats.NewISO0()
+		formats.SetTracer(iso0, formats.NewSlogTracer(handler, nil))
+
+		_, err := iso0.Encode("1234", account)
+		require.NoError(t, err)
+		require.Empty(t, out.String())
+	})
+
+	t.Run("truncated pin note", func(t *testing.T) {
+		out := bytes.NewBuffer([]byte{})
+		iso1 := formats.NewISO1()
+		iso1.SetDebugWriter(out)
+
+		_, err := iso1.Encode("12345678901234", "")
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(out.String(), "PIN block encode operation finished\nThe pin is truncated on the right as 12 digits\n"))
+	})
+
+	t.Run("not traceable", func(t *testing.T) {
+		require.False(t, formats.SetTracer(&hexOnlyObject{}, formats.NewWriterTracer(&bytes.Buffer{}, nil)))
+	})
+}
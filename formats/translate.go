@@ -0,0 +1,53 @@
+package formats
+
+import (
+	"context"
+	"fmt"
+)
+
+// TranslatePIN decodes pinBlock with the from format and encodes the PIN again
+// with the to format. Keys are changed by passing encrypted formats, for
+// example an ISO-0 block under a TDES zone PIN key translated to ISO-4 under
+// an AES key:
+//
+//	from := formats.NewEncrypted(formats.NewISO0(), zpk)
+//	to := formats.NewISO4(aesKey)
+//	pinBlock, err := formats.TranslatePIN(encryptedBlock, account, from, to)
+//
+// The clear PIN is never returned to the caller, and the errors returned by
+// TranslatePIN do not contain it. The PIN and the clear PIN blocks are only
+// held in wiped buffers when the formats implement BlockFormat or
+// Block16Format, or wrap a BlockFormat.
+func TranslatePIN(pinBlock, account string, from, to Format) (string, error) {
+	return translate(context.Background(), from, to, pinBlock, account)
+}
+
+// translate decodes a PIN block with from and encodes the PIN with to, the
+// PIN is wiped
+func translate(ctx context.Context, from, to Format, pinBlock, account string) (string, error) {
+	if from == nil || to == nil {
+		return "", fmt.Errorf("from and to formats are required")
+	}
+
+	fromCall, err := withOptions(ctx, from, nil)
+	if err != nil {
+		return "", err
+	}
+
+	toCall, err := withOptions(ctx, to, nil)
+	if err != nil {
+		return "", err
+	}
+
+	pin, err := DecodePIN(fromCall, pinBlock, account)
+	if err != nil {
+		return "", fmt.Errorf("decoding pin block: %w", err)
+	}
+
+	translatedBlock, err := EncodePIN(toCall, pin, account)
+	if err != nil {
+		return "", fmt.Errorf("encoding pin block: %w", err)
+	}
+
+	return translatedBlock, nil
+}
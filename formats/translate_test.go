@@ -0,0 +1,70 @@
+package formats_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslatePIN(t *testing.T) {
+	account := "5432101234567891"
+
+	zpkKey, err := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	require.NoError(t, err)
+
+	zpk, err := encryption.NewTdesECB(zpkKey)
+	require.NoError(t, err)
+
+	aesKey, err := encryption.NewAesECB([]byte("1234567890123456"))
+	require.NoError(t, err)
+
+	t.Run("ISO-0 under TDES to ISO-4 under AES", func(t *testing.T) {
+		from := formats.NewEncrypted(formats.NewISO0(), zpk)
+		to := formats.NewISO4(aesKey)
+
+		pinBlock, err := formats.TranslatePIN("BA2ADC4EBA48F711", account, from, to)
+		require.NoError(t, err)
+		require.Len(t, pinBlock, 32)
+
+		pin, err := to.Decode(pinBlock, account)
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("ISO-4 under AES to ISO-0 under TDES", func(t *testing.T) {
+		from := formats.NewISO4(aesKey)
+		to := formats.NewEncrypted(formats.NewISO0(), zpk)
+
+		iso4Block, err := from.Encode("1234", account)
+		require.NoError(t, err)
+
+		pinBlock, err := formats.TranslatePIN(iso4Block, account, from, to)
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", pinBlock)
+	})
+
+	t.Run("clear ISO-0 to clear ISO-2", func(t *testing.T) {
+		pinBlock, err := formats.TranslatePIN("041215FEDCBA9876", account, formats.NewISO0(), formats.NewISO2())
+		require.NoError(t, err)
+		require.Equal(t, "241234FFFFFFFFFF", pinBlock)
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		_, err := formats.TranslatePIN("141215FEDCBA9876", account, formats.NewISO0(), formats.NewISO2())
+		require.EqualError(t, err, "decoding pin block: format is different")
+	})
+
+	t.Run("encode error", func(t *testing.T) {
+		// ISO-2 does not use the account, but ISO-0 requires at least 13 digits
+		_, err := formats.TranslatePIN("241234FFFFFFFFFF", "123", formats.NewISO2(), formats.NewISO0())
+		require.EqualError(t, err, "encoding pin block: account length must be at least 13 digits")
+	})
+
+	t.Run("missing format", func(t *testing.T) {
+		_, err := formats.TranslatePIN("041215FEDCBA9876", account, nil, formats.NewISO2())
+		require.EqualError(t, err, "from and to formats are required")
+	})
+}
@@ -0,0 +1,189 @@
+package formats
+
+import "fmt"
+
+// Validation configures the checks of the PIN and the account made by the
+// formats when they encode and decode PIN blocks. The zero value makes no
+// check beyond those of the formats themselves: encoders reject PINs that are
+// not decimal and truncate long PINs in ISO-1, ECI, OEM-1 and VISA-3, decoders
+// check the PIN digits, the fill and the reserved nibbles of the PIN blocks.
+// HexPIN is the only option of the PIN digits on encode, NumericPIN and
+// LenientDecode only apply to decoding.
+//
+//	iso1 := formats.NewISO1()
+//	formats.SetValidation(iso1, formats.StrictValidation)
+type Validation struct {
+	// HexPIN lets the encoders accept PINs of hex digits, that are only
+	// decoded when decoding is lenient
+	HexPIN bool
+
+	// NumericPIN rejects decoded PINs with characters that are not decimal
+	// digits, even when decoding is lenient
+	NumericPIN bool
+
+	// PANLength rejects accounts that are not 12 to 19 decimal digits
+	PANLength bool
+
+	// LuhnPAN rejects accounts with an invalid check digit
+	LuhnPAN bool
+
+	// RejectLongPIN rejects PINs that are longer than the format supports
+	// instead of truncating them on the right
+	RejectLongPIN bool
+
+	// LenientDecode accepts decoded PIN blocks with PIN digits that are not
+	// decimal, an invalid fill or an invalid reserved nibble. These checks
+	// detect most PIN blocks decrypted with the wrong key.
+	LenientDecode bool
+}
+
+// StrictValidation turns every check on, decoding is not lenient
+var StrictValidation = Validation{
+	NumericPIN:    true,
+	PANLength:     true,
+	LuhnPAN:       true,
+	RejectLongPIN: true,
+}
+
+// Validatable is a Format with configurable input validation. All the formats
+// of this package implement Validatable.
+type Validatable interface {
+	Format
+
+	// SetValidation sets the checks of the PIN and the account
+	SetValidation(validation Validation)
+}
+
+var (
+	_ Validatable = (*iso0Object)(nil)
+	_ Validatable = (*iso1Object)(nil)
+	_ Validatable = (*iso4Object)(nil)
+	_ Validatable = (*eciObject)(nil)
+	_ Validatable = (*oemObject)(nil)
+	_ Validatable = (*visa3Object)(nil)
+	_ Validatable = (*encryptedObject)(nil)
+)
+
+// SetValidation sets the checks of format. It returns false when the format
+// does not implement Validatable.
+func SetValidation(format Format, validation Validation) bool {
+	f, ok := format.(Validatable)
+	if ok {
+		f.SetValidation(validation)
+	}
+	return ok
+}
+
+// checkPIN checks the PIN to encode of a format that supports PINs of up to
+// maxLength digits. PINs that are not decimal are rejected unless HexPIN is
+// set.
+func (v Validation) checkPIN(format string, pin []byte, maxLength int) error {
+	if !v.HexPIN && !isDecimal(pin) {
+		return newError(format, FieldNamePIN, ErrInvalidPIN, "pin must be numeric")
+	}
+
+	return v.checkPINLength(format, pin, maxLength)
+}
+
+// checkDecodedPIN checks a decoded PIN of a format that supports PINs of up to
+// maxLength digits. PINs that are not decimal are rejected unless decoding is
+// lenient and NumericPIN is not set.
+func (v Validation) checkDecodedPIN(format string, pin []byte, maxLength int) error {
+	if (v.NumericPIN || !v.LenientDecode) && !isDecimal(pin) {
+		return newError(format, FieldNamePIN, ErrInvalidPIN, "pin must be numeric")
+	}
+
+	return v.checkPINLength(format, pin, maxLength)
+}
+
+// checkPINLength rejects PINs longer than maxLength when RejectLongPIN is set
+func (v Validation) checkPINLength(format string, pin []byte, maxLength int) error {
+	if v.RejectLongPIN && len(pin) > maxLength {
+		return newError(format, FieldNamePIN, ErrInvalidPINLength, fmt.Sprintf("pin length must be at most %d digits", maxLength))
+	}
+
+	return nil
+}
+
+// checkAccount checks the account of a format. The account of the formats
+// that do not use it (required is false) is only checked when it is given.
+func (v Validation) checkAccount(format, account string, required bool) error {
+	if account == "" && !required {
+		return nil
+	}
+
+	if v.PANLength && (len(account) < 12 || len(account) > 19 || !isDecimal(account)) {
+		return newError(format, FieldNameAccount, ErrInvalidAccount, "account must be 12 to 19 digits")
+	}
+
+	if v.LuhnPAN && !luhn(account) {
+		return newError(format, FieldNameAccount, ErrInvalidAccount, "account check digit is invalid")
+	}
+
+	return nil
+}
+
+// checkDecoded returns an error for a decoded PIN block that is not valid,
+// unless decoding is lenient
+func (v Validation) checkDecoded(format string, valid bool, reason string) error {
+	if valid || v.LenientDecode {
+		return nil
+	}
+	return newError(format, FieldNamePINBlock, ErrInvalidPINBlock, reason)
+}
+
+// isHex reports whether the characters of s are hex digits
+func isHex[T string | []byte](s T) bool {
+	return checkHex(s) == nil
+}
+
+// isHexLetters reports whether the characters of s are A to F, in any case
+func isHexLetters[T string | []byte](s T) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'f' {
+			return false
+		}
+	}
+	return true
+}
+
+// isFill reports whether the characters of s are all filler, in any case
+func isFill[T string | []byte](s T, filler byte) bool {
+	for i := 0; i < len(s); i++ {
+		if upper(s[i]) != upper(filler) {
+			return false
+		}
+	}
+	return true
+}
+
+// upper returns the upper case of the ASCII letter c
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// luhn reports whether the last digit of account is its Luhn check digit
+func luhn(account string) bool {
+	if len(account) < 2 || !isDecimal(account) {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(account) - 1; i >= 0; i-- {
+		digit := int(account[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
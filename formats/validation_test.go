@@ -0,0 +1,230 @@
+package formats_test
+
+import (
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidation(t *testing.T) {
+	// 4111111111111111 has a valid check digit, 5432101234567891 does not
+	account := "4111111111111111"
+
+	cipher, err := encryption.NewAesECB([]byte("1234567890123456"))
+	require.NoError(t, err)
+
+	newFormats := map[string]func() formats.Format{
+		"ISO-0": formats.NewISO0,
+		"ISO-1": formats.NewISO1,
+		"ISO-3": formats.NewISO3,
+		"ISO-4": func() formats.Format { return formats.NewISO4(cipher) },
+		"OEM-1": formats.NewOEM1,
+		"ECI2":  formats.NewECI2,
+		"ECI3":  formats.NewECI3,
+		"VISA2": formats.NewVISA2,
+		"VISA3": formats.NewVISA3,
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		for name, newFormat := range newFormats {
+			format := newFormat()
+
+			pinBlock, err := format.Encode("1234", account)
+			require.NoError(t, err, name)
+
+			pin, err := format.Decode(pinBlock, account)
+			require.NoError(t, err, name)
+			require.Equal(t, "1234", pin, name)
+
+			// the PIN blocks of hex PINs would not be decoded
+			_, err = format.Encode("abcd", account)
+			require.ErrorIs(t, err, formats.ErrInvalidPIN, name)
+			require.EqualError(t, err, "pin must be numeric", name)
+
+			// decoding options do not change the encoders
+			formats.SetValidation(format, formats.Validation{LenientDecode: true})
+			_, err = format.Encode("abcd", account)
+			require.ErrorIs(t, err, formats.ErrInvalidPIN, name)
+
+			formats.SetValidation(format, formats.Validation{HexPIN: true, LenientDecode: true})
+			pinBlock, err = format.Encode("12a4", account)
+			require.NoError(t, err, name)
+
+			pin, err = format.Decode(pinBlock, account)
+			require.NoError(t, err, name)
+			require.Equal(t, "12A4", pin, name)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		for name, newFormat := range newFormats {
+			format := newFormat()
+			require.True(t, formats.SetValidation(format, formats.StrictValidation))
+
+			pinBlock, err := format.Encode("1234", account)
+			require.NoError(t, err, name)
+
+			pin, err := format.Decode(pinBlock, account)
+			require.NoError(t, err, name)
+			require.Equal(t, "1234", pin, name)
+
+			_, err = format.Encode("12a4", account)
+			require.ErrorIs(t, err, formats.ErrInvalidPIN, name)
+			require.EqualError(t, err, "pin must be numeric", name)
+
+			_, err = format.Encode("1234", "5432101234567891")
+			require.ErrorIs(t, err, formats.ErrInvalidAccount, name)
+			require.EqualError(t, err, "account check digit is invalid", name)
+
+			_, err = format.Encode("1234", "41111111111")
+			require.ErrorIs(t, err, formats.ErrInvalidAccount, name)
+			require.EqualError(t, err, "account must be 12 to 19 digits", name)
+		}
+	})
+
+	t.Run("long pin", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			pin     string
+			maximum string
+		}{
+			{"ISO-1", "1234567890123", "12"},
+			{"OEM-1", "1234567890123", "12"},
+			{"VISA3", "1234567890123", "12"},
+			{"ECI2", "12345", "4"},
+			{"ECI3", "1234567", "6"},
+		}
+
+		for _, tt := range tests {
+			format := newFormats[tt.name]()
+
+			// truncated by default
+			_, err := format.Encode(tt.pin, "")
+			require.NoError(t, err, tt.name)
+
+			formats.SetValidation(format, formats.Validation{RejectLongPIN: true})
+			_, err = format.Encode(tt.pin, "")
+			require.ErrorIs(t, err, formats.ErrInvalidPINLength, tt.name)
+			require.EqualError(t, err, "pin length must be at most "+tt.maximum+" digits", tt.name)
+		}
+	})
+
+	t.Run("account of formats without account", func(t *testing.T) {
+		iso1 := formats.NewISO1()
+		formats.SetValidation(iso1, formats.StrictValidation)
+
+		// the account is not used by ISO-1, it is only checked when given
+		_, err := iso1.Encode("1234", "")
+		require.NoError(t, err)
+
+		_, err = iso1.Encode("1234", "5432101234567891")
+		require.ErrorIs(t, err, formats.ErrInvalidAccount)
+	})
+
+	t.Run("decode", func(t *testing.T) {
+		iso1 := formats.NewISO1()
+		formats.SetValidation(iso1, formats.Validation{LenientDecode: true})
+
+		pin, err := iso1.Decode("1412A4FFFFFFFFFF", "")
+		require.NoError(t, err)
+		require.Equal(t, "12A4", pin)
+
+		formats.SetValidation(iso1, formats.Validation{NumericPIN: true, LenientDecode: true})
+		_, err = iso1.Decode("1412A4FFFFFFFFFF", "")
+		require.ErrorIs(t, err, formats.ErrInvalidPIN)
+
+		// NumericPIN only applies to decoding
+		formats.SetValidation(iso1, formats.Validation{HexPIN: true, NumericPIN: true})
+		_, err = iso1.Encode("12A4", "")
+		require.NoError(t, err)
+	})
+
+	t.Run("registry", func(t *testing.T) {
+		key := []byte("0123456789ABCDEF01234567")
+		tdes, err := encryption.NewTdesECB(key)
+		require.NoError(t, err)
+
+		for _, opts := range [][]formats.Option{
+			{formats.WithValidation(formats.StrictValidation)},
+			{formats.WithValidation(formats.StrictValidation), formats.WithCipher(tdes)},
+		} {
+			iso0, err := formats.NewFormatter("ISO-0", opts...)
+			require.NoError(t, err)
+
+			_, err = iso0.Encode("1234", "5432101234567891")
+			require.ErrorIs(t, err, formats.ErrInvalidAccount)
+		}
+
+		iso4, err := formats.NewFormatter("ISO-4", formats.WithValidation(formats.StrictValidation))
+		require.NoError(t, err)
+
+		_, err = iso4.Encode("12345", "5432101234567891")
+		require.ErrorIs(t, err, formats.ErrInvalidAccount)
+	})
+}
+
+func TestDecodeChecks(t *testing.T) {
+	account := "5432101234567891"
+
+	tests := []struct {
+		name     string
+		format   formats.Format
+		pinBlock string
+		reason   string
+		lenient  string
+		target   error
+	}{
+		// PIN field 041234FFFFFFFFFE
+		{"ISO-0 fill", formats.NewISO0(), "041215FEDCBA9877", "invalid fill", "1234", formats.ErrInvalidPINBlock},
+		// PIN field 0412A4FFFFFFFFFF
+		{"ISO-0 pin digits", formats.NewISO0(), "041285FEDCBA9876", "pin digits must be decimal", "12A4", formats.ErrInvalidPINBlock},
+		// PIN field 3412349999999999
+		{"ISO-3 fill", formats.NewISO3(), "34121598BADCFE10", "invalid fill", "1234", formats.ErrInvalidPINBlock},
+		{"ISO-1 pin length", formats.NewISO1(), "1312399999999999", "invalid pin length 3", "123", formats.ErrInvalidPINBlock},
+		{"ISO-2 fill", formats.NewISO2(), "241234FFFFFFFFFE", "invalid fill", "1234", formats.ErrInvalidPINBlock},
+		{"ECI3 zeros", formats.NewECI3(), "4123412345678901", "invalid fill", "1234", formats.ErrInvalidPINBlock},
+		{"VISA2 pin digits", formats.NewVISA2(), "412B400123456789", "pin digits must be decimal", "12B4", formats.ErrInvalidPINBlock},
+		{"OEM-1 pin length", formats.NewOEM1(), "1234555555555554", "invalid pin length 14", "12345555555555", formats.ErrInvalidPINBlock},
+		{"OEM-1 fill", formats.NewOEM1(), "1234GGGGGGGGGGGG", "invalid fill", "1234", formats.ErrInvalidPINBlock},
+		{"VISA3 fill", formats.NewVISA3(), "1234FABABABABABA", "invalid fill", "1234", formats.ErrInvalidPINBlock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.format.Decode(tt.pinBlock, account)
+			require.ErrorIs(t, err, tt.target)
+			require.EqualError(t, err, tt.reason)
+
+			formats.SetValidation(tt.format, formats.Validation{LenientDecode: true})
+			pin, err := tt.format.Decode(tt.pinBlock, account)
+			require.NoError(t, err)
+			require.Equal(t, tt.lenient, pin)
+		})
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		wrongKey, err := encryption.NewTdesECB([]byte("0123456789ABCDEF01234567"))
+		require.NoError(t, err)
+
+		// BA2ADC4EBA48F711 is encrypted with 0123456789ABCDEFFEDCBA9876543210
+		iso0 := formats.NewEncrypted(formats.NewISO0(), wrongKey)
+		_, err = iso0.Decode("BA2ADC4EBA48F711", account)
+		require.Error(t, err)
+
+		key, err := encryption.NewAesECB([]byte("1234567890123456"))
+		require.NoError(t, err)
+
+		wrongAESKey, err := encryption.NewAesECB([]byte("6543210987654321"))
+		require.NoError(t, err)
+
+		for i := 0; i < 100; i++ {
+			pinBlock, err := formats.NewISO4(key).Encode("1234", account)
+			require.NoError(t, err)
+
+			_, err = formats.NewISO4(wrongAESKey).Decode(pinBlock, account)
+			require.Error(t, err)
+		}
+	})
+}
@@ -1,23 +1,21 @@
 package formats
 
 import (
-	"fmt"
 	"io"
 	"strings"
-	"text/tabwriter"
 )
 
 type visa3Object struct {
-	format      string
-	debugWriter io.Writer
+	format string
+	settings
 }
 
 const delimiter = "F"
 
 // Padding returns padding pattern
-func (i *visa3Object) padding(pin string) (string, error) {
-	if len(pin) < 4 || len(pin) > 12 {
-		return "", fmt.Errorf("pin length must be between 4 and 12 digits")
+func (i *visa3Object) padding(pinLength int) (string, error) {
+	if pinLength < 4 || pinLength > 12 {
+		return "", newError(i.format, FieldNamePIN, ErrInvalidPINLength, "pin length must be between 4 and 12 digits")
 	}
 
 	filler, err := randomLetters(1, hexCharacters)
@@ -25,16 +23,52 @@ func (i *visa3Object) padding(pin string) (string, error) {
 		return "", err
 	}
 
-	return delimiter + strings.Repeat(filler, 16-len(pin)-1), nil
+	return delimiter + strings.Repeat(filler, 16-pinLength-1), nil
 }
 
-// SetDebugWriter will set writer for getting output message of encoding and decoding logic
+// SetDebugWriter will set writer for getting output message of encoding and decoding logic,
+// the PAN and the PIN are masked
 func (i *visa3Object) SetDebugWriter(writer io.Writer) {
-	i.debugWriter = tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	i.setTracer(NewWriterTracer(writer, DefaultMask))
+}
+
+// SetTracer sets the tracer of the encode and decode operations
+func (i *visa3Object) SetTracer(tracer Tracer) {
+	i.setTracer(tracer)
+}
+
+// SetValidation sets the checks of the PIN and the account
+func (i *visa3Object) SetValidation(validation Validation) {
+	i.setValidation(validation)
+}
+
+// copy returns a copy of the format with the same settings
+func (i *visa3Object) copy() copyable {
+	return copySettings(&visa3Object{format: i.format}, i)
 }
 
 // Encode returns the OEM-1 PIN block for the given PIN
 func (i *visa3Object) Encode(pin, account string) (string, error) {
+	return encodeString(i.encode, pin, account)
+}
+
+// EncodePIN returns the VISA-3 PIN block for the given PIN, the PIN is wiped
+func (i *visa3Object) EncodePIN(pin *PIN, account string) (string, error) {
+	defer pin.Wipe()
+	return i.encode(pin.Bytes(), account)
+}
+
+func (i *visa3Object) encode(pin []byte, account string) (string, error) {
+	validation := i.validation()
+
+	if err := validation.checkPIN(i.format, pin, 12); err != nil {
+		return "", err
+	}
+
+	if err := validation.checkAccount(i.format, account, false); err != nil {
+		return "", err
+	}
+
 	isTruncated := false
 
 	// A PIN that is longer than 12 digits is truncated on the right.
@@ -43,62 +77,114 @@ func (i *visa3Object) Encode(pin, account string) (string, error) {
 		isTruncated = true
 	}
 
-	pad, err := i.padding(pin)
+	pad, err := i.padding(len(pin))
 	if err != nil {
 		return "", err
 	}
 
 	// Pad value has a 4-bit value from X’0′ to X’F’ and must be different from any PIN digit.
 	// The number of pad values for this format is in the range from 4 to 12, and all the pad values must have the same value.
-	pinBlock := fmt.Sprintf("%s%s", pin, pad)
+	pinBlock := make([]byte, 16)
+	defer wipe(pinBlock)
+
+	copy(pinBlock, pin)
+	copy(pinBlock[len(pin):], pad)
+	toUpper(pinBlock)
 
-	// write encode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block encode operation finished\n")
+	// trace encode information
+	if tracer := i.tracer(); tracer != nil {
+		var notes []string
 		if isTruncated {
-			fmt.Fprintf(tw, "The pin is truncated on the right as 12 digits\n")
+			notes = append(notes, "The pin is truncated on the right as 12 digits")
 		}
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "PIN\t: %s\n", pin)
-		if pad == "" {
-			fmt.Fprintf(tw, "PAD\t: N/A\n")
-		} else {
-			fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		}
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(pinBlock))
-		tw.Write([]byte("\n"))
+		tracer.Trace(TraceEvent{
+			Step:   StepEncode,
+			Format: i.format,
+			Notes:  notes,
+			Fields: []TraceField{
+				{Name: "PIN", Kind: FieldPIN, Value: string(pin)},
+				{Name: "PAD", Kind: FieldText, Value: pad},
+			},
+			Results: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: string(pinBlock)},
+			},
+		})
 	}
 
-	return strings.ToUpper(pinBlock), nil
+	return string(pinBlock), nil
 }
 
 func (i *visa3Object) Decode(pinBlock, account string) (string, error) {
+	return decodeString(i.decode, pinBlock, account)
+}
+
+// DecodePIN returns the PIN of a VISA-3 PIN block
+func (i *visa3Object) DecodePIN(pinBlock, account string) (*PIN, error) {
+	pin, err := i.decode(pinBlock, account)
+	if err != nil {
+		return nil, err
+	}
+	return NewPIN(pin), nil
+}
+
+func (i *visa3Object) decode(pinBlock, account string) ([]byte, error) {
+	validation := i.validation()
+
 	if len(pinBlock) != 16 {
-		return "", fmt.Errorf("pin block must be 16 characters")
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlockLength, "pin block must be 16 characters")
+	}
+
+	if err := validation.checkAccount(i.format, account, false); err != nil {
+		return nil, err
 	}
 
 	index := strings.Index(pinBlock, delimiter)
 	if index < 4 || index > 12 {
-		return "", fmt.Errorf("unable to parse pin block")
+		return nil, newError(i.format, FieldNamePINBlock, ErrInvalidPINBlock, "unable to parse pin block")
+	}
+
+	if err := validation.checkDecoded(i.format, isDecimal(pinBlock[:index]), "pin digits must be decimal"); err != nil {
+		return nil, err
 	}
 
-	pin := pinBlock[:index]
-	// write decode information
-	if i.debugWriter != nil {
-		tw := i.debugWriter
-		fmt.Fprintf(tw, "PIN block decode operation finished\n")
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("*", 36))
-		fmt.Fprintf(tw, "Formatted PIN block\t: %s\n", strings.ToUpper(pinBlock))
+	// the delimiter is followed by a single pad value repeated
+	fill := pinBlock[index+1:]
+	if err := validation.checkDecoded(i.format, isHex(fill) && isFill(fill, fill[0]), "invalid fill"); err != nil {
+		return nil, err
+	}
+
+	pin := []byte(pinBlock[:index])
+
+	if err := validation.checkDecodedPIN(i.format, pin, 12); err != nil {
+		wipe(pin)
+		return nil, err
+	}
+
+	// trace decode information
+	if tracer := i.tracer(); tracer != nil {
 		pad := pinBlock[index+1:]
-		fmt.Fprintf(tw, "PAD\t: %s\n", pad)
-		fmt.Fprintf(tw, "Format\t: %s\n", i.format)
-		fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 36))
-		fmt.Fprintf(tw, "Decoded PIN\t: %s\n", pin)
-		tw.Write([]byte("\n"))
+		tracer.Trace(TraceEvent{
+			Step:   StepDecode,
+			Format: i.format,
+			Fields: []TraceField{
+				{Name: "Formatted PIN block", Kind: FieldClearBlock, Value: strings.ToUpper(pinBlock)},
+				{Name: "PAD", Kind: FieldText, Value: pad},
+			},
+			Results: []TraceField{
+				{Name: "Decoded PIN", Kind: FieldPIN, Value: string(pin)},
+			},
+		})
 	}
 
 	return pin, nil
 }
+
+// EncodeBytes returns the 8 byte PIN block for the given PIN and account number
+func (i *visa3Object) EncodeBytes(pin, account string) ([]byte, error) {
+	return encodeHexBytes(i, pin, account)
+}
+
+// DecodeBytes returns the PIN from an 8 byte PIN block
+func (i *visa3Object) DecodeBytes(pinBlock []byte, account string) (string, error) {
+	return decodeHexBytes(i, pinBlock, account)
+}
@@ -52,7 +52,7 @@ func TestVISA3(t *testing.T) {
 
 		expectedOutput := `PIN block encode operation finished
 ************************************
-PIN     : 1234
+PIN     : ****
 PAD     : `
 		require.Contains(t, out.String(), expectedOutput)
 	})
@@ -69,11 +69,11 @@ PAD     : `
 
 		expectedOutput := `PIN block decode operation finished
 ************************************
-Formatted PIN block  : 123456789012FAAA
+Formatted PIN block  : ****************
 PAD                  : AAA
 Format               : VISA-3
 ------------------------------------
-Decoded PIN  : 123456789012
+Decoded PIN  : ****
 
 `
 		require.Equal(t, expectedOutput, out.String())
@@ -2,7 +2,10 @@ module github.com/moov-io/pinblock
 
 go 1.22.2
 
-require github.com/stretchr/testify v1.12.1
+require (
+	github.com/miekg/pkcs11 v1.1.2
+	github.com/stretchr/testify v1.12.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -0,0 +1,73 @@
+// Package cmac implements the CMAC message authentication code of
+// NIST SP 800-38B for 64 bit (TDES) and 128 bit (AES) block ciphers.
+package cmac
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+)
+
+// Sum returns the CMAC of message computed with block. The result has the
+// block size of the cipher.
+func Sum(block cipher.Block, message []byte) []byte {
+	size := block.BlockSize()
+
+	k1, k2 := subkeys(block)
+
+	// number of blocks, the last one is complete or padded
+	n := (len(message) + size - 1) / size
+	complete := n > 0 && len(message)%size == 0
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, size)
+	copy(last, message[(n-1)*size:])
+	if complete {
+		subtle.XORBytes(last, last, k1)
+	} else {
+		last[len(message)-(n-1)*size] = 0x80
+		subtle.XORBytes(last, last, k2)
+	}
+
+	mac := make([]byte, size)
+	for i := 0; i < n-1; i++ {
+		subtle.XORBytes(mac, mac, message[i*size:(i+1)*size])
+		block.Encrypt(mac, mac)
+	}
+
+	subtle.XORBytes(mac, mac, last)
+	block.Encrypt(mac, mac)
+
+	return mac
+}
+
+func subkeys(block cipher.Block) ([]byte, []byte) {
+	l := make([]byte, block.BlockSize())
+	block.Encrypt(l, l)
+
+	k1 := shift(l)
+	k2 := shift(k1)
+
+	return k1, k2
+}
+
+// shift returns the value shifted left by one bit, XOR-ed with the constant
+// of the block size when the most significant bit was set
+func shift(value []byte) []byte {
+	shifted := make([]byte, len(value))
+	for i := 0; i < len(value)-1; i++ {
+		shifted[i] = value[i]<<1 | value[i+1]>>7
+	}
+	shifted[len(value)-1] = value[len(value)-1] << 1
+
+	if value[0]&0x80 != 0 {
+		if len(value) == 8 {
+			shifted[len(value)-1] ^= 0x1B
+		} else {
+			shifted[len(value)-1] ^= 0x87
+		}
+	}
+
+	return shifted
+}
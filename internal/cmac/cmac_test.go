@@ -0,0 +1,40 @@
+package cmac
+
+import (
+	"crypto/aes"
+	"crypto/des"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSum(t *testing.T) {
+	t.Run("AES", func(t *testing.T) {
+		// RFC 4493 test vectors
+		key, err := hex.DecodeString("2B7E151628AED2A6ABF7158809CF4F3C")
+		require.NoError(t, err)
+
+		block, err := aes.NewCipher(key)
+		require.NoError(t, err)
+
+		message, err := hex.DecodeString("6BC1BEE22E409F96E93D7E117393172AAE2D8A571E03AC9C9EB76FAC45AF8E5130C81C46A35CE411")
+		require.NoError(t, err)
+
+		require.Equal(t, "BB1D6929E95937287FA37D129B756746", fmt.Sprintf("%X", Sum(block, nil)))
+		require.Equal(t, "070A16B46B4D4144F79BDD9DD04A287C", fmt.Sprintf("%X", Sum(block, message[:16])))
+		require.Equal(t, "DFA66747DE9AE63030CA32611497C827", fmt.Sprintf("%X", Sum(block, message[:40])))
+	})
+
+	t.Run("TDES", func(t *testing.T) {
+		key, err := hex.DecodeString("0123456789ABCDEFFEDCBA98765432100123456789ABCDEF")
+		require.NoError(t, err)
+
+		block, err := des.NewTripleDESCipher(key)
+		require.NoError(t, err)
+
+		require.Equal(t, "945D2EBA1B409868", fmt.Sprintf("%X", Sum(block, []byte("abc"))))
+		require.Equal(t, "9213CF2F8DCBDE4D", fmt.Sprintf("%X", Sum(block, []byte("0123456789ABCDEF"))))
+	})
+}
@@ -0,0 +1,249 @@
+package keyblock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Key block versions
+const (
+	// VersionB uses TDES key derivation binding
+	VersionB byte = 'B'
+	// VersionD uses AES key derivation binding
+	VersionD byte = 'D'
+)
+
+// Key usages
+const (
+	UsageBDK           = "B0"
+	UsageKeyEncryption = "K0"
+	UsagePINEncryption = "P0"
+
+	UsagePINVerificationKPV     = "V0"
+	UsagePINVerificationIBM3624 = "V1"
+	UsagePINVerificationVisaPVV = "V2"
+)
+
+// Algorithms of the wrapped key
+const (
+	AlgorithmAES  byte = 'A'
+	AlgorithmTDES byte = 'T'
+)
+
+// Modes of use of the wrapped key
+const (
+	ModeEncryptDecrypt byte = 'B'
+	ModeDecrypt        byte = 'D'
+	ModeEncrypt        byte = 'E'
+	ModeNone           byte = 'N'
+	ModeDerive         byte = 'X'
+)
+
+// Exportability of the wrapped key
+const (
+	ExportableTrusted byte = 'E'
+	NonExportable     byte = 'N'
+	ExportableKEK     byte = 'S'
+)
+
+const (
+	headerLength        = 16
+	optionalBlockHeader = 4
+	paddingBlockID      = "PB"
+)
+
+// Header is the clear part of a key block. It is authenticated by the MAC of
+// the key block.
+type Header struct {
+	Version        byte
+	KeyUsage       string
+	Algorithm      byte
+	ModeOfUse      byte
+	KeyVersion     string
+	Exportability  byte
+	OptionalBlocks []OptionalBlock
+}
+
+// OptionalBlock holds additional information about the wrapped key, such as
+// the key set identifier (KS) of a BDK.
+type OptionalBlock struct {
+	ID   string
+	Data string
+}
+
+// ParseHeader returns the header of keyBlock. The key itself is not
+// unwrapped and the MAC is not verified.
+func ParseHeader(keyBlock string) (*Header, error) {
+	header, _, err := parseHeader(keyBlock)
+	return header, err
+}
+
+// parseHeader returns the header and its length, including optional blocks
+func parseHeader(keyBlock string) (*Header, int, error) {
+	if len(keyBlock) < headerLength {
+		return nil, 0, fmt.Errorf("key block must be at least %d characters", headerLength)
+	}
+
+	blockLength, err := strconv.Atoi(keyBlock[1:5])
+	if err != nil {
+		return nil, 0, fmt.Errorf("parsing key block length: %w", err)
+	}
+
+	if blockLength != len(keyBlock) {
+		return nil, 0, fmt.Errorf("key block length %d does not match actual length %d", blockLength, len(keyBlock))
+	}
+
+	header := &Header{
+		Version:       keyBlock[0],
+		KeyUsage:      keyBlock[5:7],
+		Algorithm:     keyBlock[7],
+		ModeOfUse:     keyBlock[8],
+		KeyVersion:    keyBlock[9:11],
+		Exportability: keyBlock[11],
+	}
+
+	if err := header.validate(); err != nil {
+		return nil, 0, err
+	}
+
+	count, err := strconv.Atoi(keyBlock[12:14])
+	if err != nil {
+		return nil, 0, fmt.Errorf("parsing number of optional blocks: %w", err)
+	}
+
+	offset := headerLength
+	for i := 0; i < count; i++ {
+		block, length, err := parseOptionalBlock(keyBlock[offset:])
+		if err != nil {
+			return nil, 0, fmt.Errorf("parsing optional block %d: %w", i+1, err)
+		}
+
+		if block.ID != paddingBlockID {
+			header.OptionalBlocks = append(header.OptionalBlocks, block)
+		}
+
+		offset += length
+	}
+
+	return header, offset, nil
+}
+
+func parseOptionalBlock(data string) (OptionalBlock, int, error) {
+	if len(data) < optionalBlockHeader {
+		return OptionalBlock{}, 0, fmt.Errorf("optional block is too short")
+	}
+
+	id := data[:2]
+
+	length, err := strconv.ParseUint(data[2:4], 16, 16)
+	if err != nil {
+		return OptionalBlock{}, 0, fmt.Errorf("parsing length: %w", err)
+	}
+
+	dataOffset := optionalBlockHeader
+
+	// a length of 00 is followed by the number of characters of the length
+	// and the length itself
+	if length == 0 {
+		if len(data) < 6 {
+			return OptionalBlock{}, 0, fmt.Errorf("optional block is too short")
+		}
+
+		size, err := strconv.ParseUint(data[4:6], 16, 8)
+		if err != nil || size == 0 || len(data) < 6+int(size) {
+			return OptionalBlock{}, 0, fmt.Errorf("invalid extended length")
+		}
+
+		length, err = strconv.ParseUint(data[6:6+size], 16, 32)
+		if err != nil {
+			return OptionalBlock{}, 0, fmt.Errorf("parsing extended length: %w", err)
+		}
+
+		dataOffset = 6 + int(size)
+	}
+
+	if int(length) < dataOffset || int(length) > len(data) {
+		return OptionalBlock{}, 0, fmt.Errorf("invalid length %d", length)
+	}
+
+	return OptionalBlock{
+		ID:   id,
+		Data: data[dataOffset:length],
+	}, int(length), nil
+}
+
+// encode returns the header with the optional blocks, padded to a multiple of
+// blockSize, followed by payloadLength characters of encrypted key and MAC
+func (h *Header) encode(blockSize, payloadLength int) (string, error) {
+	if err := h.validate(); err != nil {
+		return "", err
+	}
+
+	var optional strings.Builder
+	count := len(h.OptionalBlocks)
+	for _, block := range h.OptionalBlocks {
+		if len(block.ID) != 2 || block.ID == paddingBlockID {
+			return "", fmt.Errorf("invalid optional block ID %q", block.ID)
+		}
+
+		length := optionalBlockHeader + len(block.Data)
+		if length > 0xFF {
+			return "", fmt.Errorf("optional block %s is too long", block.ID)
+		}
+
+		fmt.Fprintf(&optional, "%s%02X%s", block.ID, length, block.Data)
+	}
+
+	// the header must be a multiple of the block size of the cipher
+	if rest := (headerLength + optional.Len()) % blockSize; rest != 0 {
+		length := blockSize - rest
+		if length < optionalBlockHeader {
+			length += blockSize
+		}
+
+		fmt.Fprintf(&optional, "%s%02X%s", paddingBlockID, length, strings.Repeat("0", length-optionalBlockHeader))
+		count++
+	}
+
+	if count > 99 {
+		return "", fmt.Errorf("too many optional blocks")
+	}
+
+	blockLength := headerLength + optional.Len() + payloadLength
+	if blockLength > 9999 {
+		return "", fmt.Errorf("key block is too long")
+	}
+
+	return fmt.Sprintf("%c%04d%s%c%c%s%c%02d00%s",
+		h.Version,
+		blockLength,
+		h.KeyUsage,
+		h.Algorithm,
+		h.ModeOfUse,
+		h.KeyVersion,
+		h.Exportability,
+		count,
+		optional.String(),
+	), nil
+}
+
+func (h *Header) validate() error {
+	if h.Version != VersionB && h.Version != VersionD {
+		return fmt.Errorf("unsupported key block version %q", h.Version)
+	}
+
+	if len(h.KeyUsage) != 2 {
+		return fmt.Errorf("key usage must be 2 characters")
+	}
+
+	if h.Algorithm != AlgorithmAES && h.Algorithm != AlgorithmTDES {
+		return fmt.Errorf("unsupported algorithm %q", h.Algorithm)
+	}
+
+	if len(h.KeyVersion) != 2 {
+		return fmt.Errorf("key version must be 2 characters")
+	}
+
+	return nil
+}
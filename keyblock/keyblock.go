@@ -0,0 +1,266 @@
+// Package keyblock implements ANSI X9.143 (TR-31) key blocks of versions B
+// and D, which are used to exchange PIN keys with processors.
+//
+//	keyBlock, err := keyblock.Unwrap(kbpk, "D0112P0AE00E0000...")
+//	cipher, err := keyBlock.Cipher()
+//	iso4 := formats.NewISO4(cipher)
+package keyblock
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/moov-io/pinblock/internal/cmac"
+)
+
+// KeyBlock is an unwrapped key with its header
+type KeyBlock struct {
+	Header Header
+	Key    []byte
+}
+
+// Wrap returns the key block of key, encrypted and authenticated with the key
+// block protection key (KBPK). Version B requires a TDES KBPK and version D an
+// AES KBPK.
+func Wrap(kbpk []byte, header Header, key []byte) (string, error) {
+	if len(key) == 0 || len(key) > 0xFFFF/8 {
+		return "", fmt.Errorf("invalid key length %d", len(key))
+	}
+
+	encryptionKey, macKey, err := deriveKeys(header.Version, kbpk)
+	if err != nil {
+		return "", err
+	}
+
+	blockSize := encryptionKey.BlockSize()
+
+	// key length in bits, key and random padding up to the block size
+	payload := make([]byte, 2+len(key), 2+len(key)+blockSize)
+	binary.BigEndian.PutUint16(payload, uint16(len(key)*8))
+	copy(payload[2:], key)
+
+	if rest := len(payload) % blockSize; rest != 0 {
+		padding := make([]byte, blockSize-rest)
+		if _, err := rand.Read(padding); err != nil {
+			return "", fmt.Errorf("generating padding: %w", err)
+		}
+		payload = append(payload, padding...)
+	}
+
+	macLength := macLength(header.Version)
+
+	clearHeader, err := header.encode(blockSize, 2*len(payload)+2*macLength)
+	if err != nil {
+		return "", err
+	}
+
+	mac := cmac.Sum(macKey, append([]byte(clearHeader), payload...))[:macLength]
+
+	encrypted := make([]byte, len(payload))
+	cipher.NewCBCEncrypter(encryptionKey, mac[:blockSize]).CryptBlocks(encrypted, payload)
+
+	return fmt.Sprintf("%s%X%X", clearHeader, encrypted, mac), nil
+}
+
+// Unwrap decrypts keyBlock with the key block protection key (KBPK) and
+// verifies its MAC.
+func Unwrap(kbpk []byte, keyBlock string) (*KeyBlock, error) {
+	header, length, err := parseHeader(keyBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionKey, macKey, err := deriveKeys(header.Version, kbpk)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize := encryptionKey.BlockSize()
+	macLength := macLength(header.Version)
+
+	if length%blockSize != 0 {
+		return nil, fmt.Errorf("header length must be a multiple of %d", blockSize)
+	}
+
+	body, err := hex.DecodeString(keyBlock[length:])
+	if err != nil {
+		return nil, fmt.Errorf("decoding key block: %w", err)
+	}
+
+	if len(body) < blockSize+macLength || (len(body)-macLength)%blockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted key length")
+	}
+
+	encrypted, mac := body[:len(body)-macLength], body[len(body)-macLength:]
+
+	payload := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(encryptionKey, mac[:blockSize]).CryptBlocks(payload, encrypted)
+
+	expectedMAC := cmac.Sum(macKey, append([]byte(keyBlock[:length]), payload...))[:macLength]
+	if subtle.ConstantTimeCompare(mac, expectedMAC) != 1 {
+		return nil, fmt.Errorf("key block MAC verification failed")
+	}
+
+	keyLength := int(binary.BigEndian.Uint16(payload))
+	if keyLength == 0 || keyLength%8 != 0 || keyLength/8 > len(payload)-2 {
+		return nil, fmt.Errorf("invalid key length %d bits", keyLength)
+	}
+
+	return &KeyBlock{
+		Header: *header,
+		Key:    payload[2 : 2+keyLength/8],
+	}, nil
+}
+
+// Cipher returns a PIN block cipher for a PIN encryption key (P0). The mode
+// of use of the key block is enforced: a key for encryption only (E) can not
+// decrypt and a key for decryption only (D) can not encrypt.
+func (k *KeyBlock) Cipher() (formats.Cipher, error) {
+	if k.Header.KeyUsage != UsagePINEncryption {
+		return nil, fmt.Errorf("key usage %s is not PIN encryption", k.Header.KeyUsage)
+	}
+
+	var (
+		c   checkedCipher
+		err error
+	)
+
+	switch k.Header.Algorithm {
+	case AlgorithmTDES:
+		c, err = encryption.NewTdesECB(k.Key)
+	case AlgorithmAES:
+		c, err = encryption.NewAesECB(k.Key)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", k.Header.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k.Header.ModeOfUse {
+	case ModeEncryptDecrypt:
+		return c, nil
+	case ModeEncrypt, ModeDecrypt:
+		return &modeCipher{cipher: c, mode: k.Header.ModeOfUse}, nil
+	default:
+		return nil, fmt.Errorf("mode of use %q does not allow PIN encryption", k.Header.ModeOfUse)
+	}
+}
+
+// checkedCipher is a cipher of the encryption package, which returns the
+// check value of its key
+type checkedCipher interface {
+	formats.Cipher
+	KCV(method encryption.KCVMethod) string
+}
+
+// modeCipher restricts a cipher to encryption or decryption
+type modeCipher struct {
+	cipher checkedCipher
+	mode   byte
+}
+
+func (m *modeCipher) Encrypt(plainText []byte) ([]byte, error) {
+	if m.mode != ModeEncrypt {
+		return nil, fmt.Errorf("key can not be used for encryption")
+	}
+
+	return m.cipher.Encrypt(plainText)
+}
+
+func (m *modeCipher) Decrypt(cipherText []byte) ([]byte, error) {
+	if m.mode != ModeDecrypt {
+		return nil, fmt.Errorf("key can not be used for decryption")
+	}
+
+	return m.cipher.Decrypt(cipherText)
+}
+
+// KCV returns the check value of the key, whatever its mode of use
+func (m *modeCipher) KCV(method encryption.KCVMethod) string {
+	return m.cipher.KCV(method)
+}
+
+func macLength(version byte) int {
+	if version == VersionB {
+		return des.BlockSize
+	}
+	return aes.BlockSize
+}
+
+// deriveKeys returns the key block encryption key (KBEK) and the key block MAC
+// key (KBMK) derived from the KBPK with CMAC
+func deriveKeys(version byte, kbpk []byte) (cipher.Block, cipher.Block, error) {
+	var (
+		block     cipher.Block
+		algorithm uint16
+		err       error
+	)
+
+	switch version {
+	case VersionB:
+		switch len(kbpk) {
+		case 16:
+			algorithm = 0x0000
+			block, err = des.NewTripleDESCipher(append(append([]byte(nil), kbpk...), kbpk[:8]...))
+		case 24:
+			algorithm = 0x0001
+			block, err = des.NewTripleDESCipher(kbpk)
+		default:
+			return nil, nil, fmt.Errorf("kbpk length must be 16 or 24 bytes")
+		}
+	case VersionD:
+		switch len(kbpk) {
+		case 16, 24, 32:
+			// 2 for AES-128, 3 for AES-192 and 4 for AES-256
+			algorithm = uint16(len(kbpk) / 8)
+			block, err = aes.NewCipher(kbpk)
+		default:
+			return nil, nil, fmt.Errorf("kbpk length must be 16, 24 or 32 bytes")
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported key block version %q", version)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	newCipher := des.NewTripleDESCipher
+	if version == VersionD {
+		newCipher = aes.NewCipher
+	}
+
+	keys := make([]cipher.Block, 2)
+	for usage := range keys {
+		key := make([]byte, 0, len(kbpk)+aes.BlockSize)
+		for counter := 1; len(key) < len(kbpk); counter++ {
+			data := make([]byte, 8)
+			data[0] = byte(counter)
+			binary.BigEndian.PutUint16(data[1:], uint16(usage))
+			binary.BigEndian.PutUint16(data[4:], algorithm)
+			binary.BigEndian.PutUint16(data[6:], uint16(len(kbpk)*8))
+
+			key = append(key, cmac.Sum(block, data)...)
+		}
+		key = key[:len(kbpk)]
+
+		if version == VersionB && len(key) == 16 {
+			key = append(key, key[:8]...)
+		}
+
+		keys[usage], err = newCipher(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating cipher: %w", err)
+		}
+	}
+
+	return keys[0], keys[1], nil
+}
@@ -0,0 +1,281 @@
+package keyblock
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+
+	return b
+}
+
+func TestUnwrap(t *testing.T) {
+	t.Run("version D", func(t *testing.T) {
+		// ANSI X9.143 example of an AES key wrapped with an AES-256 KBPK
+		kbpk := mustDecode(t, "88E1AB2A2E3DD38C1FA039A536500CC8A87AB9D62DC92C01058FA79F44657DE6")
+
+		keyBlock, err := Unwrap(kbpk, "D0112P0AE00E0000B82679114F470F540165EDFBF7E250FCEA43F810D215F8D207E2E417C07156A27E8E31DA05F7425509593D03A457DC34")
+		require.NoError(t, err)
+
+		require.Equal(t, "3F419E1CB7079442AA37474C2EFBF8B8", fmt.Sprintf("%X", keyBlock.Key))
+		require.Equal(t, Header{
+			Version:       VersionD,
+			KeyUsage:      UsagePINEncryption,
+			Algorithm:     AlgorithmAES,
+			ModeOfUse:     ModeEncrypt,
+			KeyVersion:    "00",
+			Exportability: ExportableTrusted,
+		}, keyBlock.Header)
+	})
+
+	t.Run("version B", func(t *testing.T) {
+		kbpk := mustDecode(t, "89E88CF7931444F334BD7547FC3F380C")
+
+		keyBlock, err := Unwrap(kbpk, "B0080P0TE00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07")
+		require.NoError(t, err)
+
+		require.Equal(t, "F039121BEC83D26B169BDCD5B22AAF8F", fmt.Sprintf("%X", keyBlock.Key))
+		require.Equal(t, AlgorithmTDES, keyBlock.Header.Algorithm)
+	})
+
+	t.Run("wrong KBPK", func(t *testing.T) {
+		kbpk := mustDecode(t, "99E88CF7931444F334BD7547FC3F380C")
+
+		_, err := Unwrap(kbpk, "B0080P0TE00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07")
+		require.EqualError(t, err, "key block MAC verification failed")
+	})
+
+	t.Run("modified header", func(t *testing.T) {
+		kbpk := mustDecode(t, "89E88CF7931444F334BD7547FC3F380C")
+
+		_, err := Unwrap(kbpk, "B0080P0TB00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07")
+		require.EqualError(t, err, "key block MAC verification failed")
+	})
+
+	t.Run("invalid key blocks", func(t *testing.T) {
+		kbpk := mustDecode(t, "89E88CF7931444F334BD7547FC3F380C")
+
+		_, err := Unwrap(kbpk, "B0080P0TE00E")
+		require.EqualError(t, err, "key block must be at least 16 characters")
+
+		_, err = Unwrap(kbpk, "B0081P0TE00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07")
+		require.EqualError(t, err, "key block length 81 does not match actual length 80")
+
+		_, err = Unwrap(kbpk, "A0080P0TE00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07")
+		require.EqualError(t, err, "unsupported key block version 'A'")
+
+		_, err = Unwrap(kbpk, "B0080P0TE00E0000ZBB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07")
+		require.ErrorContains(t, err, "decoding key block")
+
+		_, err = Unwrap(kbpk, "B0032P0TE00E0000ABB782996A2AF965")
+		require.EqualError(t, err, "invalid encrypted key length")
+
+		_, err = Unwrap(kbpk[:8], "B0080P0TE00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07")
+		require.EqualError(t, err, "kbpk length must be 16 or 24 bytes")
+	})
+}
+
+func TestWrap(t *testing.T) {
+	key := mustDecode(t, "F039121BEC83D26B169BDCD5B22AAF8F")
+
+	for _, tc := range []struct {
+		version byte
+		kbpk    string
+	}{
+		{VersionB, "89E88CF7931444F334BD7547FC3F380C"},
+		{VersionB, "89E88CF7931444F334BD7547FC3F380C0123456789ABCDEF"},
+		{VersionD, "89E88CF7931444F334BD7547FC3F380C"},
+		{VersionD, "89E88CF7931444F334BD7547FC3F380C0123456789ABCDEF"},
+		{VersionD, "88E1AB2A2E3DD38C1FA039A536500CC8A87AB9D62DC92C01058FA79F44657DE6"},
+	} {
+		t.Run(fmt.Sprintf("%c with %d bytes KBPK", tc.version, len(tc.kbpk)/2), func(t *testing.T) {
+			kbpk := mustDecode(t, tc.kbpk)
+
+			header := Header{
+				Version:       tc.version,
+				KeyUsage:      UsagePINEncryption,
+				Algorithm:     AlgorithmTDES,
+				ModeOfUse:     ModeEncryptDecrypt,
+				KeyVersion:    "00",
+				Exportability: NonExportable,
+				OptionalBlocks: []OptionalBlock{
+					{ID: "KS", Data: "00604B120F9292800000"},
+				},
+			}
+
+			keyBlock, err := Wrap(kbpk, header, key)
+			require.NoError(t, err)
+
+			// the 40 characters header is padded to a multiple of 16 for AES
+			if tc.version == VersionB {
+				require.Equal(t, fmt.Sprintf("B%04dP0TB00N0100KS18", len(keyBlock)), keyBlock[:20])
+			} else {
+				require.Equal(t, fmt.Sprintf("D%04dP0TB00N0200KS18", len(keyBlock)), keyBlock[:20])
+				require.Equal(t, "PB08", keyBlock[40:44])
+			}
+
+			unwrapped, err := Unwrap(kbpk, keyBlock)
+			require.NoError(t, err)
+			require.Equal(t, key, unwrapped.Key)
+
+			// the padding block is not returned
+			require.Equal(t, header, unwrapped.Header)
+		})
+	}
+
+	t.Run("invalid header", func(t *testing.T) {
+		kbpk := mustDecode(t, "89E88CF7931444F334BD7547FC3F380C")
+
+		_, err := Wrap(kbpk, Header{Version: 'C'}, key)
+		require.EqualError(t, err, "unsupported key block version 'C'")
+
+		_, err = Wrap(kbpk, Header{Version: VersionB, KeyUsage: "P", Algorithm: AlgorithmTDES, KeyVersion: "00"}, key)
+		require.EqualError(t, err, "key usage must be 2 characters")
+
+		_, err = Wrap(kbpk, Header{Version: VersionB, KeyUsage: "P0", Algorithm: 'R', KeyVersion: "00"}, key)
+		require.EqualError(t, err, "unsupported algorithm 'R'")
+
+		_, err = Wrap(kbpk, Header{Version: VersionB, KeyUsage: "P0", Algorithm: AlgorithmTDES, KeyVersion: "00"}, nil)
+		require.EqualError(t, err, "invalid key length 0")
+
+		_, err = Wrap(kbpk, Header{
+			Version:        VersionB,
+			KeyUsage:       "P0",
+			Algorithm:      AlgorithmTDES,
+			ModeOfUse:      ModeEncryptDecrypt,
+			KeyVersion:     "00",
+			Exportability:  NonExportable,
+			OptionalBlocks: []OptionalBlock{{ID: "PB", Data: "0000"}},
+		}, key)
+		require.EqualError(t, err, `invalid optional block ID "PB"`)
+	})
+}
+
+func TestParseHeader(t *testing.T) {
+	header, err := ParseHeader("D0112P0AE00E0000B82679114F470F540165EDFBF7E250FCEA43F810D215F8D207E2E417C07156A27E8E31DA05F7425509593D03A457DC34")
+	require.NoError(t, err)
+	require.Equal(t, UsagePINEncryption, header.KeyUsage)
+	require.Equal(t, AlgorithmAES, header.Algorithm)
+
+	t.Run("extended length of optional block", func(t *testing.T) {
+		header, err := ParseHeader("B0034P0TB00N0100KS0004001200000000")
+		require.NoError(t, err)
+		require.Equal(t, []OptionalBlock{{ID: "KS", Data: "00000000"}}, header.OptionalBlocks)
+	})
+
+	t.Run("invalid optional block", func(t *testing.T) {
+		_, err := ParseHeader("B0020P0TB00N0100KS09")
+		require.EqualError(t, err, "parsing optional block 1: invalid length 9")
+	})
+}
+
+func TestKeyBlockCipher(t *testing.T) {
+	tdesKey := mustDecode(t, "0123456789ABCDEFFEDCBA9876543210")
+
+	t.Run("TDES PIN key", func(t *testing.T) {
+		keyBlock := &KeyBlock{
+			Header: Header{KeyUsage: UsagePINEncryption, Algorithm: AlgorithmTDES, ModeOfUse: ModeEncryptDecrypt},
+			Key:    tdesKey,
+		}
+
+		cipher, err := keyBlock.Cipher()
+		require.NoError(t, err)
+
+		pinBlock, err := formats.NewEncrypted(formats.NewISO0(), cipher).Encode("1234", "5432101234567891")
+		require.NoError(t, err)
+		require.Equal(t, "BA2ADC4EBA48F711", pinBlock)
+	})
+
+	t.Run("AES PIN key", func(t *testing.T) {
+		keyBlock := &KeyBlock{
+			Header: Header{KeyUsage: UsagePINEncryption, Algorithm: AlgorithmAES, ModeOfUse: ModeEncryptDecrypt},
+			Key:    []byte("1234567890123456"),
+		}
+
+		cipher, err := keyBlock.Cipher()
+		require.NoError(t, err)
+
+		iso4 := formats.NewISO4(cipher)
+		pinBlock, err := iso4.Encode("1234", "432198765432109870")
+		require.NoError(t, err)
+
+		pin, err := iso4.Decode(pinBlock, "432198765432109870")
+		require.NoError(t, err)
+		require.Equal(t, "1234", pin)
+	})
+
+	t.Run("mode of use", func(t *testing.T) {
+		encryptOnly := &KeyBlock{
+			Header: Header{KeyUsage: UsagePINEncryption, Algorithm: AlgorithmTDES, ModeOfUse: ModeEncrypt},
+			Key:    tdesKey,
+		}
+
+		cipher, err := encryptOnly.Cipher()
+		require.NoError(t, err)
+
+		cipherText, err := cipher.Encrypt(make([]byte, 8))
+		require.NoError(t, err)
+
+		_, err = cipher.Decrypt(cipherText)
+		require.EqualError(t, err, "key can not be used for decryption")
+
+		decryptOnly := &KeyBlock{
+			Header: Header{KeyUsage: UsagePINEncryption, Algorithm: AlgorithmTDES, ModeOfUse: ModeDecrypt},
+			Key:    tdesKey,
+		}
+
+		cipher, err = decryptOnly.Cipher()
+		require.NoError(t, err)
+
+		plainText, err := cipher.Decrypt(cipherText)
+		require.NoError(t, err)
+		require.Equal(t, make([]byte, 8), plainText)
+
+		_, err = cipher.Encrypt(plainText)
+		require.EqualError(t, err, "key can not be used for encryption")
+
+		// the check value does not depend on the mode of use
+		kcv := cipher.(interface {
+			KCV(method encryption.KCVMethod) string
+		}).KCV(encryption.KCVZeros)
+		require.Equal(t, "08D7B4", kcv)
+
+		derive := &KeyBlock{
+			Header: Header{KeyUsage: UsagePINEncryption, Algorithm: AlgorithmTDES, ModeOfUse: ModeDerive},
+			Key:    tdesKey,
+		}
+
+		_, err = derive.Cipher()
+		require.EqualError(t, err, "mode of use 'X' does not allow PIN encryption")
+	})
+
+	t.Run("not a PIN key", func(t *testing.T) {
+		keyBlock := &KeyBlock{
+			Header: Header{KeyUsage: UsageKeyEncryption, Algorithm: AlgorithmTDES, ModeOfUse: ModeEncryptDecrypt},
+			Key:    tdesKey,
+		}
+
+		_, err := keyBlock.Cipher()
+		require.EqualError(t, err, "key usage K0 is not PIN encryption")
+	})
+
+	t.Run("wrong key length", func(t *testing.T) {
+		keyBlock := &KeyBlock{
+			Header: Header{KeyUsage: UsagePINEncryption, Algorithm: AlgorithmTDES, ModeOfUse: ModeEncryptDecrypt},
+			Key:    tdesKey[:8],
+		}
+
+		_, err := keyBlock.Cipher()
+		require.EqualError(t, err, "key length must be 16 or 24 bytes")
+	})
+}
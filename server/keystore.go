@@ -0,0 +1,335 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/moov-io/pinblock/keyblock"
+)
+
+// ErrKeyNotFound is returned by a key store for an unknown key ID
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrKeyUsage is returned by a key store for a key that is used for another
+// purpose than its usage, such as a PIN verification key used to encrypt PIN
+// blocks. It is matched by the KeyUsageError of the key.
+var ErrKeyUsage = errors.New("key usage does not allow the operation")
+
+// KeyUsageError is the error of a key used for another purpose than its usage
+type KeyUsageError struct {
+	ID    string
+	Usage string
+
+	// Allowed are the usages of the operation
+	Allowed []string
+}
+
+func (e *KeyUsageError) Error() string {
+	return fmt.Sprintf("key %s has usage %s, expected %s", e.ID, e.Usage, strings.Join(e.Allowed, " or "))
+}
+
+// Is makes errors.Is(err, ErrKeyUsage) true for a KeyUsageError
+func (e *KeyUsageError) Is(target error) bool {
+	return target == ErrKeyUsage
+}
+
+// Key algorithms of the key store
+const (
+	AlgorithmTDES = "TDES"
+	AlgorithmAES  = "AES"
+)
+
+// Key usages of the key store, the TR-31 key usages
+const (
+	UsageKeyEncryption = keyblock.UsageKeyEncryption
+	UsagePINEncryption = keyblock.UsagePINEncryption
+
+	UsagePINVerificationKPV     = keyblock.UsagePINVerificationKPV
+	UsagePINVerificationIBM3624 = keyblock.UsagePINVerificationIBM3624
+	UsagePINVerificationVisaPVV = keyblock.UsagePINVerificationVisaPVV
+)
+
+// verificationUsages are the usages of the PIN verification keys by method
+var verificationUsages = map[string]string{
+	MethodIBM3624: UsagePINVerificationIBM3624,
+	MethodVisaPVV: UsagePINVerificationVisaPVV,
+}
+
+// KeyStore returns the ciphers of the keys referenced by ID in the requests.
+// The keys are separated by usage: a PIN encryption key can not verify PINs
+// and a PIN verification key can not encrypt PIN blocks.
+type KeyStore interface {
+	// PINEncryptionKey returns the cipher of a PIN encryption key (P0)
+	PINEncryptionKey(id string) (formats.Cipher, error)
+
+	// PINVerificationKey returns the cipher of a PIN verification key of a
+	// verification method: V1 for IBM 3624 and V2 for Visa PVV
+	PINVerificationKey(id, method string) (formats.Cipher, error)
+}
+
+// Key is a key of the key store file. The key is given in hex with its
+// algorithm and usage, or as a TR-31 key block protected by another key of
+// the store.
+type Key struct {
+	ID string `json:"id"`
+
+	// Algorithm is TDES or AES, it is required for a hex key
+	Algorithm string `json:"algorithm,omitempty"`
+	Key       string `json:"key,omitempty"`
+
+	// Usage is the TR-31 key usage of the key: P0 for a PIN encryption key,
+	// V0, V1 or V2 for a PIN verification key and K0 for a key block
+	// protection key. It is required for a hex key, for a key block it must
+	// be the usage of its header when it is given.
+	Usage string `json:"usage,omitempty"`
+
+	// KeyBlock is a TR-31 key block protected by the key with ID KBPK
+	KeyBlock string `json:"key_block,omitempty"`
+	KBPK     string `json:"kbpk,omitempty"`
+
+	// KCV is verified when the key is loaded
+	KCV string `json:"kcv,omitempty"`
+}
+
+// MemoryKeyStore is a key store of the ciphers of a set of keys. It is not
+// modified after it is created and is safe for concurrent use.
+//
+// Ciphers are available for the PIN encryption and PIN verification keys.
+// Key block protection keys only protect the key blocks of the store.
+type MemoryKeyStore struct {
+	keys    map[string]Key
+	ciphers map[string]storedCipher
+}
+
+// storedCipher is the cipher of a key and its usage, the cipher of a key
+// block protection key is nil
+type storedCipher struct {
+	cipher formats.Cipher
+	usage  string
+}
+
+// NewMemoryKeyStore returns a key store of keys. The keys are checked and
+// their ciphers created, an error is returned for the first invalid key.
+func NewMemoryKeyStore(keys ...Key) (*MemoryKeyStore, error) {
+	store := &MemoryKeyStore{
+		keys:    make(map[string]Key),
+		ciphers: make(map[string]storedCipher),
+	}
+
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("key id is required")
+		}
+
+		if _, exists := store.keys[key.ID]; exists {
+			return nil, fmt.Errorf("key %s is duplicated", key.ID)
+		}
+
+		store.keys[key.ID] = key
+	}
+
+	for _, key := range keys {
+		cipher, err := store.newCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.ID, err)
+		}
+
+		store.ciphers[key.ID] = cipher
+	}
+
+	return store, nil
+}
+
+// LoadKeyStore reads a key store file, a JSON document with the list of keys:
+//
+//	{
+//	  "keys": [
+//	    {"id": "zpk", "algorithm": "TDES", "usage": "P0", "key": "0123456789ABCDEFFEDCBA9876543210", "kcv": "08D7B4"},
+//	    {"id": "pvk", "algorithm": "TDES", "usage": "V2", "key": "..."},
+//	    {"id": "kbpk", "algorithm": "AES", "usage": "K0", "key": "..."},
+//	    {"id": "bdk-pek", "key_block": "D0144P0AE00E0000...", "kbpk": "kbpk"}
+//	  ]
+//	}
+func LoadKeyStore(path string) (*MemoryKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key store: %w", err)
+	}
+
+	var file struct {
+		Keys []Key `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing key store: %w", err)
+	}
+
+	return NewMemoryKeyStore(file.Keys...)
+}
+
+// PINEncryptionKey returns the cipher of the PIN encryption key with id
+func (s *MemoryKeyStore) PINEncryptionKey(id string) (formats.Cipher, error) {
+	return s.cipher(id, UsagePINEncryption)
+}
+
+// PINVerificationKey returns the cipher of the PIN verification key with id
+// of the verification method
+func (s *MemoryKeyStore) PINVerificationKey(id, method string) (formats.Cipher, error) {
+	usage, ok := verificationUsages[method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported verification method %q", method)
+	}
+
+	return s.cipher(id, usage)
+}
+
+// cipher returns the cipher of the key with id, which must have one of the
+// allowed usages
+func (s *MemoryKeyStore) cipher(id string, allowed ...string) (formats.Cipher, error) {
+	cipher, ok := s.ciphers[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+
+	if !slices.Contains(allowed, cipher.usage) {
+		return nil, &KeyUsageError{ID: id, Usage: cipher.usage, Allowed: allowed}
+	}
+
+	return cipher.cipher, nil
+}
+
+// maxKeyBlockDepth limits the chain of key blocks protected by key blocks
+const maxKeyBlockDepth = 4
+
+// newCipher returns the cipher of key and its usage, the cipher is nil for a
+// key that is not a PIN encryption or PIN verification key
+func (s *MemoryKeyStore) newCipher(key Key) (storedCipher, error) {
+	if key.KeyBlock == "" {
+		rawKey, err := hex.DecodeString(key.Key)
+		if err != nil {
+			return storedCipher{}, fmt.Errorf("decoding key: %w", err)
+		}
+
+		if key.Usage == "" {
+			return storedCipher{}, fmt.Errorf("usage is required for a hex key")
+		}
+
+		cipher, err := newECB(key.Algorithm, rawKey, key.KCV)
+		if err != nil {
+			return storedCipher{}, err
+		}
+
+		switch key.Usage {
+		case UsagePINEncryption, UsagePINVerificationKPV, UsagePINVerificationIBM3624, UsagePINVerificationVisaPVV:
+			return storedCipher{cipher: cipher, usage: key.Usage}, nil
+		case UsageKeyEncryption:
+			return storedCipher{usage: key.Usage}, nil
+		default:
+			return storedCipher{}, fmt.Errorf("unsupported key usage %q", key.Usage)
+		}
+	}
+
+	kb, err := s.unwrap(key, 0)
+	if err != nil {
+		return storedCipher{}, err
+	}
+
+	usage := kb.Header.KeyUsage
+	if key.Usage != "" && key.Usage != usage {
+		return storedCipher{}, fmt.Errorf("usage %s does not match key block usage %s", key.Usage, usage)
+	}
+
+	algorithm := AlgorithmTDES
+	if kb.Header.Algorithm == keyblock.AlgorithmAES {
+		algorithm = AlgorithmAES
+	}
+
+	switch usage {
+	case UsagePINEncryption:
+		// the ECB cipher checks the KCV, the key block enforces the mode of use
+		if _, err := newECB(algorithm, kb.Key, key.KCV); err != nil {
+			return storedCipher{}, err
+		}
+
+		cipher, err := kb.Cipher()
+		if err != nil {
+			return storedCipher{}, err
+		}
+		return storedCipher{cipher: cipher, usage: usage}, nil
+	case UsagePINVerificationKPV, UsagePINVerificationIBM3624, UsagePINVerificationVisaPVV:
+		cipher, err := newECB(algorithm, kb.Key, key.KCV)
+		if err != nil {
+			return storedCipher{}, err
+		}
+		return storedCipher{cipher: cipher, usage: usage}, nil
+	default:
+		return storedCipher{usage: usage}, nil
+	}
+}
+
+func newECB(algorithm string, key []byte, kcv string) (formats.Cipher, error) {
+	var opts []encryption.Option
+	if kcv != "" {
+		opts = append(opts, encryption.WithKCV(kcv))
+	}
+
+	switch algorithm {
+	case AlgorithmTDES:
+		return encryption.NewTdesECB(key, opts...)
+	case AlgorithmAES:
+		return encryption.NewAesECB(key, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+}
+
+// unwrap returns the key block of key unwrapped with its key block protection
+// key, which is a hex key or a key block of the store itself
+func (s *MemoryKeyStore) unwrap(key Key, depth int) (*keyblock.KeyBlock, error) {
+	if depth >= maxKeyBlockDepth {
+		return nil, fmt.Errorf("too many nested key blocks")
+	}
+
+	kbpk, ok := s.keys[key.KBPK]
+	if !ok {
+		return nil, fmt.Errorf("kbpk: %w: %s", ErrKeyNotFound, key.KBPK)
+	}
+
+	if kbpk.KeyBlock == "" && kbpk.Usage != UsageKeyEncryption {
+		return nil, fmt.Errorf("kbpk: %w", &KeyUsageError{ID: kbpk.ID, Usage: kbpk.Usage, Allowed: []string{UsageKeyEncryption}})
+	}
+
+	var rawKBPK []byte
+
+	if kbpk.KeyBlock != "" {
+		kb, err := s.unwrap(kbpk, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("kbpk %s: %w", kbpk.ID, err)
+		}
+
+		if kb.Header.KeyUsage != UsageKeyEncryption {
+			return nil, fmt.Errorf("kbpk: %w", &KeyUsageError{ID: kbpk.ID, Usage: kb.Header.KeyUsage, Allowed: []string{UsageKeyEncryption}})
+		}
+		rawKBPK = kb.Key
+	} else {
+		var err error
+		rawKBPK, err = hex.DecodeString(kbpk.Key)
+		if err != nil {
+			return nil, fmt.Errorf("decoding kbpk %s: %w", kbpk.ID, err)
+		}
+	}
+
+	kb, err := keyblock.Unwrap(rawKBPK, key.KeyBlock)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping key block: %w", err)
+	}
+
+	return kb, nil
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moov-io/pinblock/keyblock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	zpk    = "0123456789ABCDEFFEDCBA9876543210"
+	aesKey = "31323334353637383930313233343536"
+
+	// TR-31 key block of the PIN encryption key F039121BEC83D26B169BDCD5B22AAF8F
+	kbpk     = "89E88CF7931444F334BD7547FC3F380C"
+	keyBlock = "B0080P0TE00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07"
+)
+
+func wrapKey(t *testing.T, usage, key string) string {
+	t.Helper()
+
+	rawKBPK, err := hex.DecodeString(kbpk)
+	require.NoError(t, err)
+
+	rawKey, err := hex.DecodeString(key)
+	require.NoError(t, err)
+
+	block, err := keyblock.Wrap(rawKBPK, keyblock.Header{
+		Version:       keyblock.VersionB,
+		KeyUsage:      usage,
+		Algorithm:     keyblock.AlgorithmTDES,
+		ModeOfUse:     keyblock.ModeEncrypt,
+		KeyVersion:    "00",
+		Exportability: keyblock.NonExportable,
+	}, rawKey)
+	require.NoError(t, err)
+
+	return block
+}
+
+func TestMemoryKeyStore(t *testing.T) {
+	t.Run("hex and key block keys", func(t *testing.T) {
+		store, err := NewMemoryKeyStore(
+			Key{ID: "zpk", Algorithm: AlgorithmTDES, Usage: UsagePINEncryption, Key: zpk, KCV: "08D7B4"},
+			Key{ID: "aes", Algorithm: AlgorithmAES, Usage: UsagePINEncryption, Key: aesKey},
+			Key{ID: "kbpk", Algorithm: AlgorithmTDES, Usage: UsageKeyEncryption, Key: kbpk},
+			Key{ID: "pek", KeyBlock: keyBlock, KBPK: "kbpk"},
+			Key{ID: "hex-pvk", Algorithm: AlgorithmTDES, Usage: UsagePINVerificationIBM3624, Key: zpk},
+			Key{ID: "pvk", KeyBlock: wrapKey(t, keyblock.UsagePINVerificationVisaPVV, zpk), KBPK: "kbpk", KCV: "08D7B4"},
+		)
+		require.NoError(t, err)
+
+		for _, id := range []string{"zpk", "aes", "pek"} {
+			cipher, err := store.PINEncryptionKey(id)
+			require.NoError(t, err, id)
+			require.NotNil(t, cipher, id)
+		}
+
+		cipher, err := store.PINVerificationKey("hex-pvk", MethodIBM3624)
+		require.NoError(t, err)
+		require.NotNil(t, cipher)
+
+		cipher, err = store.PINVerificationKey("pvk", MethodVisaPVV)
+		require.NoError(t, err)
+		require.NotNil(t, cipher)
+
+		// the mode of use of the key block is enforced
+		pek, err := store.PINEncryptionKey("pek")
+		require.NoError(t, err)
+
+		_, err = pek.Decrypt(make([]byte, 8))
+		require.EqualError(t, err, "key can not be used for decryption")
+
+		_, err = store.PINEncryptionKey("unknown")
+		require.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("key usage", func(t *testing.T) {
+		store, err := NewMemoryKeyStore(
+			Key{ID: "zpk", Algorithm: AlgorithmTDES, Usage: UsagePINEncryption, Key: zpk},
+			Key{ID: "kbpk", Algorithm: AlgorithmTDES, Usage: UsageKeyEncryption, Key: kbpk},
+			Key{ID: "pek", KeyBlock: keyBlock, KBPK: "kbpk"},
+			Key{ID: "hex-pvk", Algorithm: AlgorithmTDES, Usage: UsagePINVerificationVisaPVV, Key: zpk},
+			Key{ID: "pvk", KeyBlock: wrapKey(t, keyblock.UsagePINVerificationIBM3624, zpk), KBPK: "kbpk"},
+		)
+		require.NoError(t, err)
+
+		// a PIN verification key can not encrypt PIN blocks
+		for _, id := range []string{"hex-pvk", "pvk"} {
+			_, err = store.PINEncryptionKey(id)
+			require.ErrorIs(t, err, ErrKeyUsage, id)
+
+			var usageErr *KeyUsageError
+			require.ErrorAs(t, err, &usageErr)
+			require.Equal(t, id, usageErr.ID)
+		}
+
+		_, err = store.PINEncryptionKey("pvk")
+		require.EqualError(t, err, "key pvk has usage V1, expected P0")
+
+		// a PIN encryption key can not verify PINs
+		for _, id := range []string{"zpk", "pek"} {
+			_, err = store.PINVerificationKey(id, MethodIBM3624)
+			require.ErrorIs(t, err, ErrKeyUsage, id)
+		}
+
+		_, err = store.PINVerificationKey("zpk", MethodVisaPVV)
+		require.EqualError(t, err, "key zpk has usage P0, expected V2")
+
+		// a PIN verification key only verifies PINs with its method
+		_, err = store.PINVerificationKey("pvk", MethodVisaPVV)
+		require.ErrorIs(t, err, ErrKeyUsage)
+		require.EqualError(t, err, "key pvk has usage V1, expected V2")
+
+		_, err = store.PINVerificationKey("hex-pvk", MethodIBM3624)
+		require.ErrorIs(t, err, ErrKeyUsage)
+		require.EqualError(t, err, "key hex-pvk has usage V2, expected V1")
+
+		_, err = store.PINVerificationKey("pvk", "PIN-COMPARE")
+		require.EqualError(t, err, `unsupported verification method "PIN-COMPARE"`)
+
+		// a key block protection key only protects key blocks
+		_, err = store.PINEncryptionKey("kbpk")
+		require.ErrorIs(t, err, ErrKeyUsage)
+
+		_, err = store.PINVerificationKey("kbpk", MethodIBM3624)
+		require.ErrorIs(t, err, ErrKeyUsage)
+	})
+
+	t.Run("key block protection key as key block", func(t *testing.T) {
+		store, err := NewMemoryKeyStore(
+			Key{ID: "lmk", Algorithm: AlgorithmTDES, Usage: UsageKeyEncryption, Key: kbpk},
+			Key{ID: "kbpk", KeyBlock: wrapKey(t, keyblock.UsageKeyEncryption, kbpk), KBPK: "lmk"},
+			Key{ID: "pek", KeyBlock: keyBlock, KBPK: "kbpk"},
+		)
+		require.NoError(t, err)
+
+		_, err = store.PINEncryptionKey("pek")
+		require.NoError(t, err)
+
+		_, err = store.PINEncryptionKey("kbpk")
+		require.EqualError(t, err, "key kbpk has usage K0, expected P0")
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		_, err := NewMemoryKeyStore(Key{Algorithm: AlgorithmTDES, Usage: UsagePINEncryption, Key: zpk})
+		require.EqualError(t, err, "key id is required")
+
+		_, err = NewMemoryKeyStore(Key{ID: "zpk", Algorithm: AlgorithmTDES, Usage: UsagePINEncryption, Key: zpk}, Key{ID: "zpk", Algorithm: AlgorithmAES, Usage: UsagePINEncryption, Key: aesKey})
+		require.EqualError(t, err, "key zpk is duplicated")
+
+		_, err = NewMemoryKeyStore(Key{ID: "zpk", Algorithm: AlgorithmTDES, Usage: UsagePINEncryption, Key: zpk, KCV: "08D7B5"})
+		require.EqualError(t, err, "key zpk: key check value 08D7B4 does not match expected 08D7B5")
+
+		_, err = NewMemoryKeyStore(Key{ID: "zpk", Algorithm: "DES", Usage: UsagePINEncryption, Key: zpk})
+		require.EqualError(t, err, `key zpk: unsupported algorithm "DES"`)
+
+		_, err = NewMemoryKeyStore(Key{ID: "zpk", Algorithm: AlgorithmTDES, Usage: UsagePINEncryption, Key: "XYZ"})
+		require.ErrorContains(t, err, "key zpk: decoding key")
+
+		_, err = NewMemoryKeyStore(Key{ID: "zpk", Algorithm: AlgorithmTDES, Key: zpk})
+		require.EqualError(t, err, "key zpk: usage is required for a hex key")
+
+		_, err = NewMemoryKeyStore(Key{ID: "bdk", Algorithm: AlgorithmTDES, Usage: "B0", Key: zpk})
+		require.EqualError(t, err, `key bdk: unsupported key usage "B0"`)
+
+		_, err = NewMemoryKeyStore(Key{ID: "pek", KeyBlock: keyBlock, KBPK: "kbpk"})
+		require.ErrorIs(t, err, ErrKeyNotFound)
+
+		_, err = NewMemoryKeyStore(Key{ID: "kbpk", Algorithm: AlgorithmTDES, Usage: UsageKeyEncryption, Key: zpk}, Key{ID: "pek", KeyBlock: keyBlock, KBPK: "kbpk"})
+		require.EqualError(t, err, "key pek: unwrapping key block: key block MAC verification failed")
+
+		// the key block protection key must have the key encryption usage
+		_, err = NewMemoryKeyStore(Key{ID: "kbpk", Algorithm: AlgorithmTDES, Usage: UsagePINEncryption, Key: kbpk}, Key{ID: "pek", KeyBlock: keyBlock, KBPK: "kbpk"})
+		require.ErrorIs(t, err, ErrKeyUsage)
+		require.EqualError(t, err, "key pek: kbpk: key kbpk has usage P0, expected K0")
+
+		// the usage of a key block is the usage of its header
+		_, err = NewMemoryKeyStore(
+			Key{ID: "kbpk", Algorithm: AlgorithmTDES, Usage: UsageKeyEncryption, Key: kbpk},
+			Key{ID: "pvk", Usage: UsagePINVerificationVisaPVV, KeyBlock: keyBlock, KBPK: "kbpk"},
+		)
+		require.EqualError(t, err, "key pvk: usage V2 does not match key block usage P0")
+	})
+}
+
+func TestLoadKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	err := os.WriteFile(path, []byte(`{
+		"keys": [
+			{"id": "zpk", "algorithm": "TDES", "usage": "P0", "key": "0123456789ABCDEFFEDCBA9876543210", "kcv": "08D7B4"},
+			{"id": "kbpk", "algorithm": "TDES", "usage": "K0", "key": "89E88CF7931444F334BD7547FC3F380C"},
+			{"id": "pek", "key_block": "B0080P0TE00E0000ABB782996A2AF9652882FB0259F07DB03FBDBBDCE3437CC2F19102984C6A7E07", "kbpk": "kbpk"}
+		]
+	}`), 0600)
+	require.NoError(t, err)
+
+	store, err := LoadKeyStore(path)
+	require.NoError(t, err)
+
+	_, err = store.PINEncryptionKey("pek")
+	require.NoError(t, err)
+
+	_, err = LoadKeyStore(filepath.Join(t.TempDir(), "missing.json"))
+	require.ErrorContains(t, err, "reading key store")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [`), 0600))
+
+	_, err = LoadKeyStore(path)
+	require.ErrorContains(t, err, "parsing key store")
+}
@@ -0,0 +1,369 @@
+// Package server exposes the PIN block operations over HTTP with JSON
+// requests and responses, so that services written in other languages can
+// encode, decode, translate and verify PIN blocks. Keys are never passed in
+// the requests, they are referenced by ID from a key store.
+//
+//	POST /encode     {"format": "ISO-0", "key_id": "zpk", "pan": "5432101234567891", "pin": "1234"}
+//	POST /decode     {"format": "ISO-0", "key_id": "zpk", "pan": "5432101234567891", "pin_block": "BA2ADC4EBA48F711"}
+//	POST /translate  {"from": {"format": "ISO-0", "key_id": "zpk"}, "to": {"format": "ISO-4", "key_id": "aes-pek"}, "pan": "...", "pin_block": "..."}
+//	POST /verify     {"format": "ISO-0", "key_id": "zpk", "pan": "...", "pin_block": "...", "method": "VISA-PVV", "pvk_id": "pvk", "pvki": 1, "pvv": "1894"}
+//
+// The key_id of a format must be a PIN encryption key (P0) and the pvk_id a
+// PIN verification key of the method, V1 for IBM 3624 and V2 for Visa PVV.
+// The keys used for another purpose are refused with status 403. The
+// decimalization table of IBM 3624 is set by the server, not the requests.
+//
+// Errors are returned as {"error": "..."} with status 400 for invalid
+// requests, 404 for unknown keys and 500 for cipher failures.
+//
+// The server has no authentication: it must only be reachable behind an
+// authenticated boundary, such as mutual TLS or a gateway that authorizes the
+// callers. /decode returns the clear PIN, it is only served with WithDecode.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/moov-io/pinblock/formats"
+	"github.com/moov-io/pinblock/verification"
+)
+
+// Verification methods of the verify endpoint
+const (
+	MethodIBM3624 = "IBM3624"
+	MethodVisaPVV = "VISA-PVV"
+)
+
+// maxRequestSize is the maximum size of a request body
+const maxRequestSize = 64 << 10
+
+// FormatKey is a PIN block format and the ID of its key. Without a key ID the
+// PIN block is clear, ISO-4 is then encoded with the NoOp cipher.
+type FormatKey struct {
+	Format string `json:"format"`
+	KeyID  string `json:"key_id,omitempty"`
+}
+
+// EncodeRequest is the body of POST /encode
+type EncodeRequest struct {
+	FormatKey
+	PAN string `json:"pan"`
+	PIN string `json:"pin"`
+}
+
+// EncodeResponse is the response of POST /encode
+type EncodeResponse struct {
+	PINBlock string `json:"pin_block"`
+}
+
+// DecodeRequest is the body of POST /decode
+type DecodeRequest struct {
+	FormatKey
+	PAN      string `json:"pan"`
+	PINBlock string `json:"pin_block"`
+}
+
+// DecodeResponse is the response of POST /decode, it contains the clear PIN.
+// The endpoint must only be reachable by authorized callers.
+type DecodeResponse struct {
+	PIN string `json:"pin"`
+}
+
+// TranslateRequest is the body of POST /translate
+type TranslateRequest struct {
+	From     FormatKey `json:"from"`
+	To       FormatKey `json:"to"`
+	PAN      string    `json:"pan"`
+	PINBlock string    `json:"pin_block"`
+}
+
+// TranslateResponse is the response of POST /translate
+type TranslateResponse struct {
+	PINBlock string `json:"pin_block"`
+}
+
+// VerifyRequest decodes the PIN block and verifies the PIN with the IBM 3624
+// method (offset and validation data) or with the Visa PVV method (PVKI and
+// PVV).
+type VerifyRequest struct {
+	FormatKey
+	PAN      string `json:"pan"`
+	PINBlock string `json:"pin_block"`
+	Method   string `json:"method"`
+	PVKID    string `json:"pvk_id"`
+
+	Offset         string `json:"offset,omitempty"`
+	ValidationData string `json:"validation_data,omitempty"`
+
+	PVKI int    `json:"pvki,omitempty"`
+	PVV  string `json:"pvv,omitempty"`
+}
+
+// VerifyResponse is the response of POST /verify
+type VerifyResponse struct {
+	Verified bool `json:"verified"`
+}
+
+// ErrorResponse is the response of a failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// errInternal is the error of a request that fails because of the
+// configuration of the server
+var errInternal = errors.New("internal error")
+
+type options struct {
+	decode              bool
+	decimalizationTable string
+}
+
+// Option configures a server
+type Option func(*options)
+
+// WithDecode serves /decode, which returns clear PINs to the callers
+func WithDecode() Option {
+	return func(o *options) {
+		o.decode = true
+	}
+}
+
+// WithDecimalizationTable sets the decimalization table of the IBM 3624
+// verifications, verification.DefaultDecimalizationTable by default. The
+// table is never taken from the requests: a caller choosing the table can
+// recover PINs with a few verifications.
+func WithDecimalizationTable(table string) Option {
+	return func(o *options) {
+		o.decimalizationTable = table
+	}
+}
+
+// Server handles the PIN block requests
+type Server struct {
+	keys KeyStore
+	mux  *http.ServeMux
+
+	decimalizationTable string
+}
+
+// New returns a server using the keys of the key store. /decode is only
+// served with WithDecode.
+func New(keys KeyStore, opts ...Option) *Server {
+	o := options{decimalizationTable: verification.DefaultDecimalizationTable}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &Server{
+		keys: keys,
+		mux:  http.NewServeMux(),
+
+		decimalizationTable: o.decimalizationTable,
+	}
+
+	s.mux.HandleFunc("POST /encode", s.encode)
+	if o.decode {
+		s.mux.HandleFunc("POST /decode", s.decode)
+	}
+	s.mux.HandleFunc("POST /translate", s.translate)
+	s.mux.HandleFunc("POST /verify", s.verify)
+
+	return s
+}
+
+// ServeHTTP dispatches the request to the handler of its endpoint
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) encode(w http.ResponseWriter, r *http.Request) {
+	var req EncodeRequest
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	format, err := s.newFormat(req.FormatKey)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pinBlock, err := format.Encode(req.PIN, req.PAN)
+	if err != nil {
+		writeError(w, fmt.Errorf("encoding pin block: %w", err))
+		return
+	}
+
+	writeResponse(w, EncodeResponse{PINBlock: pinBlock})
+}
+
+func (s *Server) decode(w http.ResponseWriter, r *http.Request) {
+	var req DecodeRequest
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	format, err := s.newFormat(req.FormatKey)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pin, err := format.Decode(req.PINBlock, req.PAN)
+	if err != nil {
+		writeError(w, fmt.Errorf("decoding pin block: %w", err))
+		return
+	}
+
+	writeResponse(w, DecodeResponse{PIN: pin})
+}
+
+func (s *Server) translate(w http.ResponseWriter, r *http.Request) {
+	var req TranslateRequest
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	from, err := s.newFormat(req.From)
+	if err != nil {
+		writeError(w, fmt.Errorf("from: %w", err))
+		return
+	}
+
+	to, err := s.newFormat(req.To)
+	if err != nil {
+		writeError(w, fmt.Errorf("to: %w", err))
+		return
+	}
+
+	pinBlock, err := formats.TranslatePIN(req.PINBlock, req.PAN, from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeResponse(w, TranslateResponse{PINBlock: pinBlock})
+}
+
+func (s *Server) verify(w http.ResponseWriter, r *http.Request) {
+	var req VerifyRequest
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	if req.Method != MethodIBM3624 && req.Method != MethodVisaPVV {
+		writeError(w, fmt.Errorf("unsupported verification method %q", req.Method))
+		return
+	}
+
+	format, err := s.newFormat(req.FormatKey)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pvk, err := s.keys.PINVerificationKey(req.PVKID, req.Method)
+	if err != nil {
+		writeError(w, fmt.Errorf("pvk: %w", err))
+		return
+	}
+
+	pin, err := format.Decode(req.PINBlock, req.PAN)
+	if err != nil {
+		writeError(w, fmt.Errorf("decoding pin block: %w", err))
+		return
+	}
+
+	var verified bool
+
+	switch req.Method {
+	case MethodIBM3624:
+		ibm3624, err := verification.NewIBM3624(pvk, s.decimalizationTable)
+		if err != nil {
+			writeError(w, fmt.Errorf("%w: %w", errInternal, err))
+			return
+		}
+
+		verified, err = ibm3624.Verify(pin, req.ValidationData, req.Offset)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	case MethodVisaPVV:
+		pvv, err := verification.NewVisaPVV(pvk)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		verified, err = pvv.Verify(pin, req.PAN, req.PVKI, req.PVV)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	default:
+		writeError(w, fmt.Errorf("unsupported verification method %q", req.Method))
+		return
+	}
+
+	writeResponse(w, VerifyResponse{Verified: verified})
+}
+
+// newFormat returns the format of f encrypted with the PIN encryption key of
+// the key store
+func (s *Server) newFormat(f FormatKey) (formats.Format, error) {
+	var opts []formats.Option
+
+	if f.KeyID != "" {
+		cipher, err := s.keys.PINEncryptionKey(f.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, formats.WithCipher(cipher))
+	}
+
+	format, err := formats.NewFormatter(f.Format, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("format %s: %w", f.Format, err)
+	}
+
+	return format, nil
+}
+
+// readRequest decodes the JSON body of r into req. It writes the error
+// response and returns false when the body is invalid.
+func readRequest(w http.ResponseWriter, r *http.Request, req any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(req); err != nil {
+		writeError(w, fmt.Errorf("decoding request: %w", err))
+		return false
+	}
+
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrKeyUsage):
+		status = http.StatusForbidden
+	case errors.Is(err, formats.ErrCipher), errors.Is(err, errInternal):
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+}
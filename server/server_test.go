@@ -0,0 +1,324 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+
+	store, err := NewMemoryKeyStore(
+		Key{ID: "zpk", Algorithm: AlgorithmTDES, Usage: UsagePINEncryption, Key: zpk},
+		Key{ID: "aes", Algorithm: AlgorithmAES, Usage: UsagePINEncryption, Key: aesKey},
+		Key{ID: "pvk", Algorithm: AlgorithmTDES, Usage: UsagePINVerificationIBM3624, Key: zpk},
+		Key{ID: "pvv", Algorithm: AlgorithmTDES, Usage: UsagePINVerificationVisaPVV, Key: zpk},
+	)
+	require.NoError(t, err)
+
+	return New(store, opts...)
+}
+
+// failingStore returns ciphers that always fail
+type failingStore struct{}
+
+func (failingStore) PINEncryptionKey(string) (formats.Cipher, error) {
+	return failingCipher{}, nil
+}
+
+func (failingStore) PINVerificationKey(string, string) (formats.Cipher, error) {
+	return failingCipher{}, nil
+}
+
+type failingCipher struct{}
+
+func (failingCipher) Encrypt([]byte) ([]byte, error) {
+	return nil, errors.New("hsm unavailable")
+}
+
+func (failingCipher) Decrypt([]byte) ([]byte, error) {
+	return nil, errors.New("hsm unavailable")
+}
+
+func post(t *testing.T, s *Server, path string, body any, response any) int {
+	t.Helper()
+
+	data, ok := body.(string)
+	if !ok {
+		raw, err := json.Marshal(body)
+		require.NoError(t, err)
+		data = string(raw)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(data))
+	rec := httptest.NewRecorder()
+
+	s.ServeHTTP(rec, req)
+
+	if response != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), response), rec.Body.String())
+	}
+
+	return rec.Code
+}
+
+func TestEncodeDecode(t *testing.T) {
+	s := newTestServer(t, WithDecode())
+
+	var encoded EncodeResponse
+	code := post(t, s, "/encode", EncodeRequest{
+		FormatKey: FormatKey{Format: "ISO-0", KeyID: "zpk"},
+		PAN:       "5432101234567891",
+		PIN:       "1234",
+	}, &encoded)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "BA2ADC4EBA48F711", encoded.PINBlock)
+
+	var decoded DecodeResponse
+	code = post(t, s, "/decode", `{"format": "ISO-0", "key_id": "zpk", "pan": "5432101234567891", "pin_block": "BA2ADC4EBA48F711"}`, &decoded)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "1234", decoded.PIN)
+
+	// clear PIN block without key
+	code = post(t, s, "/encode", `{"format": "ISO-0", "pan": "5432101234567891", "pin": "1234"}`, &encoded)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "041215FEDCBA9876", encoded.PINBlock)
+}
+
+func TestTranslate(t *testing.T) {
+	s := newTestServer(t, WithDecode())
+
+	var translated TranslateResponse
+	code := post(t, s, "/translate", TranslateRequest{
+		From:     FormatKey{Format: "ISO-0", KeyID: "zpk"},
+		To:       FormatKey{Format: "ISO-4", KeyID: "aes"},
+		PAN:      "5432101234567891",
+		PINBlock: "BA2ADC4EBA48F711",
+	}, &translated)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, translated.PINBlock, 32)
+
+	var decoded DecodeResponse
+	code = post(t, s, "/decode", DecodeRequest{
+		FormatKey: FormatKey{Format: "ISO-4", KeyID: "aes"},
+		PAN:       "5432101234567891",
+		PINBlock:  translated.PINBlock,
+	}, &decoded)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "1234", decoded.PIN)
+}
+
+func TestVerify(t *testing.T) {
+	s := newTestServer(t)
+
+	t.Run("IBM 3624", func(t *testing.T) {
+		req := VerifyRequest{
+			FormatKey:      FormatKey{Format: "ISO-0", KeyID: "zpk"},
+			PAN:            "5432101234567891",
+			PINBlock:       "BA2ADC4EBA48F711",
+			Method:         MethodIBM3624,
+			PVKID:          "pvk",
+			Offset:         "4109",
+			ValidationData: "210123456789FFFF",
+		}
+
+		var verified VerifyResponse
+		code := post(t, s, "/verify", req, &verified)
+		require.Equal(t, http.StatusOK, code)
+		require.True(t, verified.Verified)
+
+		req.Offset = "4100"
+		code = post(t, s, "/verify", req, &verified)
+		require.Equal(t, http.StatusOK, code)
+		require.False(t, verified.Verified)
+	})
+
+	t.Run("Visa PVV", func(t *testing.T) {
+		var encoded EncodeResponse
+		code := post(t, s, "/encode", `{"format": "ISO-0", "key_id": "zpk", "pan": "4123456789012345", "pin": "1234"}`, &encoded)
+		require.Equal(t, http.StatusOK, code)
+
+		req := VerifyRequest{
+			FormatKey: FormatKey{Format: "ISO-0", KeyID: "zpk"},
+			PAN:       "4123456789012345",
+			PINBlock:  encoded.PINBlock,
+			Method:    MethodVisaPVV,
+			PVKID:     "pvv",
+			PVKI:      1,
+			PVV:       "1894",
+		}
+
+		var verified VerifyResponse
+		code = post(t, s, "/verify", req, &verified)
+		require.Equal(t, http.StatusOK, code)
+		require.True(t, verified.Verified)
+
+		req.PVKI = 2
+		code = post(t, s, "/verify", req, &verified)
+		require.Equal(t, http.StatusOK, code)
+		require.False(t, verified.Verified)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		var errResponse ErrorResponse
+		code := post(t, s, "/verify", VerifyRequest{
+			FormatKey: FormatKey{Format: "ISO-0", KeyID: "zpk"},
+			PAN:       "5432101234567891",
+			PINBlock:  "BA2ADC4EBA48F711",
+			Method:    "PIN-COMPARE",
+			PVKID:     "pvk",
+		}, &errResponse)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, `unsupported verification method "PIN-COMPARE"`, errResponse.Error)
+
+		code = post(t, s, "/verify", VerifyRequest{
+			FormatKey: FormatKey{Format: "ISO-0", KeyID: "zpk"},
+			PAN:       "5432101234567891",
+			PINBlock:  "BA2ADC4EBA48F711",
+			Method:    MethodIBM3624,
+			PVKID:     "unknown",
+		}, &errResponse)
+		require.Equal(t, http.StatusNotFound, code)
+		require.Equal(t, "pvk: key not found: unknown", errResponse.Error)
+	})
+
+	t.Run("decimalization table", func(t *testing.T) {
+		req := `{"format": "ISO-0", "key_id": "zpk", "pan": "5432101234567891", "pin_block": "BA2ADC4EBA48F711",
+			"method": "IBM3624", "pvk_id": "pvk", "offset": "4109", "validation_data": "210123456789FFFF"`
+
+		// the callers can not choose the table
+		var errResponse ErrorResponse
+		code := post(t, s, "/verify", req+`, "decimalization_table": "0000000000000000"}`, &errResponse)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Contains(t, errResponse.Error, `unknown field "decimalization_table"`)
+
+		var verified VerifyResponse
+		code = post(t, newTestServer(t, WithDecimalizationTable("9876543210987654")), "/verify", req+"}", &verified)
+		require.Equal(t, http.StatusOK, code)
+		require.False(t, verified.Verified)
+
+		code = post(t, newTestServer(t, WithDecimalizationTable("0123")), "/verify", req+"}", &errResponse)
+		require.Equal(t, http.StatusInternalServerError, code)
+		require.Equal(t, "internal error: decimalization table must be 16 digits", errResponse.Error)
+	})
+
+	t.Run("key usage", func(t *testing.T) {
+		var errResponse ErrorResponse
+
+		// a PIN encryption key is not a PIN verification key
+		code := post(t, s, "/verify", VerifyRequest{
+			FormatKey:      FormatKey{Format: "ISO-0", KeyID: "zpk"},
+			PAN:            "5432101234567891",
+			PINBlock:       "BA2ADC4EBA48F711",
+			Method:         MethodIBM3624,
+			PVKID:          "zpk",
+			Offset:         "4109",
+			ValidationData: "210123456789FFFF",
+		}, &errResponse)
+		require.Equal(t, http.StatusForbidden, code)
+		require.Equal(t, "pvk: key zpk has usage P0, expected V1", errResponse.Error)
+
+		// a PIN verification key only verifies PINs with its method
+		code = post(t, s, "/verify", VerifyRequest{
+			FormatKey: FormatKey{Format: "ISO-0", KeyID: "zpk"},
+			PAN:       "5432101234567891",
+			PINBlock:  "BA2ADC4EBA48F711",
+			Method:    MethodVisaPVV,
+			PVKID:     "pvk",
+			PVKI:      1,
+			PVV:       "1894",
+		}, &errResponse)
+		require.Equal(t, http.StatusForbidden, code)
+		require.Equal(t, "pvk: key pvk has usage V1, expected V2", errResponse.Error)
+
+		code = post(t, s, "/verify", VerifyRequest{
+			FormatKey:      FormatKey{Format: "ISO-0", KeyID: "zpk"},
+			PAN:            "5432101234567891",
+			PINBlock:       "BA2ADC4EBA48F711",
+			Method:         MethodIBM3624,
+			PVKID:          "pvv",
+			Offset:         "4109",
+			ValidationData: "210123456789FFFF",
+		}, &errResponse)
+		require.Equal(t, http.StatusForbidden, code)
+		require.Equal(t, "pvk: key pvv has usage V2, expected V1", errResponse.Error)
+
+		// a PIN verification key does not decrypt PIN blocks
+		code = post(t, s, "/verify", VerifyRequest{
+			FormatKey:      FormatKey{Format: "ISO-0", KeyID: "pvk"},
+			PAN:            "5432101234567891",
+			PINBlock:       "BA2ADC4EBA48F711",
+			Method:         MethodIBM3624,
+			PVKID:          "pvk",
+			Offset:         "4109",
+			ValidationData: "210123456789FFFF",
+		}, &errResponse)
+		require.Equal(t, http.StatusForbidden, code)
+		require.Equal(t, "key pvk has usage V1, expected P0", errResponse.Error)
+	})
+}
+
+func TestErrors(t *testing.T) {
+	s := newTestServer(t, WithDecode())
+
+	var errResponse ErrorResponse
+
+	code := post(t, s, "/decode", `{"format": "ISO-0", "key_id": "bdk", "pan": "5432101234567891", "pin_block": "BA2ADC4EBA48F711"}`, &errResponse)
+	require.Equal(t, http.StatusNotFound, code)
+	require.Equal(t, "key not found: bdk", errResponse.Error)
+
+	code = post(t, s, "/decode", `{"format": "ISO-9", "pan": "5432101234567891", "pin_block": "BA2ADC4EBA48F711"}`, &errResponse)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "format ISO-9: unsupported pinblock type", errResponse.Error)
+
+	code = post(t, s, "/decode", `{"format": "ISO-0", "pan": "54321", "pin_block": "BA2ADC4EBA48F711"}`, &errResponse)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, errResponse.Error, "decoding pin block")
+
+	code = post(t, s, "/translate", `{"from": {"format": "ISO-0"}, "to": {"format": "ISO-4", "key_id": "bdk"}, "pan": "5432101234567891", "pin_block": "041215FEDCBA9876"}`, &errResponse)
+	require.Equal(t, http.StatusNotFound, code)
+	require.Equal(t, "to: key not found: bdk", errResponse.Error)
+
+	// a PIN verification key does not encrypt or decrypt PIN blocks
+	code = post(t, s, "/decode", `{"format": "ISO-0", "key_id": "pvk", "pan": "5432101234567891", "pin_block": "BA2ADC4EBA48F711"}`, &errResponse)
+	require.Equal(t, http.StatusForbidden, code)
+	require.Equal(t, "key pvk has usage V1, expected P0", errResponse.Error)
+
+	code = post(t, s, "/encode", `{"format": "ISO-0", "key_id": "pvk", "pan": "5432101234567891", "pin": "1234"}`, &errResponse)
+	require.Equal(t, http.StatusForbidden, code)
+
+	code = post(t, s, "/translate", `{"from": {"format": "ISO-0", "key_id": "zpk"}, "to": {"format": "ISO-0", "key_id": "pvk"}, "pan": "5432101234567891", "pin_block": "BA2ADC4EBA48F711"}`, &errResponse)
+	require.Equal(t, http.StatusForbidden, code)
+	require.Equal(t, "to: key pvk has usage V1, expected P0", errResponse.Error)
+
+	code = post(t, s, "/encode", `{"format": "ISO-0", "pin": "1234", "key": "0123456789ABCDEF"}`, &errResponse)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, errResponse.Error, `unknown field "key"`)
+
+	code = post(t, s, "/encode", `{"format": `, &errResponse)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, errResponse.Error, "decoding request")
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/encode", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	// the cipher failures are errors of the server
+	code = post(t, New(failingStore{}), "/encode", `{"format": "ISO-0", "key_id": "zpk", "pan": "5432101234567891", "pin": "1234"}`, &errResponse)
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, "encoding pin block: encrypting pinBlock: hsm unavailable", errResponse.Error)
+}
+
+func TestDecodeIsOptional(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestServer(t).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/decode",
+		bytes.NewBufferString(`{"format": "ISO-0", "key_id": "zpk", "pan": "5432101234567891", "pin_block": "BA2ADC4EBA48F711"}`)))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
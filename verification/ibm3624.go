@@ -0,0 +1,157 @@
+// Package verification implements the PIN verification methods used by
+// issuers: IBM 3624 PIN offsets and Visa PIN verification values (PVV).
+//
+// The PIN is verified after it is decoded from a PIN block:
+//
+//	pin, err := formats.NewEncrypted(formats.NewISO0(), zpk).Decode(pinBlock, account)
+//	ok, err := ibm3624.Verify(pin, validationData, offset)
+package verification
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/moov-io/pinblock/formats"
+)
+
+// DefaultDecimalizationTable maps the hex digits 0-F to 0123456789012345
+const DefaultDecimalizationTable = "0123456789012345"
+
+// IBM3624 generates natural PINs and PIN offsets, and verifies PINs with the
+// IBM 3624 method.
+//
+//	The validation data, usually derived from the PAN, is encrypted with the
+//	PIN verification key (PVK) and decimalized. The leftmost digits of the
+//	result are the natural PIN. The offset is the digit by digit difference,
+//	modulo 10, between the customer selected PIN and the natural PIN.
+type IBM3624 struct {
+	pvk                 formats.Cipher
+	decimalizationTable string
+}
+
+// NewIBM3624 returns the IBM 3624 method for a PIN verification key and a
+// decimalization table of 16 decimal digits. The PVK encrypts 8 byte blocks,
+// such as encryption.TdesECB.
+func NewIBM3624(pvk formats.Cipher, decimalizationTable string) (*IBM3624, error) {
+	if pvk == nil {
+		return nil, fmt.Errorf("pvk is required")
+	}
+
+	if len(decimalizationTable) != 16 || !isDigits(decimalizationTable) {
+		return nil, fmt.Errorf("decimalization table must be 16 digits")
+	}
+
+	return &IBM3624{
+		pvk:                 pvk,
+		decimalizationTable: decimalizationTable,
+	}, nil
+}
+
+// NaturalPIN returns the natural PIN of length digits for the validation
+// data of 16 hex characters
+func (i *IBM3624) NaturalPIN(validationData string, length int) (string, error) {
+	if length < 4 || length > 12 {
+		return "", fmt.Errorf("pin length must be between 4 and 12 digits")
+	}
+
+	if len(validationData) != 16 {
+		return "", fmt.Errorf("validation data must be 16 characters")
+	}
+
+	rawData, err := hex.DecodeString(validationData)
+	if err != nil {
+		return "", fmt.Errorf("decoding validation data: %w", err)
+	}
+
+	encryptedData, err := i.pvk.Encrypt(rawData)
+	if err != nil {
+		return "", fmt.Errorf("encrypting validation data: %w", err)
+	}
+
+	// decimalize the hex digits of the encrypted validation data
+	natural := make([]byte, length)
+	for j := range natural {
+		nibble := encryptedData[j/2] >> 4
+		if j%2 == 1 {
+			nibble = encryptedData[j/2] & 0x0F
+		}
+		natural[j] = i.decimalizationTable[nibble]
+	}
+
+	return string(natural), nil
+}
+
+// Offset returns the offset of checkLength digits for the customer selected
+// PIN. Only the leftmost checkLength digits of the PIN are verified.
+func (i *IBM3624) Offset(pin, validationData string, checkLength int) (string, error) {
+	if len(pin) < 4 || len(pin) > 12 || !isDigits(pin) {
+		return "", fmt.Errorf("pin must be between 4 and 12 digits")
+	}
+
+	if checkLength < 4 || checkLength > len(pin) {
+		return "", fmt.Errorf("pin check length must be between 4 and the pin length")
+	}
+
+	natural, err := i.NaturalPIN(validationData, checkLength)
+	if err != nil {
+		return "", err
+	}
+
+	offset := make([]byte, checkLength)
+	for j := range offset {
+		offset[j] = '0' + (pin[j]-natural[j]+10)%10
+	}
+
+	return string(offset), nil
+}
+
+// Verify reports whether the PIN matches the offset. The PIN check length is
+// the length of the offset.
+func (i *IBM3624) Verify(pin, validationData, offset string) (bool, error) {
+	if !isDigits(offset) {
+		return false, fmt.Errorf("offset must be digits")
+	}
+
+	expected, err := i.Offset(pin, validationData, len(offset))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(offset)) == 1, nil
+}
+
+// ValidationData returns the validation data of 16 hex characters made of
+// the rightmost length digits of the account number, excluding the check
+// digit, padded on the right with pad.
+func ValidationData(account string, length int, pad byte) (string, error) {
+	if length < 1 || length > 16 {
+		return "", fmt.Errorf("length must be between 1 and 16 digits")
+	}
+
+	if len(account) < length+1 || !isDigits(account) {
+		return "", fmt.Errorf("account must be at least %d digits", length+1)
+	}
+
+	if !strings.ContainsRune("0123456789ABCDEF", rune(pad)) {
+		return "", fmt.Errorf("pad must be a hex character")
+	}
+
+	digits := account[len(account)-1-length : len(account)-1]
+
+	return digits + strings.Repeat(string(pad), 16-length), nil
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package verification
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/pinblock/encryption"
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func newPVK(t *testing.T, key string) *encryption.TdesECB {
+	t.Helper()
+
+	rawKey, err := hex.DecodeString(key)
+	require.NoError(t, err)
+
+	pvk, err := encryption.NewTdesECB(rawKey)
+	require.NoError(t, err)
+
+	return pvk
+}
+
+func TestIBM3624(t *testing.T) {
+	pvk := newPVK(t, "0123456789ABCDEFFEDCBA9876543210")
+
+	ibm3624, err := NewIBM3624(pvk, DefaultDecimalizationTable)
+	require.NoError(t, err)
+
+	account := "5432101234567891"
+
+	validationData, err := ValidationData(account, 12, 'F')
+	require.NoError(t, err)
+	require.Equal(t, "210123456789FFFF", validationData)
+
+	t.Run("NaturalPIN", func(t *testing.T) {
+		// encrypted validation data is 71DF0A971EB2DEAF
+		natural, err := ibm3624.NaturalPIN(validationData, 4)
+		require.NoError(t, err)
+		require.Equal(t, "7135", natural)
+
+		natural, err = ibm3624.NaturalPIN(validationData, 6)
+		require.NoError(t, err)
+		require.Equal(t, "713500", natural)
+	})
+
+	t.Run("Offset", func(t *testing.T) {
+		offset, err := ibm3624.Offset("1234", validationData, 4)
+		require.NoError(t, err)
+		require.Equal(t, "4109", offset)
+
+		// natural PIN has offset 0000
+		offset, err = ibm3624.Offset("7135", validationData, 4)
+		require.NoError(t, err)
+		require.Equal(t, "0000", offset)
+
+		// only the check length digits are used
+		offset, err = ibm3624.Offset("123456", validationData, 4)
+		require.NoError(t, err)
+		require.Equal(t, "4109", offset)
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		ok, err := ibm3624.Verify("1234", validationData, "4109")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = ibm3624.Verify("1235", validationData, "4109")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		ok, err = ibm3624.Verify("123499", validationData, "4109")
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("Verify decoded PIN", func(t *testing.T) {
+		pin, err := formats.NewISO0().Decode("041215FEDCBA9876", account)
+		require.NoError(t, err)
+
+		ok, err := ibm3624.Verify(pin, validationData, "4109")
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("custom decimalization table", func(t *testing.T) {
+		ibm3624, err := NewIBM3624(pvk, "9876543210123456")
+		require.NoError(t, err)
+
+		natural, err := ibm3624.NaturalPIN(validationData, 4)
+		require.NoError(t, err)
+		require.Equal(t, "2846", natural)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		_, err := NewIBM3624(nil, DefaultDecimalizationTable)
+		require.EqualError(t, err, "pvk is required")
+
+		_, err = NewIBM3624(pvk, "012345678901234")
+		require.EqualError(t, err, "decimalization table must be 16 digits")
+
+		_, err = NewIBM3624(pvk, "0123456789ABCDEF")
+		require.EqualError(t, err, "decimalization table must be 16 digits")
+
+		_, err = ibm3624.NaturalPIN(validationData, 3)
+		require.EqualError(t, err, "pin length must be between 4 and 12 digits")
+
+		_, err = ibm3624.NaturalPIN("210123456789FFF", 4)
+		require.EqualError(t, err, "validation data must be 16 characters")
+
+		_, err = ibm3624.NaturalPIN("210123456789FFFX", 4)
+		require.ErrorContains(t, err, "decoding validation data")
+
+		_, err = ibm3624.Offset("12a4", validationData, 4)
+		require.EqualError(t, err, "pin must be between 4 and 12 digits")
+
+		_, err = ibm3624.Offset("1234", validationData, 5)
+		require.EqualError(t, err, "pin check length must be between 4 and the pin length")
+
+		_, err = ibm3624.Verify("1234", validationData, "41O9")
+		require.EqualError(t, err, "offset must be digits")
+
+		_, err = ValidationData("54321", 12, 'F')
+		require.EqualError(t, err, "account must be at least 13 digits")
+
+		_, err = ValidationData(account, 12, 'X')
+		require.EqualError(t, err, "pad must be a hex character")
+
+		_, err = ValidationData(account, 17, 'F')
+		require.EqualError(t, err, "length must be between 1 and 16 digits")
+	})
+}
@@ -0,0 +1,95 @@
+package verification
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/moov-io/pinblock/formats"
+)
+
+// VisaPVV generates and verifies Visa PIN verification values (PVV).
+//
+//	The transformed security parameter (TSP) is made of the 11 rightmost
+//	digits of the PAN, excluding the check digit, the PIN verification key
+//	index (PVKI) and the 4 leftmost digits of the PIN. The TSP is encrypted
+//	with the PVK pair and the PVV is the first 4 decimal digits of the result.
+//	When there are fewer than 4, the hex digits A-F are used as 0-5.
+type VisaPVV struct {
+	pvk formats.Cipher
+}
+
+// NewVisaPVV returns the Visa PVV method for a PVK pair, usually a
+// double-length TDES key made of PVK A and PVK B.
+func NewVisaPVV(pvk formats.Cipher) (*VisaPVV, error) {
+	if pvk == nil {
+		return nil, fmt.Errorf("pvk is required")
+	}
+
+	return &VisaPVV{
+		pvk: pvk,
+	}, nil
+}
+
+// Generate returns the 4 digits PVV of the PIN
+func (v *VisaPVV) Generate(pin, account string, pvki int) (string, error) {
+	if len(pin) < 4 || len(pin) > 12 || !isDigits(pin) {
+		return "", fmt.Errorf("pin must be between 4 and 12 digits")
+	}
+
+	if len(account) < 12 || !isDigits(account) {
+		return "", fmt.Errorf("account must be at least 12 digits")
+	}
+
+	if pvki < 0 || pvki > 9 {
+		return "", fmt.Errorf("pvki must be between 0 and 9")
+	}
+
+	tsp := fmt.Sprintf("%s%d%s", account[len(account)-12:len(account)-1], pvki, pin[:4])
+
+	rawTSP, err := hex.DecodeString(tsp)
+	if err != nil {
+		return "", fmt.Errorf("decoding tsp: %w", err)
+	}
+
+	encryptedTSP, err := v.pvk.Encrypt(rawTSP)
+	if err != nil {
+		return "", fmt.Errorf("encrypting tsp: %w", err)
+	}
+
+	return decimalizePVV(fmt.Sprintf("%X", encryptedTSP)), nil
+}
+
+// Verify reports whether the PIN matches the PVV
+func (v *VisaPVV) Verify(pin, account string, pvki int, pvv string) (bool, error) {
+	if len(pvv) != 4 || !isDigits(pvv) {
+		return false, fmt.Errorf("pvv must be 4 digits")
+	}
+
+	expected, err := v.Generate(pin, account, pvki)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(pvv)) == 1, nil
+}
+
+// decimalizePVV returns the first 4 decimal digits of the encrypted TSP,
+// completed by the hex letters converted to digits
+func decimalizePVV(encryptedTSP string) string {
+	pvv := make([]byte, 0, 4)
+
+	for i := 0; i < len(encryptedTSP) && len(pvv) < 4; i++ {
+		if c := encryptedTSP[i]; c >= '0' && c <= '9' {
+			pvv = append(pvv, c)
+		}
+	}
+
+	for i := 0; i < len(encryptedTSP) && len(pvv) < 4; i++ {
+		if c := encryptedTSP[i]; c >= 'A' && c <= 'F' {
+			pvv = append(pvv, '0'+c-'A')
+		}
+	}
+
+	return string(pvv)
+}
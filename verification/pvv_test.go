@@ -0,0 +1,90 @@
+package verification
+
+import (
+	"testing"
+
+	"github.com/moov-io/pinblock/formats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisaPVV(t *testing.T) {
+	pvk := newPVK(t, "0123456789ABCDEFFEDCBA9876543210")
+
+	pvv, err := NewVisaPVV(pvk)
+	require.NoError(t, err)
+
+	account := "4123456789012345"
+
+	t.Run("Generate", func(t *testing.T) {
+		// TSP is 4567890123411234, encrypted TSP is 189E41ACA69078E5
+		value, err := pvv.Generate("1234", account, 1)
+		require.NoError(t, err)
+		require.Equal(t, "1894", value)
+
+		// only the 4 leftmost digits of the PIN are used
+		value, err = pvv.Generate("123456", account, 1)
+		require.NoError(t, err)
+		require.Equal(t, "1894", value)
+
+		// encrypted TSP is 11768081D3044B75
+		value, err = pvv.Generate("1235", account, 1)
+		require.NoError(t, err)
+		require.Equal(t, "1176", value)
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		ok, err := pvv.Verify("1234", account, 1, "1894")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = pvv.Verify("1235", account, 1, "1894")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		ok, err = pvv.Verify("1234", account, 2, "1894")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("Verify decoded PIN", func(t *testing.T) {
+		iso0 := formats.NewISO0()
+
+		pinBlock, err := iso0.Encode("1234", account)
+		require.NoError(t, err)
+
+		pin, err := iso0.Decode(pinBlock, account)
+		require.NoError(t, err)
+
+		ok, err := pvv.Verify(pin, account, 1, "1894")
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("decimalization", func(t *testing.T) {
+		require.Equal(t, "1894", decimalizePVV("189E41ACA69078E5"))
+
+		// hex letters are used when there are fewer than 4 digits
+		require.Equal(t, "1201", decimalizePVV("ABCDEF1ABCDEF2AB"))
+		require.Equal(t, "0123", decimalizePVV("ABCDEFABCDEFABCD"))
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		_, err := NewVisaPVV(nil)
+		require.EqualError(t, err, "pvk is required")
+
+		_, err = pvv.Generate("123", account, 1)
+		require.EqualError(t, err, "pin must be between 4 and 12 digits")
+
+		_, err = pvv.Generate("12a4", account, 1)
+		require.EqualError(t, err, "pin must be between 4 and 12 digits")
+
+		_, err = pvv.Generate("1234", "41234567890", 1)
+		require.EqualError(t, err, "account must be at least 12 digits")
+
+		_, err = pvv.Generate("1234", account, 10)
+		require.EqualError(t, err, "pvki must be between 0 and 9")
+
+		_, err = pvv.Verify("1234", account, 1, "189")
+		require.EqualError(t, err, "pvv must be 4 digits")
+	})
+}